@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"github.com/cihub/seelog"
 	"github.com/watermint/dcfg/common/file"
+	"github.com/watermint/dcfg/common/schedule"
+	"github.com/watermint/dcfg/common/text"
 	"github.com/watermint/dcfg/common/util"
+	"net/url"
 	"os"
 	"path"
 	"strings"
+	"time"
 )
 
 type Options struct {
@@ -19,15 +23,88 @@ type Options struct {
 	DryRun         bool
 	Proxy          string
 	GroupWhiteList string
+	PlanOnly       bool
+	ApplyPlan      string
+
+	// Safety limits. Zero means no limit.
+	LimitUserRemove               int
+	LimitUserRemovePercent        int
+	LimitUserAdd                  int
+	LimitUserAddPercent           int
+	LimitGroupMemberRemove        int
+	LimitGroupMemberRemovePercent int
+	LimitGroupDelete              int
+	ForceLargeChange              bool
+
+	// Deprovision policy
+	DeprovisionPolicy        string
+	DeprovisionGraceDays     int
+	DeprovisionWipeData      bool
+	DeprovisionTransferDest  string
+	DeprovisionTransferAdmin string
+
+	// Retry of API calls
+	RetryMaxAttempts   int
+	RetryWait          time.Duration
+	RetryMaxWait       time.Duration
+	RetryJitterPercent int
+
+	// Number of parallel API calls on loading Dropbox groups
+	DropboxConcurrency int
+
+	// Max wait for completion of Dropbox async jobs
+	JobTimeout time.Duration
+
+	// Expansion of nested Google groups
+	GoogleGroupMaxDepth int
+	GoogleConcurrency   int
+
+	// On-disk cache of directories. Zero TTL disables the cache.
+	CacheTTL     time.Duration
+	CacheRefresh bool
+
+	// Incremental sync by change feeds of Google Apps and Dropbox
+	Incremental             bool
+	IncrementalFullInterval time.Duration
+
+	// Daemon mode. Runs sync on the interval, or the cron expression if specified.
+	Daemon         bool
+	DaemonInterval time.Duration
+	DaemonSchedule string
+
+	// HTTP admin API on daemon mode
+	Api       bool
+	ApiListen string
+
+	// Metrics in Prometheus format. Endpoint on daemon mode, or the file for
+	// the textfile collector of node exporter.
+	MetricsListen   string
+	MetricsTextfile string
+
+	// Mail notification of run results. Disabled if the host is empty.
+	SmtpHost     string
+	SmtpPort     int
+	SmtpStartTLS bool
+	SmtpUsername string
+	SmtpFrom     string
+	SmtpTo       string
+	NotifyOn     string
+
+	// Verify hash chain of the audit log, then exit
+	AuditVerify bool
 }
 
 const (
-	MODE_AUTH_DROPBOX = "dropbox"
-	MODE_AUTH_GOOGLE  = "google"
+	MODE_AUTH_DROPBOX       = "dropbox"
+	MODE_AUTH_DROPBOX_AUDIT = "dropbox-audit"
+	MODE_AUTH_GOOGLE        = "google"
 
-	MODE_SYNC_GROUP_PROVISION  = "group-provision"
-	MODE_SYNC_USER_PROVISION   = "user-provision"
-	MODE_SYNC_USER_DEPROVISION = "user-deprovision"
+	MODE_SYNC_GROUP_PROVISION   = "group-provision"
+	MODE_SYNC_USER_PROVISION    = "user-provision"
+	MODE_SYNC_USER_DEPROVISION  = "user-deprovision"
+	MODE_SYNC_GROUP_DEPROVISION = "group-deprovision"
+	MODE_SYNC_USER_SUSPEND      = "user-suspend"
+	MODE_SYNC_USER_UPDATE       = "user-update"
 
 	optNameModeAuth       = "auth"
 	optNameModeSync       = "sync"
@@ -35,22 +112,183 @@ const (
 	optNameDryRun         = "dryrun"
 	optNameProxy          = "proxy"
 	optNameGroupWhiteList = "group-provision-list"
+	optNamePlanOnly       = "plan"
+	optNameApplyPlan      = "apply"
+
+	optNameLimitUserRemove               = "limit-user-remove"
+	optNameLimitUserRemovePercent        = "limit-user-remove-percent"
+	optNameLimitUserAdd                  = "limit-user-add"
+	optNameLimitUserAddPercent           = "limit-user-add-percent"
+	optNameLimitGroupMemberRemove        = "limit-group-member-remove"
+	optNameLimitGroupMemberRemovePercent = "limit-group-member-remove-percent"
+	optNameLimitGroupDelete              = "limit-group-delete"
+	optNameForceLargeChange              = "force-large-change"
+
+	optNameDeprovisionPolicy        = "deprovision-policy"
+	optNameDeprovisionGraceDays     = "deprovision-grace-days"
+	optNameDeprovisionWipeData      = "deprovision-wipe-data"
+	optNameDeprovisionTransferDest  = "deprovision-transfer-to"
+	optNameDeprovisionTransferAdmin = "deprovision-transfer-admin"
+
+	optNameRetryMaxAttempts   = "retry-max-attempts"
+	optNameRetryWait          = "retry-wait"
+	optNameRetryMaxWait       = "retry-max-wait"
+	optNameRetryJitterPercent = "retry-jitter-percent"
+
+	optNameDropboxConcurrency = "dropbox-concurrency"
+	optNameJobTimeout         = "job-timeout"
+
+	optNameGoogleGroupMaxDepth = "google-group-max-depth"
+	optNameGoogleConcurrency   = "google-concurrency"
+
+	optNameCacheTTL     = "cache-ttl"
+	optNameCacheRefresh = "cache-refresh"
+
+	optNameIncremental             = "incremental"
+	optNameIncrementalFullInterval = "incremental-full-interval"
+
+	optNameDaemon         = "daemon"
+	optNameDaemonInterval = "daemon-interval"
+	optNameDaemonSchedule = "daemon-schedule"
+
+	optNameApi       = "api"
+	optNameApiListen = "api-listen"
+
+	optNameMetricsListen   = "metrics-listen"
+	optNameMetricsTextfile = "metrics-textfile"
+
+	optNameSmtpHost     = "smtp-host"
+	optNameSmtpPort     = "smtp-port"
+	optNameSmtpStartTLS = "smtp-starttls"
+	optNameSmtpUsername = "smtp-username"
+	optNameSmtpFrom     = "smtp-from"
+	optNameSmtpTo       = "smtp-to"
+	optNameNotifyOn     = "notify-on"
+
+	optNameAuditVerify = "audit-verify"
+
+	NOTIFY_ON_FAILURE = "failure"
+	NOTIFY_ON_CHANGE  = "change"
+	NOTIFY_ON_ALWAYS  = "always"
+
+	DEPROVISION_POLICY_REMOVE              = "remove"
+	DEPROVISION_POLICY_SUSPEND             = "suspend"
+	DEPROVISION_POLICY_SUSPEND_THEN_REMOVE = "suspend-then-remove"
+
+	DEFAULT_DEPROVISION_GRACE_DAYS = 30
+
+	DEFAULT_RETRY_MAX_ATTEMPTS   = 5
+	DEFAULT_RETRY_WAIT           = 1 * time.Second
+	DEFAULT_RETRY_MAX_WAIT       = 60 * time.Second
+	DEFAULT_RETRY_JITTER_PERCENT = 20
+
+	DEFAULT_DROPBOX_CONCURRENCY = 4
+	DEFAULT_JOB_TIMEOUT         = 5 * time.Minute
+
+	DEFAULT_GOOGLE_GROUP_MAX_DEPTH = 10
+	DEFAULT_GOOGLE_CONCURRENCY     = 4
+
+	DEFAULT_INCREMENTAL_FULL_INTERVAL = 24 * time.Hour
+
+	DEFAULT_DAEMON_INTERVAL  = 1 * time.Hour
+	DEFAULT_DAEMON_CACHE_TTL = 1 * time.Minute
+
+	DEFAULT_API_LISTEN = "127.0.0.1:8027"
+
+	DEFAULT_SMTP_PORT = 587
+
+	DEFAULT_LIMIT_USER_REMOVE                 = 50
+	DEFAULT_LIMIT_USER_REMOVE_PERCENT         = 0
+	DEFAULT_LIMIT_USER_ADD                    = 0
+	DEFAULT_LIMIT_USER_ADD_PERCENT            = 0
+	DEFAULT_LIMIT_GROUP_MEMBER_REMOVE         = 200
+	DEFAULT_LIMIT_GROUP_MEMBER_REMOVE_PERCENT = 0
+	DEFAULT_LIMIT_GROUP_DELETE                = 10
 
 	FILENAME_GOOGLE_TOKEN         = "google_token.json"
 	FILENAME_GOOGLE_CLIENT_SECRET = "google_client_secret.json"
 	FILENAME_DROPBOX_TOKEN        = "dropbox_token.json"
+	FILENAME_PLAN_FORMAT          = "plan-%s.json"
+	FILENAME_DEPROVISION_STATE    = "deprovision_state.json"
+	FILENAME_CACHE                = "cache"
+	FILENAME_CHECKPOINT           = "checkpoint.json"
+	FILENAME_DAEMON_STATUS        = "daemon_status.json"
+	FILENAME_API_TOKEN            = "api_token"
+	FILENAME_REPORTS              = "reports"
+	FILENAME_REPORT_FORMAT        = "report-%s.%s"
+	FILENAME_REPORT_HTML_FORMAT   = "report-%s.html"
+	FILENAME_SMTP_PASSWORD        = "smtp_password"
+	FILENAME_AUDIT_LOG            = "audit.jsonl"
+	FILENAME_WEBHOOK_SLACK        = "webhook_slack"
+	FILENAME_WEBHOOK_JSON         = "webhook_json"
 )
 
 var (
-	modeAuthOpts = []string{MODE_AUTH_GOOGLE, MODE_AUTH_DROPBOX}
-	modeSyncOpts = []string{MODE_SYNC_USER_PROVISION, MODE_SYNC_USER_DEPROVISION, MODE_SYNC_GROUP_PROVISION}
+	modeAuthOpts          = []string{MODE_AUTH_GOOGLE, MODE_AUTH_DROPBOX, MODE_AUTH_DROPBOX_AUDIT}
+	deprovisionPolicyOpts = []string{DEPROVISION_POLICY_REMOVE, DEPROVISION_POLICY_SUSPEND, DEPROVISION_POLICY_SUSPEND_THEN_REMOVE}
+	notifyOnOpts          = []string{NOTIFY_ON_FAILURE, NOTIFY_ON_CHANGE, NOTIFY_ON_ALWAYS}
+	modeSyncOpts          = []string{MODE_SYNC_USER_PROVISION, MODE_SYNC_USER_DEPROVISION, MODE_SYNC_USER_SUSPEND, MODE_SYNC_USER_UPDATE, MODE_SYNC_GROUP_PROVISION, MODE_SYNC_GROUP_DEPROVISION}
 
 	optDescModeAuth       = fmt.Sprintf("Update API token. Choose API provider (%s)", strings.Join(modeAuthOpts, ", "))
 	optDescModeSync       = fmt.Sprintf("Sync mode. Separate by comma if you want ot use multiple modes. (%s)", strings.Join(modeSyncOpts, ", "))
 	optDescBasePath       = "Path for config/log files."
 	optDescDryRun         = "Dry run"
 	optDescProxy          = "HTTP(S) proxy (hostname:port)"
-	optDescGroupWhiteList = "White list file for group-provision"
+	optDescGroupWhiteList = "White list file for group-provision and group-deprovision"
+	optDescPlanOnly       = "Write sync plan into the file under `-path` without executing it"
+	optDescApplyPlan      = "Apply sync plan file which created by `-plan`"
+
+	optDescLimitUserRemove               = "Abort the run if more than this number of users will be removed (0: no limit)"
+	optDescLimitUserRemovePercent        = "Abort the run if more than this percentage of Dropbox team members will be removed (0: no limit)"
+	optDescLimitUserAdd                  = "Abort the run if more than this number of users will be added (0: no limit)"
+	optDescLimitUserAddPercent           = "Abort the run if users more than this percentage of Dropbox team members will be added (0: no limit)"
+	optDescLimitGroupMemberRemove        = "Abort the run if more than this number of group members will be removed (0: no limit)"
+	optDescLimitGroupMemberRemovePercent = "Abort the run if group members more than this percentage of Dropbox team members will be removed (0: no limit)"
+	optDescLimitGroupDelete              = "Abort the run if more than this number of groups will be deleted (0: no limit)"
+	optDescForceLargeChange              = "Proceed even if the change exceeds limits"
+
+	optDescDeprovisionPolicy        = fmt.Sprintf("Policy for user-deprovision (%s)", strings.Join(deprovisionPolicyOpts, ", "))
+	optDescDeprovisionGraceDays     = "Days between suspend and remove for `suspend-then-remove` policy"
+	optDescDeprovisionWipeData      = "Wipe data from devices of the user on remove"
+	optDescDeprovisionTransferDest  = "Transfer files of the user to this member on remove (email)"
+	optDescDeprovisionTransferAdmin = "Team admin who receives errors of the file transfer (email)"
+
+	optDescRetryMaxAttempts   = "Max attempts of an API call on rate limit or temporary errors (1: no retry)"
+	optDescRetryWait          = "Wait before the first retry. Doubled for each retry"
+	optDescRetryMaxWait       = "Max wait between retries, unless the server requests longer wait"
+	optDescRetryJitterPercent = "Randomise wait between retries by up to this percentage"
+
+	optDescDropboxConcurrency = "Number of parallel API calls on loading Dropbox groups"
+	optDescJobTimeout         = "Max wait for completion of a Dropbox async job (e.g. group member changes)"
+
+	optDescGoogleGroupMaxDepth = "Max depth of nested Google Groups to expand. Members of deeper groups are ignored"
+	optDescGoogleConcurrency   = "Number of parallel API calls on loading members of nested Google Groups"
+
+	optDescCacheTTL     = "Cache Google Apps directory under the path, and use it within the duration (e.g. 30m). Zero disables the cache"
+	optDescCacheRefresh = "Ignore cached directories, and refresh the cache"
+
+	optDescIncremental             = "Sync only users and groups changed since the last sync, by Google Apps audit reports and Dropbox team events"
+	optDescIncrementalFullInterval = "Interval of full sync in the incremental mode"
+
+	optDescDaemon         = "Run as daemon, and sync on the schedule until SIGTERM"
+	optDescDaemonInterval = "Interval of sync on daemon mode"
+	optDescDaemonSchedule = "Cron expression of sync on daemon mode (e.g. `*/30 * * * *`). Overrides the interval"
+
+	optDescApi       = "Enable HTTP admin API on daemon mode. The token is stored in the file under the path"
+	optDescApiListen = "Listen address of HTTP admin API (host:port)"
+
+	optDescMetricsListen   = "Listen address of Prometheus metrics endpoint `/metrics` on daemon mode (host:port)"
+	optDescMetricsTextfile = "Write Prometheus metrics into the file after each run (e.g. for textfile collector of node exporter)"
+
+	optDescSmtpHost     = "SMTP server for mail notification of run results"
+	optDescSmtpPort     = "SMTP server port"
+	optDescSmtpStartTLS = "Use STARTTLS for SMTP"
+	optDescSmtpUsername = "SMTP username. The password is loaded from the file `smtp_password` under the path"
+	optDescSmtpFrom     = "Sender address of mail notification"
+	optDescSmtpTo       = "Recipients of mail notification. Separate by comma for multiple recipients"
+	optDescNotifyOn     = fmt.Sprintf("Notify run results on (%s)", strings.Join(notifyOnOpts, ", "))
+
+	optDescAuditVerify = "Verify hash chain of the audit log `audit.jsonl` under the path, then exit"
 )
 
 func (o *Options) IsModeAuth() bool {
@@ -59,6 +297,9 @@ func (o *Options) IsModeAuth() bool {
 func (o *Options) IsModeSync() bool {
 	return o.ModeSync != ""
 }
+func (o *Options) IsModeApply() bool {
+	return o.ApplyPlan != ""
+}
 
 func (o *Options) IsModeAuthGoogle() bool {
 	return o.ModeAuth == MODE_AUTH_GOOGLE
@@ -66,6 +307,9 @@ func (o *Options) IsModeAuthGoogle() bool {
 func (o *Options) IsModeAuthDropbox() bool {
 	return o.ModeAuth == MODE_AUTH_DROPBOX
 }
+func (o *Options) IsModeAuthDropboxAudit() bool {
+	return o.ModeAuth == MODE_AUTH_DROPBOX_AUDIT
+}
 func (o *Options) IsModeSyncUserProvision() bool {
 	modes := strings.Split(o.ModeSync, ",")
 	return util.ContainsString(modes, MODE_SYNC_USER_PROVISION)
@@ -74,10 +318,61 @@ func (o *Options) IsModeSyncUserDeprovision() bool {
 	modes := strings.Split(o.ModeSync, ",")
 	return util.ContainsString(modes, MODE_SYNC_USER_DEPROVISION)
 }
+func (o *Options) IsModeSyncUserSuspend() bool {
+	modes := strings.Split(o.ModeSync, ",")
+	return util.ContainsString(modes, MODE_SYNC_USER_SUSPEND)
+}
+func (o *Options) IsModeSyncUserUpdate() bool {
+	modes := strings.Split(o.ModeSync, ",")
+	return util.ContainsString(modes, MODE_SYNC_USER_UPDATE)
+}
 func (o *Options) IsModeGroupProvision() bool {
 	modes := strings.Split(o.ModeSync, ",")
 	return util.ContainsString(modes, MODE_SYNC_GROUP_PROVISION)
 }
+func (o *Options) IsModeGroupDeprovision() bool {
+	modes := strings.Split(o.ModeSync, ",")
+	return util.ContainsString(modes, MODE_SYNC_GROUP_DEPROVISION)
+}
+func (o *Options) SyncModes() []string {
+	return strings.Split(o.ModeSync, ",")
+}
+func (o *Options) PathPlan(createdAt time.Time) string {
+	return path.Join(o.BasePath, fmt.Sprintf(FILENAME_PLAN_FORMAT, createdAt.Format("20060102-150405")))
+}
+func (o *Options) PathDeprovisionState() string {
+	return path.Join(o.BasePath, FILENAME_DEPROVISION_STATE)
+}
+func (o *Options) PathCache() string {
+	return path.Join(o.BasePath, FILENAME_CACHE)
+}
+func (o *Options) PathCheckpoint() string {
+	return path.Join(o.BasePath, FILENAME_CHECKPOINT)
+}
+func (o *Options) PathDaemonStatus() string {
+	return path.Join(o.BasePath, FILENAME_DAEMON_STATUS)
+}
+func (o *Options) PathApiToken() string {
+	return path.Join(o.BasePath, FILENAME_API_TOKEN)
+}
+func (o *Options) PathReport(startedAt time.Time, ext string) string {
+	return path.Join(o.BasePath, FILENAME_REPORTS, fmt.Sprintf(FILENAME_REPORT_FORMAT, startedAt.Format("20060102-150405"), ext))
+}
+func (o *Options) PathReportHtml(startedAt time.Time) string {
+	return path.Join(o.BasePath, fmt.Sprintf(FILENAME_REPORT_HTML_FORMAT, startedAt.Format("20060102-150405")))
+}
+func (o *Options) PathSmtpPassword() string {
+	return path.Join(o.BasePath, FILENAME_SMTP_PASSWORD)
+}
+func (o *Options) PathWebhookSlack() string {
+	return path.Join(o.BasePath, FILENAME_WEBHOOK_SLACK)
+}
+func (o *Options) PathWebhookJson() string {
+	return path.Join(o.BasePath, FILENAME_WEBHOOK_JSON)
+}
+func (o *Options) PathAuditLog() string {
+	return path.Join(o.BasePath, FILENAME_AUDIT_LOG)
+}
 func (o *Options) PathGoogleToken() string {
 	return path.Join(o.BasePath, FILENAME_GOOGLE_TOKEN)
 }
@@ -88,6 +383,49 @@ func (o *Options) PathDropboxToken() string {
 	return path.Join(o.BasePath, FILENAME_DROPBOX_TOKEN)
 }
 
+// Split comma separated list. Empty items are ignored.
+func splitList(list string) []string {
+	items := make([]string, 0)
+	for _, x := range strings.Split(list, ",") {
+		if x = strings.TrimSpace(x); x != "" {
+			items = append(items, x)
+		}
+	}
+	return items
+}
+
+// Recipients of mail notification.
+func (o *Options) SmtpRecipients() []string {
+	return splitList(o.SmtpTo)
+}
+
+// Webhook URLs in the file, one URL per line. Webhook URLs are secrets, and
+// loaded from files instead of options. Returns empty if the file not exist.
+func webhookUrls(path string) ([]string, error) {
+	if !file.FileExist(path) {
+		return []string{}, nil
+	}
+	return text.ReadLinesIgnoreWhitespace(path)
+}
+
+// Slack incoming webhook URLs notified of run results.
+func (o *Options) WebhookSlackUrls() ([]string, error) {
+	return webhookUrls(o.PathWebhookSlack())
+}
+
+// Webhook URLs which receive run results in JSON.
+func (o *Options) WebhookJsonUrls() ([]string, error) {
+	return webhookUrls(o.PathWebhookJson())
+}
+
+// Schedule of daemon mode.
+func (o *Options) Schedule() (schedule.Schedule, error) {
+	if o.DaemonSchedule != "" {
+		return schedule.ParseCron(o.DaemonSchedule)
+	}
+	return &schedule.Interval{Interval: o.DaemonInterval}, nil
+}
+
 func (o *Options) Parse() error {
 	modeAuth := flag.String(optNameModeAuth, "", optDescModeAuth)
 	modeSync := flag.String(optNameModeSync, "", optDescModeSync)
@@ -95,6 +433,48 @@ func (o *Options) Parse() error {
 	proxy := flag.String(optNameProxy, "", optDescProxy)
 	dryRun := flag.Bool(optNameDryRun, true, optDescDryRun)
 	groupWhiteList := flag.String(optNameGroupWhiteList, "", optDescGroupWhiteList)
+	planOnly := flag.Bool(optNamePlanOnly, false, optDescPlanOnly)
+	applyPlan := flag.String(optNameApplyPlan, "", optDescApplyPlan)
+	limitUserRemove := flag.Int(optNameLimitUserRemove, DEFAULT_LIMIT_USER_REMOVE, optDescLimitUserRemove)
+	limitUserRemovePercent := flag.Int(optNameLimitUserRemovePercent, DEFAULT_LIMIT_USER_REMOVE_PERCENT, optDescLimitUserRemovePercent)
+	limitUserAdd := flag.Int(optNameLimitUserAdd, DEFAULT_LIMIT_USER_ADD, optDescLimitUserAdd)
+	limitUserAddPercent := flag.Int(optNameLimitUserAddPercent, DEFAULT_LIMIT_USER_ADD_PERCENT, optDescLimitUserAddPercent)
+	limitGroupMemberRemove := flag.Int(optNameLimitGroupMemberRemove, DEFAULT_LIMIT_GROUP_MEMBER_REMOVE, optDescLimitGroupMemberRemove)
+	limitGroupMemberRemovePercent := flag.Int(optNameLimitGroupMemberRemovePercent, DEFAULT_LIMIT_GROUP_MEMBER_REMOVE_PERCENT, optDescLimitGroupMemberRemovePercent)
+	limitGroupDelete := flag.Int(optNameLimitGroupDelete, DEFAULT_LIMIT_GROUP_DELETE, optDescLimitGroupDelete)
+	forceLargeChange := flag.Bool(optNameForceLargeChange, false, optDescForceLargeChange)
+	deprovisionPolicy := flag.String(optNameDeprovisionPolicy, DEPROVISION_POLICY_REMOVE, optDescDeprovisionPolicy)
+	deprovisionGraceDays := flag.Int(optNameDeprovisionGraceDays, DEFAULT_DEPROVISION_GRACE_DAYS, optDescDeprovisionGraceDays)
+	deprovisionWipeData := flag.Bool(optNameDeprovisionWipeData, false, optDescDeprovisionWipeData)
+	deprovisionTransferDest := flag.String(optNameDeprovisionTransferDest, "", optDescDeprovisionTransferDest)
+	deprovisionTransferAdmin := flag.String(optNameDeprovisionTransferAdmin, "", optDescDeprovisionTransferAdmin)
+	retryMaxAttempts := flag.Int(optNameRetryMaxAttempts, DEFAULT_RETRY_MAX_ATTEMPTS, optDescRetryMaxAttempts)
+	retryWait := flag.Duration(optNameRetryWait, DEFAULT_RETRY_WAIT, optDescRetryWait)
+	retryMaxWait := flag.Duration(optNameRetryMaxWait, DEFAULT_RETRY_MAX_WAIT, optDescRetryMaxWait)
+	retryJitterPercent := flag.Int(optNameRetryJitterPercent, DEFAULT_RETRY_JITTER_PERCENT, optDescRetryJitterPercent)
+	dropboxConcurrency := flag.Int(optNameDropboxConcurrency, DEFAULT_DROPBOX_CONCURRENCY, optDescDropboxConcurrency)
+	jobTimeout := flag.Duration(optNameJobTimeout, DEFAULT_JOB_TIMEOUT, optDescJobTimeout)
+	googleGroupMaxDepth := flag.Int(optNameGoogleGroupMaxDepth, DEFAULT_GOOGLE_GROUP_MAX_DEPTH, optDescGoogleGroupMaxDepth)
+	googleConcurrency := flag.Int(optNameGoogleConcurrency, DEFAULT_GOOGLE_CONCURRENCY, optDescGoogleConcurrency)
+	cacheTTL := flag.Duration(optNameCacheTTL, 0, optDescCacheTTL)
+	cacheRefresh := flag.Bool(optNameCacheRefresh, false, optDescCacheRefresh)
+	incremental := flag.Bool(optNameIncremental, false, optDescIncremental)
+	incrementalFullInterval := flag.Duration(optNameIncrementalFullInterval, DEFAULT_INCREMENTAL_FULL_INTERVAL, optDescIncrementalFullInterval)
+	daemon := flag.Bool(optNameDaemon, false, optDescDaemon)
+	daemonInterval := flag.Duration(optNameDaemonInterval, DEFAULT_DAEMON_INTERVAL, optDescDaemonInterval)
+	daemonSchedule := flag.String(optNameDaemonSchedule, "", optDescDaemonSchedule)
+	api := flag.Bool(optNameApi, false, optDescApi)
+	apiListen := flag.String(optNameApiListen, DEFAULT_API_LISTEN, optDescApiListen)
+	metricsListen := flag.String(optNameMetricsListen, "", optDescMetricsListen)
+	metricsTextfile := flag.String(optNameMetricsTextfile, "", optDescMetricsTextfile)
+	smtpHost := flag.String(optNameSmtpHost, "", optDescSmtpHost)
+	smtpPort := flag.Int(optNameSmtpPort, DEFAULT_SMTP_PORT, optDescSmtpPort)
+	smtpStartTLS := flag.Bool(optNameSmtpStartTLS, true, optDescSmtpStartTLS)
+	smtpUsername := flag.String(optNameSmtpUsername, "", optDescSmtpUsername)
+	smtpFrom := flag.String(optNameSmtpFrom, "", optDescSmtpFrom)
+	smtpTo := flag.String(optNameSmtpTo, "", optDescSmtpTo)
+	notifyOn := flag.String(optNameNotifyOn, NOTIFY_ON_FAILURE, optDescNotifyOn)
+	auditVerify := flag.Bool(optNameAuditVerify, false, optDescAuditVerify)
 
 	flag.Parse()
 
@@ -104,6 +484,48 @@ func (o *Options) Parse() error {
 	o.Proxy = *proxy
 	o.DryRun = *dryRun
 	o.GroupWhiteList = *groupWhiteList
+	o.PlanOnly = *planOnly
+	o.ApplyPlan = *applyPlan
+	o.LimitUserRemove = *limitUserRemove
+	o.LimitUserRemovePercent = *limitUserRemovePercent
+	o.LimitUserAdd = *limitUserAdd
+	o.LimitUserAddPercent = *limitUserAddPercent
+	o.LimitGroupMemberRemove = *limitGroupMemberRemove
+	o.LimitGroupMemberRemovePercent = *limitGroupMemberRemovePercent
+	o.LimitGroupDelete = *limitGroupDelete
+	o.ForceLargeChange = *forceLargeChange
+	o.DeprovisionPolicy = *deprovisionPolicy
+	o.DeprovisionGraceDays = *deprovisionGraceDays
+	o.DeprovisionWipeData = *deprovisionWipeData
+	o.DeprovisionTransferDest = *deprovisionTransferDest
+	o.DeprovisionTransferAdmin = *deprovisionTransferAdmin
+	o.RetryMaxAttempts = *retryMaxAttempts
+	o.RetryWait = *retryWait
+	o.RetryMaxWait = *retryMaxWait
+	o.RetryJitterPercent = *retryJitterPercent
+	o.DropboxConcurrency = *dropboxConcurrency
+	o.JobTimeout = *jobTimeout
+	o.GoogleGroupMaxDepth = *googleGroupMaxDepth
+	o.GoogleConcurrency = *googleConcurrency
+	o.CacheTTL = *cacheTTL
+	o.CacheRefresh = *cacheRefresh
+	o.Incremental = *incremental
+	o.IncrementalFullInterval = *incrementalFullInterval
+	o.Daemon = *daemon
+	o.DaemonInterval = *daemonInterval
+	o.DaemonSchedule = *daemonSchedule
+	o.Api = *api
+	o.ApiListen = *apiListen
+	o.MetricsListen = *metricsListen
+	o.MetricsTextfile = *metricsTextfile
+	o.SmtpHost = *smtpHost
+	o.SmtpPort = *smtpPort
+	o.SmtpStartTLS = *smtpStartTLS
+	o.SmtpUsername = *smtpUsername
+	o.SmtpFrom = *smtpFrom
+	o.SmtpTo = *smtpTo
+	o.NotifyOn = *notifyOn
+	o.AuditVerify = *auditVerify
 
 	return nil
 }
@@ -135,14 +557,131 @@ func (o *Options) Validate() error {
 			if !util.ContainsString(modeSyncOpts, x) {
 				return errors.New(fmt.Sprintf("Undefined option for `-%s`: %s", optNameModeSync, x))
 			}
-			if x == MODE_SYNC_GROUP_PROVISION && o.GroupWhiteList == "" {
-				return errors.New(fmt.Sprintf("Mode `%s` requires Google Group white list file", MODE_SYNC_GROUP_PROVISION))
+			requireWhiteList := x == MODE_SYNC_GROUP_PROVISION || x == MODE_SYNC_GROUP_DEPROVISION
+			if requireWhiteList && o.GroupWhiteList == "" {
+				return errors.New(fmt.Sprintf("Mode `%s` requires Google Group white list file", x))
 			}
-			if x == MODE_SYNC_GROUP_PROVISION && !file.FileExistAndReadable(o.GroupWhiteList) {
+			if requireWhiteList && !file.FileExistAndReadable(o.GroupWhiteList) {
 				return errors.New(fmt.Sprintf("Google Group white list file [%s] not exist", o.GroupWhiteList))
 			}
 		}
 	}
+	limits := map[string]int{
+		optNameLimitUserRemove:               o.LimitUserRemove,
+		optNameLimitUserRemovePercent:        o.LimitUserRemovePercent,
+		optNameLimitUserAdd:                  o.LimitUserAdd,
+		optNameLimitUserAddPercent:           o.LimitUserAddPercent,
+		optNameLimitGroupMemberRemove:        o.LimitGroupMemberRemove,
+		optNameLimitGroupMemberRemovePercent: o.LimitGroupMemberRemovePercent,
+		optNameLimitGroupDelete:              o.LimitGroupDelete,
+	}
+	for name, limit := range limits {
+		if limit < 0 {
+			return errors.New(fmt.Sprintf("`-%s` must be zero or positive number", name))
+		}
+	}
+	if !util.ContainsString(deprovisionPolicyOpts, o.DeprovisionPolicy) {
+		return errors.New(fmt.Sprintf("Undefined option for `-%s`: %s", optNameDeprovisionPolicy, o.DeprovisionPolicy))
+	}
+	if o.DeprovisionGraceDays < 0 {
+		return errors.New(fmt.Sprintf("`-%s` must be zero or positive number", optNameDeprovisionGraceDays))
+	}
+	if (o.DeprovisionTransferDest == "") != (o.DeprovisionTransferAdmin == "") {
+		return errors.New(fmt.Sprintf("`-%s` and `-%s` must be used together", optNameDeprovisionTransferDest, optNameDeprovisionTransferAdmin))
+	}
+	if o.RetryMaxAttempts < 1 {
+		return errors.New(fmt.Sprintf("`-%s` must be positive number", optNameRetryMaxAttempts))
+	}
+	if o.RetryWait < 0 || o.RetryMaxWait < 0 {
+		return errors.New(fmt.Sprintf("`-%s` and `-%s` must be zero or positive duration", optNameRetryWait, optNameRetryMaxWait))
+	}
+	if o.RetryJitterPercent < 0 || o.RetryJitterPercent > 100 {
+		return errors.New(fmt.Sprintf("`-%s` must be between 0 and 100", optNameRetryJitterPercent))
+	}
+	if o.DropboxConcurrency < 1 {
+		return errors.New(fmt.Sprintf("`-%s` must be positive number", optNameDropboxConcurrency))
+	}
+	if o.JobTimeout <= 0 {
+		return errors.New(fmt.Sprintf("`-%s` must be positive duration", optNameJobTimeout))
+	}
+	if o.GoogleGroupMaxDepth < 0 {
+		return errors.New(fmt.Sprintf("`-%s` must be zero or positive number", optNameGoogleGroupMaxDepth))
+	}
+	if o.GoogleConcurrency < 1 {
+		return errors.New(fmt.Sprintf("`-%s` must be positive number", optNameGoogleConcurrency))
+	}
+	if o.CacheTTL < 0 {
+		return errors.New(fmt.Sprintf("`-%s` must be zero or positive duration", optNameCacheTTL))
+	}
+	if o.Incremental && (o.PlanOnly || o.ApplyPlan != "") {
+		return errors.New(fmt.Sprintf("`-%s` cannot be used with `-%s` or `-%s`", optNameIncremental, optNamePlanOnly, optNameApplyPlan))
+	}
+	if o.Incremental && o.IncrementalFullInterval <= 0 {
+		return errors.New(fmt.Sprintf("`-%s` must be positive duration", optNameIncrementalFullInterval))
+	}
+	if o.Daemon {
+		if o.ModeSync == "" {
+			return errors.New(fmt.Sprintf("`-%s` requires `-%s`", optNameDaemon, optNameModeSync))
+		}
+		if o.ModeAuth != "" || o.PlanOnly || o.ApplyPlan != "" {
+			return errors.New(fmt.Sprintf("`-%s` cannot be used with `-%s`, `-%s` or `-%s`", optNameDaemon, optNameModeAuth, optNamePlanOnly, optNameApplyPlan))
+		}
+		if o.DaemonInterval <= 0 {
+			return errors.New(fmt.Sprintf("`-%s` must be positive duration", optNameDaemonInterval))
+		}
+		if _, err := o.Schedule(); err != nil {
+			return errors.New(fmt.Sprintf("Invalid `-%s`: %v", optNameDaemonSchedule, err))
+		}
+	}
+	if o.Api && !o.Daemon {
+		return errors.New(fmt.Sprintf("`-%s` requires `-%s`", optNameApi, optNameDaemon))
+	}
+	if o.Api && o.ApiListen == "" {
+		return errors.New(fmt.Sprintf("`-%s` required", optNameApiListen))
+	}
+	if o.MetricsListen != "" && !o.Daemon {
+		return errors.New(fmt.Sprintf("`-%s` requires `-%s`. Use `-%s` without daemon mode", optNameMetricsListen, optNameDaemon, optNameMetricsTextfile))
+	}
+	if o.SmtpHost != "" {
+		if o.SmtpFrom == "" || len(o.SmtpRecipients()) < 1 {
+			return errors.New(fmt.Sprintf("`-%s` requires `-%s` and `-%s`", optNameSmtpHost, optNameSmtpFrom, optNameSmtpTo))
+		}
+		if o.SmtpPort < 1 || o.SmtpPort > 65535 {
+			return errors.New(fmt.Sprintf("Invalid `-%s`: %d", optNameSmtpPort, o.SmtpPort))
+		}
+		if o.SmtpUsername != "" && !file.FileExistAndReadable(o.PathSmtpPassword()) {
+			return errors.New(fmt.Sprintf("`-%s` requires SMTP password file [%s]", optNameSmtpUsername, o.PathSmtpPassword()))
+		}
+	}
+	for _, path := range []string{o.PathWebhookSlack(), o.PathWebhookJson()} {
+		urls, err := webhookUrls(path)
+		if err != nil {
+			return errors.New(fmt.Sprintf("Unable to read webhook file [%s]: %v", path, err))
+		}
+		for i, x := range urls {
+			// URL is not shown, it contains secrets
+			if u, err := url.Parse(x); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New(fmt.Sprintf("Invalid URL in webhook file [%s]: entry %d", path, i+1))
+			}
+		}
+	}
+	if o.NotifyOn != "" && !util.ContainsString(notifyOnOpts, o.NotifyOn) {
+		return errors.New(fmt.Sprintf("Undefined option for `-%s`: %s", optNameNotifyOn, o.NotifyOn))
+	}
+	if o.AuditVerify && (o.ModeAuth != "" || o.ModeSync != "" || o.ApplyPlan != "" || o.Daemon) {
+		return errors.New(fmt.Sprintf("`-%s` cannot be used with other modes", optNameAuditVerify))
+	}
+	if o.PlanOnly && o.ModeSync == "" {
+		return errors.New(fmt.Sprintf("`-%s` requires `-%s`", optNamePlanOnly, optNameModeSync))
+	}
+	if o.ApplyPlan != "" {
+		if o.ModeSync != "" {
+			return errors.New(fmt.Sprintf("`-%s` cannot be used with `-%s`. Sync modes are loaded from the plan", optNameApplyPlan, optNameModeSync))
+		}
+		if !file.FileExistAndReadable(o.ApplyPlan) {
+			return errors.New(fmt.Sprintf("Plan file [%s] not exist", o.ApplyPlan))
+		}
+	}
 	return nil
 }
 
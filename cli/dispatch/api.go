@@ -0,0 +1,227 @@
+package dispatch
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/common/file"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	apiPathStatus = "/api/v1/status"
+	apiPathRuns   = "/api/v1/runs"
+
+	// Max size of request body
+	apiMaxRequestBytes = 1 << 20
+
+	// Timeouts of HTTP servers of the daemon, to release connections of slow or stalled clients
+	httpReadHeaderTimeout = 10 * time.Second
+	httpReadTimeout       = 30 * time.Second
+	httpWriteTimeout      = 60 * time.Second
+)
+
+// HTTP admin API of the daemon. Requests are authenticated by the bearer token.
+//
+//	GET  /api/v1/status            Status of the daemon and the current run
+//	GET  /api/v1/runs              Runs since the daemon started, latest first
+//	POST /api/v1/runs              Start a run (RunRequest). 409 if another run is in progress
+//	GET  /api/v1/runs/<id>         Status of the run
+//	GET  /api/v1/runs/<id>/plan    Plan of the run
+//	GET  /api/v1/runs/<id>/report  Report of the run
+type ApiServer struct {
+	daemon   *Daemon
+	token    string
+	listener net.Listener
+}
+
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// Returns the API token stored in the file. Creates new token if the file does
+// not exist.
+func loadApiToken(path string) (string, error) {
+	if file.FileExist(path) {
+		token, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(token)), nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(b)
+	if err := ioutil.WriteFile(path, []byte(token+"\n"), 0600); err != nil {
+		return "", err
+	}
+	seelog.Infof("API: New token created: file[%s]", path)
+	return token, nil
+}
+
+// HTTP server with timeouts. Bare http.Serve has no timeout.
+func newHttpServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Handler:           handler,
+		ReadHeaderTimeout: httpReadHeaderTimeout,
+		ReadTimeout:       httpReadTimeout,
+		WriteTimeout:      httpWriteTimeout,
+	}
+}
+
+func NewApiServer(daemon *Daemon, token string) *ApiServer {
+	return &ApiServer{
+		daemon: daemon,
+		token:  token,
+	}
+}
+
+// Start serving the API in background.
+func StartApiServer(daemon *Daemon, address, tokenPath string) (*ApiServer, error) {
+	token, err := loadApiToken(tokenPath)
+	if err != nil {
+		seelog.Errorf("API: Unable to load token: file[%s] err[%v]", tokenPath, err)
+		return nil, err
+	}
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		seelog.Errorf("API: Unable to listen: address[%s] err[%v]", address, err)
+		return nil, err
+	}
+	s := NewApiServer(daemon, token)
+	s.listener = listener
+	seelog.Infof("API: Listening on %s", listener.Addr())
+	go func() {
+		if err := newHttpServer(s).Serve(listener); err != nil {
+			seelog.Tracef("API: Server stopped: err[%v]", err)
+		}
+	}()
+	return s, nil
+}
+
+func (s *ApiServer) Close() error {
+	if s.listener == nil {
+		return nil
+	}
+	return s.listener.Close()
+}
+
+func (s *ApiServer) authorised(r *http.Request) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") || s.token == "" {
+		return false
+	}
+	token := strings.TrimPrefix(auth, "Bearer ")
+	return subtle.ConstantTimeCompare([]byte(token), []byte(s.token)) == 1
+}
+
+func writeJSON(w http.ResponseWriter, code int, data interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(data); err != nil {
+		seelog.Tracef("API: Unable to write response: err[%v]", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, message string) {
+	writeJSON(w, code, apiError{Error: message})
+}
+
+func (s *ApiServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	seelog.Tracef("API: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+	if !s.authorised(r) {
+		seelog.Warnf("API: Unauthorised request: %s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "Unauthorised")
+		return
+	}
+
+	path := strings.TrimSuffix(r.URL.Path, "/")
+	switch {
+	case path == apiPathStatus:
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		writeJSON(w, http.StatusOK, s.daemon.Status())
+
+	case path == apiPathRuns:
+		switch r.Method {
+		case "GET":
+			writeJSON(w, http.StatusOK, s.daemon.Runs())
+		case "POST":
+			s.startRun(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+		}
+
+	case strings.HasPrefix(path, apiPathRuns+"/"):
+		if r.Method != "GET" {
+			writeError(w, http.StatusMethodNotAllowed, "Method not allowed")
+			return
+		}
+		s.getRun(w, strings.Split(strings.TrimPrefix(path, apiPathRuns+"/"), "/"))
+
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
+
+func (s *ApiServer) startRun(w http.ResponseWriter, r *http.Request) {
+	req := RunRequest{}
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, apiMaxRequestBytes))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := json.Unmarshal(body, &req); err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid JSON: "+err.Error())
+		return
+	}
+	req.remoteAddr = r.RemoteAddr
+	status, err := s.daemon.Start(req)
+	switch {
+	case err == ErrRunInProgress:
+		writeError(w, http.StatusConflict, err.Error())
+	case err != nil:
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		seelog.Infof("API: Run requested: Id[%s] Modes[%s] DryRun[%t] Groups[%s] by %s", status.Id, strings.Join(status.Modes, ","), status.DryRun, strings.Join(status.Groups, ","), req.actor())
+		writeJSON(w, http.StatusAccepted, status)
+	}
+}
+
+func (s *ApiServer) getRun(w http.ResponseWriter, path []string) {
+	id := path[0]
+	status, found := s.daemon.FindRun(id)
+	if !found {
+		writeError(w, http.StatusNotFound, "Run not found")
+		return
+	}
+	switch {
+	case len(path) == 1:
+		writeJSON(w, http.StatusOK, status)
+	case len(path) == 2 && path[1] == "plan":
+		if p, found := s.daemon.RunPlan(id); found {
+			writeJSON(w, http.StatusOK, p)
+		} else {
+			writeError(w, http.StatusNotFound, "Plan not available")
+		}
+	case len(path) == 2 && path[1] == "report":
+		if report, found := s.daemon.RunReport(id); found {
+			writeJSON(w, http.StatusOK, report)
+		} else {
+			writeError(w, http.StatusNotFound, "Report not available")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Not found")
+	}
+}
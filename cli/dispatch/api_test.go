@@ -0,0 +1,124 @@
+package dispatch
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/watermint/dcfg/cli/explorer"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const testApiToken = "test-token"
+
+func apiRequest(t *testing.T, s *ApiServer, method, path, token string, body interface{}, result interface{}) int {
+	var buf bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&buf).Encode(body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	req, err := http.NewRequest(method, path, &buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if result != nil {
+		if err := json.Unmarshal(rec.Body.Bytes(), result); err != nil {
+			t.Errorf("Unable to parse response: %s %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func TestApiServer_Auth(t *testing.T) {
+	d, cleanup := newDaemonForTest(t)
+	defer cleanup()
+	s := NewApiServer(d, testApiToken)
+
+	if code := apiRequest(t, s, "GET", apiPathStatus, "", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status: %d", code)
+	}
+	if code := apiRequest(t, s, "GET", apiPathStatus, "wrong-token", nil, nil); code != http.StatusUnauthorized {
+		t.Errorf("Unexpected status: %d", code)
+	}
+	status := DaemonStatus{}
+	if code := apiRequest(t, s, "GET", apiPathStatus, testApiToken, nil, &status); code != http.StatusOK || status.Schedule == "" {
+		t.Errorf("Unexpected status: %d %v", code, status)
+	}
+}
+
+func TestApiServer_Runs(t *testing.T) {
+	d, cleanup := newDaemonForTest(t)
+	defer cleanup()
+	s := NewApiServer(d, testApiToken)
+
+	invalid := []RunRequest{
+		{},
+		{Modes: []string{"no-such-mode"}},
+		{Modes: []string{"user-provision"}, Groups: []string{"g1@example.com"}},
+	}
+	for _, x := range invalid {
+		if code := apiRequest(t, s, "POST", apiPathRuns, testApiToken, x, nil); code != http.StatusBadRequest {
+			t.Errorf("Unexpected status: %d %v", code, x)
+		}
+	}
+
+	// Run fails on initialisation, because tokens are not available
+	started := RunStatus{}
+	code := apiRequest(t, s, "POST", apiPathRuns, testApiToken, RunRequest{Modes: []string{"user-provision"}}, &started)
+	if code != http.StatusAccepted || started.Id == "" || !started.DryRun || started.Trigger != RUN_TRIGGER_API {
+		t.Fatalf("Unexpected response: %d %v", code, started)
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		run := RunStatus{}
+		if code := apiRequest(t, s, "GET", apiPathRuns+"/"+started.Id, testApiToken, nil, &run); code != http.StatusOK {
+			t.Fatalf("Unexpected status: %d", code)
+		}
+		if !run.Running {
+			if run.ExitCode != EXIT_CODE_FAILURE {
+				t.Errorf("Unexpected run: %v", run)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Run not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	runs := make([]RunStatus, 0)
+	if code := apiRequest(t, s, "GET", apiPathRuns, testApiToken, nil, &runs); code != http.StatusOK || len(runs) != 1 {
+		t.Errorf("Unexpected runs: %d %v", code, runs)
+	}
+	report := explorer.RunReport{}
+	if code := apiRequest(t, s, "GET", apiPathRuns+"/"+started.Id+"/report", testApiToken, nil, &report); code != http.StatusOK {
+		t.Errorf("Unexpected status: %d", code)
+	}
+	if code := apiRequest(t, s, "GET", apiPathRuns+"/"+started.Id+"/plan", testApiToken, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Plan should not be available: %d", code)
+	}
+	if code := apiRequest(t, s, "GET", apiPathRuns+"/no-such-run", testApiToken, nil, nil); code != http.StatusNotFound {
+		t.Errorf("Unexpected status: %d", code)
+	}
+}
+
+func TestApiServer_RunInProgress(t *testing.T) {
+	d, cleanup := newDaemonForTest(t)
+	defer cleanup()
+	s := NewApiServer(d, testApiToken)
+
+	if _, err := d.beginRun(RUN_TRIGGER_SCHEDULE, d.context); err != nil {
+		t.Fatal(err)
+	}
+	if code := apiRequest(t, s, "POST", apiPathRuns, testApiToken, RunRequest{Modes: []string{"user-provision"}}, nil); code != http.StatusConflict {
+		t.Errorf("Unexpected status: %d", code)
+	}
+}
@@ -0,0 +1,54 @@
+package dispatch
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/common/audit"
+	"github.com/watermint/dcfg/common/file"
+	"github.com/watermint/dcfg/integration/context"
+)
+
+const (
+	RUN_TRIGGER_CLI = "cli"
+)
+
+// Set trigger of the run for the audit log. Actor defaults to the OS user.
+func withTrigger(ctx context.ExecutionContext, runId, trigger, actor string) context.ExecutionContext {
+	if actor == "" {
+		actor = context.DefaultActor()
+	}
+	ctx.Trigger = context.RunTrigger{
+		RunId:   runId,
+		Trigger: trigger,
+		Actor:   actor,
+	}
+	return ctx
+}
+
+// Open the audit log for the apply. Changes must not be executed without the
+// audit log.
+func openAuditLog(ctx context.ExecutionContext) (*audit.Log, error) {
+	path := ctx.Options.PathAuditLog()
+	log, err := audit.Open(path)
+	if err != nil {
+		seelog.Errorf("Unable to open audit log: file[%s] err[%v]", path, err)
+		return nil, newDispatchError(EXIT_CODE_FAILURE, err, "Ensure file [%s] is writable, and not modified", path)
+	}
+	return log, nil
+}
+
+func DispatchAuditVerify(context context.ExecutionContext) error {
+	path := context.Options.PathAuditLog()
+	if !file.FileExist(path) {
+		explorer.ReportSuccess("Audit log not found: %s", path)
+		return nil
+	}
+	n, err := audit.Verify(path)
+	if err != nil {
+		seelog.Errorf("Audit log verification failed: file[%s] verified[%d] err[%v]", path, n, err)
+		explorer.ReportFailure("Audit log verification failed after %d entries: %v", n, err)
+		return newDispatchError(EXIT_CODE_FAILURE, err, "Audit log [%s] may be modified. Please investigate the file", path)
+	}
+	explorer.ReportSuccess("Audit log verified: %d entries", n)
+	return nil
+}
@@ -0,0 +1,462 @@
+package dispatch
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/common/file"
+	"github.com/watermint/dcfg/common/schedule"
+	"github.com/watermint/dcfg/integration/context"
+	"github.com/watermint/dcfg/sync/plan"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	RUN_TRIGGER_SCHEDULE = "schedule"
+	RUN_TRIGGER_API      = "api"
+
+	// Number of runs kept in memory for the admin API
+	daemonRunHistory = 50
+)
+
+var (
+	ErrRunInProgress = errors.New("Another run is in progress")
+)
+
+// Status of a run on daemon mode.
+type RunStatus struct {
+	Id         string    `json:"id"`
+	Trigger    string    `json:"trigger"`
+	Modes      []string  `json:"modes"`
+	DryRun     bool      `json:"dry_run"`
+	Groups     []string  `json:"groups,omitempty"`
+	Running    bool      `json:"running"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	ExitCode   int       `json:"exit_code"`
+	Error      string    `json:"error,omitempty"`
+
+	// Number of reported successes and failures
+	Success int `json:"success"`
+	Failure int `json:"failure"`
+}
+
+// Request of a run, e.g. from the admin API. Dry run by default.
+type RunRequest struct {
+	Modes  []string `json:"modes"`
+	DryRun *bool    `json:"dry_run,omitempty"`
+
+	// Limit group-provision to these groups of the white list
+	Groups []string `json:"groups,omitempty"`
+
+	// Who requested the run, recorded into the audit log
+	RequestedBy string `json:"requested_by,omitempty"`
+
+	// Address of the client, set by the admin API
+	remoteAddr string
+}
+
+// Status of the daemon. Persisted into the daemon status file on every change.
+type DaemonStatus struct {
+	Schedule   string     `json:"schedule"`
+	Running    bool       `json:"running"`
+	NextRunAt  time.Time  `json:"next_run_at"`
+	CurrentRun *RunStatus `json:"current_run,omitempty"`
+	LastRun    *RunStatus `json:"last_run,omitempty"`
+}
+
+type runRecord struct {
+	status RunStatus
+	plan   *plan.Plan
+	report *explorer.RunReport
+
+	// Closed when the run finished
+	done chan struct{}
+}
+
+// Runs sync on the schedule until stopped. The execution context is shared by
+// runs, but Dropbox and Google clients are re-created for each run to pick up
+// updated tokens. Only one run is executed at a time.
+type Daemon struct {
+	context  context.ExecutionContext
+	schedule schedule.Schedule
+
+	stop     chan struct{}
+	stopOnce sync.Once
+
+	// Status and history of runs. Guarded by statusMutex.
+	status      DaemonStatus
+	current     *runRecord
+	runs        []*runRecord
+	runSequence int
+	statusMutex sync.Mutex
+}
+
+func NewDaemon(context context.ExecutionContext) (*Daemon, error) {
+	s, err := context.Options.Schedule()
+	if err != nil {
+		return nil, err
+	}
+	d := &Daemon{
+		context:  context,
+		schedule: s,
+		stop:     make(chan struct{}),
+		runs:     make([]*runRecord, 0),
+	}
+	d.status.Schedule = s.String()
+
+	// Keep the last run of the previous process
+	path := context.Options.PathDaemonStatus()
+	if file.FileExist(path) {
+		previous := DaemonStatus{}
+		if _, err := file.LoadJSON(path, &previous); err != nil {
+			seelog.Warnf("Daemon: Unable to load daemon status file: file[%s] err[%v]", path, err)
+		} else {
+			d.status.LastRun = previous.LastRun
+		}
+	}
+	return d, nil
+}
+
+// Returns copy of the current status.
+func (d *Daemon) Status() DaemonStatus {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	s := d.status
+	if s.CurrentRun != nil {
+		currentRun := *s.CurrentRun
+		s.CurrentRun = &currentRun
+	}
+	if s.LastRun != nil {
+		lastRun := *s.LastRun
+		s.LastRun = &lastRun
+	}
+	return s
+}
+
+// Status of runs since the daemon started, latest first.
+func (d *Daemon) Runs() []RunStatus {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	runs := make([]RunStatus, 0, len(d.runs))
+	for i := len(d.runs) - 1; i >= 0; i-- {
+		runs = append(runs, d.runs[i].status)
+	}
+	return runs
+}
+
+func (d *Daemon) findRun(id string) (*runRecord, bool) {
+	for _, r := range d.runs {
+		if r.status.Id == id {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (d *Daemon) FindRun(id string) (RunStatus, bool) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	r, found := d.findRun(id)
+	if !found {
+		return RunStatus{}, false
+	}
+	return r.status, true
+}
+
+// Plan of the run. Returns false if the run is not found, or no plan created.
+func (d *Daemon) RunPlan(id string) (*plan.Plan, bool) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	r, found := d.findRun(id)
+	if !found || r.plan == nil {
+		return nil, false
+	}
+	return r.plan, true
+}
+
+// Report of the run. Returns false if the run is not found or not finished.
+func (d *Daemon) RunReport(id string) (*explorer.RunReport, bool) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	r, found := d.findRun(id)
+	if !found || r.report == nil {
+		return nil, false
+	}
+	return r.report, true
+}
+
+// Caller must hold statusMutex.
+func (d *Daemon) saveStatus() {
+	path := d.context.Options.PathDaemonStatus()
+	if err := file.SaveJSON(path, d.status); err != nil {
+		seelog.Warnf("Daemon: Unable to write daemon status file: file[%s] err[%v]", path, err)
+	}
+}
+
+func (d *Daemon) updateStatus(update func(s *DaemonStatus)) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	update(&d.status)
+	d.saveStatus()
+}
+
+// Request the daemon to stop. The running sync stops before the next operation.
+func (d *Daemon) Stop() {
+	d.stopOnce.Do(func() {
+		close(d.stop)
+	})
+}
+
+func (d *Daemon) isStopped() bool {
+	select {
+	case <-d.stop:
+		return true
+	default:
+		return false
+	}
+}
+
+// Actor of the request for the audit log. e.g. `alice (192.0.2.1:50000)`.
+func (req RunRequest) actor() string {
+	requestedBy := req.RequestedBy
+	if requestedBy == "" {
+		requestedBy = "anonymous"
+	}
+	if req.remoteAddr == "" {
+		return requestedBy
+	}
+	return fmt.Sprintf("%s (%s)", requestedBy, req.remoteAddr)
+}
+
+// Execution context of the request. Returns error if the request is not valid.
+func (d *Daemon) requestContext(req RunRequest) (context.ExecutionContext, error) {
+	ctx := d.context
+	if len(req.Modes) < 1 {
+		return ctx, errors.New("Sync modes required")
+	}
+	ctx.Options.ModeSync = strings.Join(req.Modes, ",")
+	ctx.Options.DryRun = req.DryRun == nil || *req.DryRun
+
+	// Runs on request do not update the checkpoint of scheduled runs
+	ctx.Options.Incremental = false
+
+	ctx.Trigger.Actor = req.actor()
+
+	if err := ctx.Options.Validate(); err != nil {
+		return ctx, err
+	}
+	if len(req.Groups) > 0 {
+		if !ctx.Options.IsModeGroupProvision() {
+			return ctx, errors.New(fmt.Sprintf("Groups can be specified only for mode `%s`", cli.MODE_SYNC_GROUP_PROVISION))
+		}
+		ctx.SyncGroups = req.Groups
+		if _, err := loadWhiteList(ctx); err != nil {
+			return ctx, err
+		}
+	}
+	return ctx, nil
+}
+
+// Reserve the run. Returns ErrRunInProgress if another run is in progress.
+func (d *Daemon) beginRun(trigger string, ctx context.ExecutionContext) (*runRecord, error) {
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	if d.current != nil {
+		return nil, ErrRunInProgress
+	}
+	d.runSequence++
+	startedAt := time.Now().UTC()
+	r := &runRecord{
+		status: RunStatus{
+			Id:        fmt.Sprintf("%s-%d", startedAt.Format("20060102-150405"), d.runSequence),
+			Trigger:   trigger,
+			Modes:     ctx.Options.SyncModes(),
+			DryRun:    ctx.Options.DryRun,
+			Groups:    ctx.SyncGroups,
+			Running:   true,
+			StartedAt: startedAt,
+		},
+		done: make(chan struct{}),
+	}
+	d.current = r
+	d.runs = append(d.runs, r)
+	if len(d.runs) > daemonRunHistory {
+		d.runs = d.runs[len(d.runs)-daemonRunHistory:]
+	}
+	d.status.Running = true
+	d.status.CurrentRun = &r.status
+	d.saveStatus()
+	return r, nil
+}
+
+// Execute the reserved run. The report is reset for each run.
+func (d *Daemon) executeRun(r *runRecord, ctx context.ExecutionContext) {
+	explorer.ResetReport(ctx.Options.DryRun)
+	seelog.Infof("Daemon: Run started: Id[%s] Trigger[%s] Modes[%s] DryRun[%t]", r.status.Id, r.status.Trigger, ctx.Options.ModeSync, ctx.Options.DryRun)
+
+	ctx.Stop = d.stop
+	ctx = withTrigger(ctx, r.status.Id, r.status.Trigger, ctx.Trigger.Actor)
+	p, err := runSync(ctx)
+	explorer.Report()
+	exitCode := ExitCode(err)
+	observeRun(ctx, r.status.StartedAt, exitCode)
+	report := writeReport(ctx, r.status.StartedAt, exitCode)
+	notifyRun(ctx, report)
+	success, failure := explorer.ReportCount()
+
+	defer close(r.done)
+	d.statusMutex.Lock()
+	defer d.statusMutex.Unlock()
+	r.plan = p
+	r.report = report
+	r.status.Running = false
+	r.status.FinishedAt = time.Now().UTC()
+	r.status.ExitCode = exitCode
+	if err != nil {
+		r.status.Error = err.Error()
+	}
+	r.status.Success = success
+	r.status.Failure = failure
+	seelog.Infof("Daemon: Run finished: Id[%s] ExitCode[%d] Success[%d] Failure[%d] Elapsed[%s]", r.status.Id, r.status.ExitCode, r.status.Success, r.status.Failure, r.status.FinishedAt.Sub(r.status.StartedAt))
+
+	lastRun := r.status
+	d.current = nil
+	d.status.Running = false
+	d.status.CurrentRun = nil
+	d.status.LastRun = &lastRun
+	d.saveStatus()
+	seelog.Flush()
+}
+
+// Run sync once with configured options. Returns ErrRunInProgress if another run
+// is in progress.
+func (d *Daemon) RunOnce() (RunStatus, error) {
+	r, err := d.beginRun(RUN_TRIGGER_SCHEDULE, d.context)
+	if err != nil {
+		return RunStatus{}, err
+	}
+	d.executeRun(r, d.context)
+	return r.status, nil
+}
+
+// Start sync in background on the request. Returns error if the request is not
+// valid, or another run is in progress.
+func (d *Daemon) Start(req RunRequest) (RunStatus, error) {
+	if d.isStopped() {
+		return RunStatus{}, errors.New("Daemon is stopping")
+	}
+	ctx, err := d.requestContext(req)
+	if err != nil {
+		return RunStatus{}, err
+	}
+	r, err := d.beginRun(RUN_TRIGGER_API, ctx)
+	if err != nil {
+		return RunStatus{}, err
+	}
+	status := r.status
+	go d.executeRun(r, ctx)
+	return status, nil
+}
+
+// Run sync on the schedule until Stop. Runs with interval start immediately,
+// and runs with cron expression start on the next scheduled time.
+func (d *Daemon) Run() int {
+	seelog.Infof("Daemon: Started: Schedule[%s]", d.status.Schedule)
+	next := time.Now()
+	if _, ok := d.schedule.(*schedule.Interval); !ok {
+		next = d.schedule.Next(next)
+	}
+	for {
+		if next.IsZero() {
+			seelog.Errorf("Daemon: No scheduled run: Schedule[%s]", d.status.Schedule)
+			return EXIT_CODE_FAILURE
+		}
+		d.updateStatus(func(s *DaemonStatus) {
+			s.NextRunAt = next
+		})
+		seelog.Infof("Daemon: Next run at %s", next.Format(time.RFC3339))
+
+		timer := time.NewTimer(next.Sub(time.Now()))
+		select {
+		case <-d.stop:
+			timer.Stop()
+			d.waitCurrentRun()
+			seelog.Infof("Daemon: Stopped")
+			return EXIT_CODE_SUCCESS
+		case <-timer.C:
+		}
+
+		if _, err := d.RunOnce(); err == ErrRunInProgress {
+			seelog.Warnf("Daemon: Scheduled run skipped: %v", err)
+		}
+		if d.isStopped() {
+			d.waitCurrentRun()
+			seelog.Infof("Daemon: Stopped")
+			return EXIT_CODE_SUCCESS
+		}
+		next = d.schedule.Next(time.Now())
+	}
+}
+
+// Wait for the run started by Start.
+func (d *Daemon) waitCurrentRun() {
+	for {
+		d.statusMutex.Lock()
+		current := d.current
+		d.statusMutex.Unlock()
+		if current == nil {
+			return
+		}
+		<-current.done
+	}
+}
+
+// Run the daemon until SIGTERM or interrupt. The running sync stops before the
+// next operation on the first signal, and the process exits immediately on the
+// second signal.
+func DispatchDaemon(context context.ExecutionContext) int {
+	d, err := NewDaemon(context)
+	if err != nil {
+		return ExitCode(newDispatchError(EXIT_CODE_FAILURE, err, "Please review `-daemon-schedule`"))
+	}
+	registerFatalNotification(context)
+
+	if context.Options.Api {
+		server, err := StartApiServer(d, context.Options.ApiListen, context.Options.PathApiToken())
+		if err != nil {
+			return ExitCode(newDispatchError(EXIT_CODE_FAILURE, err, "Ensure the address [%s] is available, and directory [%s] is writable", context.Options.ApiListen, context.Options.BasePath))
+		}
+		defer server.Close()
+	}
+
+	if context.Options.MetricsListen != "" {
+		listener, err := startMetricsServer(context.Options.MetricsListen)
+		if err != nil {
+			return ExitCode(newDispatchError(EXIT_CODE_FAILURE, err, "Ensure the address [%s] is available", context.Options.MetricsListen))
+		}
+		defer listener.Close()
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	defer signal.Stop(signals)
+	go func() {
+		sig := <-signals
+		seelog.Infof("Daemon: Received signal [%s], stopping", sig)
+		d.Stop()
+		sig = <-signals
+		seelog.Errorf("Daemon: Received signal [%s] again, exit immediately", sig)
+		seelog.Flush()
+		os.Exit(EXIT_CODE_FAILURE)
+	}()
+
+	return d.Run()
+}
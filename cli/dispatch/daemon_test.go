@@ -0,0 +1,148 @@
+package dispatch
+
+import (
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/common/file"
+	"github.com/watermint/dcfg/integration/context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func newDaemonForTest(t *testing.T) (*Daemon, func()) {
+	dir, err := ioutil.TempDir("", "dcfg-daemon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tokens are not available, runs fail on initialisation
+	ctx := context.ExecutionContext{
+		Options: cli.Options{
+			BasePath:       dir,
+			ModeSync:       cli.MODE_SYNC_USER_PROVISION,
+			DryRun:         true,
+			Daemon:         true,
+			DaemonInterval: 1 * time.Hour,
+
+			DeprovisionPolicy:  cli.DEPROVISION_POLICY_REMOVE,
+			RetryMaxAttempts:   cli.DEFAULT_RETRY_MAX_ATTEMPTS,
+			DropboxConcurrency: cli.DEFAULT_DROPBOX_CONCURRENCY,
+			JobTimeout:         cli.DEFAULT_JOB_TIMEOUT,
+			GoogleConcurrency:  cli.DEFAULT_GOOGLE_CONCURRENCY,
+		},
+	}
+	d, err := NewDaemon(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, func() {
+		os.RemoveAll(dir)
+	}
+}
+
+func TestDaemon_RunOnce(t *testing.T) {
+	d, cleanup := newDaemonForTest(t)
+	defer cleanup()
+
+	run, err := d.RunOnce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if run.ExitCode != EXIT_CODE_FAILURE || run.Error == "" || run.Failure != 0 {
+		t.Errorf("Unexpected run status: %v", run)
+	}
+	status := d.Status()
+	if status.Running || status.LastRun == nil || status.LastRun.ExitCode != EXIT_CODE_FAILURE || status.LastRun.Trigger != RUN_TRIGGER_SCHEDULE {
+		t.Errorf("Unexpected daemon status: %v", status)
+	}
+	report, found := d.RunReport(run.Id)
+	if !found || report.ExitCode != EXIT_CODE_FAILURE || !report.DryRun {
+		t.Errorf("Unexpected run report: %v", report)
+	}
+	for _, ext := range []string{reportExtJSON, reportExtCSV} {
+		if path := d.context.Options.PathReport(run.StartedAt, ext); !file.FileExist(path) {
+			t.Errorf("Report file not found: %s", path)
+		}
+	}
+	if path := d.context.Options.PathReportHtml(run.StartedAt); !file.FileExist(path) {
+		t.Errorf("Report file not found: %s", path)
+	}
+
+	// Last run is kept over restart
+	saved := DaemonStatus{}
+	if _, err := file.LoadJSON(d.context.Options.PathDaemonStatus(), &saved); err != nil || saved.LastRun == nil {
+		t.Errorf("Unexpected daemon status file: %v %v", saved, err)
+	}
+	restarted, err := NewDaemon(d.context)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := restarted.Status(); s.LastRun == nil || !s.LastRun.StartedAt.Equal(run.StartedAt) {
+		t.Errorf("Last run should be loaded: %v", s)
+	}
+}
+
+func TestDaemon_RunAndStop(t *testing.T) {
+	d, cleanup := newDaemonForTest(t)
+	defer cleanup()
+
+	result := make(chan int)
+	go func() {
+		result <- d.Run()
+	}()
+
+	// The first run starts immediately on interval
+	deadline := time.Now().Add(10 * time.Second)
+	for d.Status().LastRun == nil || d.Status().NextRunAt.Before(time.Now()) {
+		if time.Now().After(deadline) {
+			t.Fatal("Run not finished")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	d.Stop()
+	d.Stop()
+
+	select {
+	case code := <-result:
+		if code != EXIT_CODE_SUCCESS {
+			t.Errorf("Unexpected exit code: %d", code)
+		}
+	case <-time.After(10 * time.Second):
+		t.Error("Daemon not stopped")
+	}
+}
+
+func TestDaemon_RequestContext(t *testing.T) {
+	d, cleanup := newDaemonForTest(t)
+	defer cleanup()
+
+	whiteList := path.Join(d.context.Options.BasePath, "white_list.txt")
+	if err := ioutil.WriteFile(whiteList, []byte("G1@example.com\ng2@example.com\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	d.context.Options.GroupWhiteList = whiteList
+	d.context.Options.Incremental = true
+
+	dryRun := false
+	ctx, err := d.requestContext(RunRequest{Modes: []string{cli.MODE_SYNC_GROUP_PROVISION}, DryRun: &dryRun, Groups: []string{"g1@example.com"}, RequestedBy: "alice", remoteAddr: "192.0.2.1:50000"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Trigger.Actor != "alice (192.0.2.1:50000)" {
+		t.Errorf("Unexpected actor: %s", ctx.Trigger.Actor)
+	}
+	if ctx.Options.DryRun || ctx.Options.Incremental || ctx.Options.ModeSync != cli.MODE_SYNC_GROUP_PROVISION {
+		t.Errorf("Unexpected options: %v", ctx.Options)
+	}
+	if w, err := loadWhiteList(ctx); err != nil || len(w) != 1 || w[0] != "G1@example.com" {
+		t.Errorf("Unexpected white list: %v %v", w, err)
+	}
+
+	if _, err := d.requestContext(RunRequest{Modes: []string{cli.MODE_SYNC_GROUP_PROVISION}, Groups: []string{"g3@example.com"}}); err == nil {
+		t.Error("Group not in the white list should be rejected")
+	}
+	if _, err := d.requestContext(RunRequest{Modes: []string{cli.MODE_SYNC_GROUP_PROVISION, cli.MODE_SYNC_GROUP_DEPROVISION}, Groups: []string{"g1@example.com"}}); err == nil {
+		t.Error("Group deprovision should not be limited to groups")
+	}
+}
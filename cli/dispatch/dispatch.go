@@ -1,61 +1,474 @@
 package dispatch
 
 import (
+	"errors"
+	"fmt"
 	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli"
 	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/common/metrics"
 	"github.com/watermint/dcfg/integration/auth"
+	"github.com/watermint/dcfg/integration/connector"
 	"github.com/watermint/dcfg/integration/context"
 	"github.com/watermint/dcfg/sync/groupsync"
+	"github.com/watermint/dcfg/sync/incremental"
+	"github.com/watermint/dcfg/sync/plan"
 	"github.com/watermint/dcfg/sync/usersync"
+	"strings"
+	"time"
 )
 
-func DispatchAuth(context context.ExecutionContext) {
+func DispatchAuth(context context.ExecutionContext) error {
 	switch {
 	case context.Options.IsModeAuthGoogle():
 		if err := context.InitGoogleAuth(); err != nil {
 			seelog.Errorf("Initialisation failure: %v", err)
-			explorer.FatalShutdown("Please review file content of: %s", context.Options.PathGoogleClientSecret())
+			return newDispatchError(EXIT_CODE_FAILURE, err, "Please review file content of: %s", context.Options.PathGoogleClientSecret())
 		}
 		seelog.Trace("Start Auth Sequence: Google")
 		auth.AuthGoogle(context)
 	case context.Options.IsModeAuthDropbox():
 		seelog.Trace("Start Auth Sequence: Dropbox")
 		auth.AuthDropbox(context)
+	case context.Options.IsModeAuthDropboxAudit():
+		seelog.Trace("Start Auth Sequence: Dropbox (Team auditing)")
+		auth.AuthDropboxAudit(context)
 	}
+	return nil
 }
 
-func DispatchSync(context context.ExecutionContext) {
-	if err := context.InitForSync(); err != nil {
-		seelog.Errorf("Initialisation failure: %v", err)
-		explorer.FatalShutdown("Please review configuration")
+// Create plan for sync modes. Modes are planned in order of execution, and
+// later modes see the Dropbox directory as modified by earlier modes. Users
+// and groups are limited to the scope. Planning updates the deprovision state,
+// pass a copy which is saved only if the plan is applied.
+func createPlan(context context.ExecutionContext, groupWhiteList []string, state *usersync.DeprovisionState, scope *incremental.Scope) (*plan.Plan, error) {
+	p := plan.NewPlan(context.Options.SyncModes(), groupWhiteList)
+	recorder := plan.NewRecorder(p)
+
+	// Operations and reports are recorded with the sync mode
+	beginMode := func(mode string) {
+		recorder.Mode = mode
+		explorer.SetReportMode(mode)
 	}
+	defer explorer.SetReportMode("")
+
+	newUserSync := func() (usersync.UserSync, error) {
+		userSync, err := usersync.NewUserSync(context)
+		if err != nil {
+			return userSync, directoryError(err)
+		}
+		p.TeamSize = len(userSync.DropboxAccounts.Accounts())
+		metrics.SetDirectorySize(metrics.DIRECTORY_DROPBOX_MEMBERS, p.TeamSize)
+		metrics.SetDirectorySize(metrics.DIRECTORY_GOOGLE_USERS, len(userSync.GoogleAccounts.Accounts()))
+		userSync.DropboxConnector = recorder
+		userSync.DropboxAccounts = plan.NewDirectoryOverlay(p, scope.AccountDirectory(userSync.DropboxAccounts), nil).AccountDirectory()
+		userSync.GoogleAccounts = scope.AccountDirectory(userSync.GoogleAccounts)
+		return userSync, nil
+	}
+	newGroupSync := func() (groupsync.GroupSync, error) {
+		groupSync, err := groupsync.NewGroupSync(context)
+		if err != nil {
+			return groupSync, directoryError(err)
+		}
+		p.TeamSize = len(groupSync.DropboxAccountDirectory.Accounts())
+		metrics.SetDirectorySize(metrics.DIRECTORY_DROPBOX_MEMBERS, p.TeamSize)
+		metrics.SetDirectorySize(metrics.DIRECTORY_DROPBOX_GROUPS, len(groupSync.DropboxGroupDirectory.Groups()))
+		metrics.SetDirectorySize(metrics.DIRECTORY_GOOGLE_GROUPS, len(groupWhiteList))
+		overlay := plan.NewDirectoryOverlay(p, groupSync.DropboxAccountDirectory, scope.GroupDirectory(groupSync.DropboxGroupDirectory))
+		groupSync.DropboxConnector = recorder
+		groupSync.DropboxAccountDirectory = overlay.AccountDirectory()
+		groupSync.DropboxGroupDirectory = overlay.GroupDirectory()
+		groupSync.GoogleDirectory = scope.GroupResolver(groupSync.GoogleDirectory)
+		return groupSync, nil
+	}
+	scopedWhiteList := func(groupSync groupsync.GroupSync) ([]string, bool) {
+		whiteList := scope.WhiteList(groupWhiteList, groupSync.DropboxGroupDirectory)
+		if len(whiteList) < 1 && !scope.IsFull() {
+			seelog.Infof("No change in Google Groups of the white list")
+			return nil, false
+		}
+		return whiteList, true
+	}
+
 	if context.Options.IsModeSyncUserProvision() {
+		beginMode(cli.MODE_SYNC_USER_PROVISION)
 		seelog.Trace("Start Sync: User Provision")
 		seelog.Infof("Provisioning Users (Google Users -> Dropbox Users)")
-		userSync := usersync.NewUserSync(context)
+		userSync, err := newUserSync()
+		if err != nil {
+			return nil, err
+		}
 		userSync.SyncProvision()
 	}
 	if context.Options.IsModeSyncUserDeprovision() {
+		beginMode(cli.MODE_SYNC_USER_DEPROVISION)
 		seelog.Trace("Start Sync: User Deprovision")
 		seelog.Infof("Deprovisioning Users (Google Users -> Dropbox Users)")
-		userSync := usersync.NewUserSync(context)
-		userSync.SyncDeprovision()
+		userSync, err := newUserSync()
+		if err != nil {
+			return nil, err
+		}
+		userSync.DeprovisionState = state
+		if err := userSync.SyncDeprovision(); err != nil {
+			return nil, directoryError(err)
+		}
+	}
+	if context.Options.IsModeSyncUserSuspend() {
+		beginMode(cli.MODE_SYNC_USER_SUSPEND)
+		seelog.Trace("Start Sync: User Suspend")
+		seelog.Infof("Syncing User Suspension (Google Users -> Dropbox Users)")
+		userSync, err := newUserSync()
+		if err != nil {
+			return nil, err
+		}
+		userSync.DeprovisionState = state
+		userSync.SyncSuspend()
+	}
+	if context.Options.IsModeSyncUserUpdate() {
+		beginMode(cli.MODE_SYNC_USER_UPDATE)
+		seelog.Trace("Start Sync: User Update")
+		seelog.Infof("Updating User Profiles (Google Users -> Dropbox Users)")
+		userSync, err := newUserSync()
+		if err != nil {
+			return nil, err
+		}
+		userSync.SyncUpdate()
 	}
 	if context.Options.IsModeGroupProvision() {
+		beginMode(cli.MODE_SYNC_GROUP_PROVISION)
 		seelog.Trace("Start Sync: Group Provision")
 		seelog.Infof("Syncing Group (Google Group -> Dropbox Group)")
-		groupSync := groupsync.NewGroupSync(context)
-		groupSync.SyncFromList(context)
+		groupSync, err := newGroupSync()
+		if err != nil {
+			return nil, err
+		}
+		if whiteList, ok := scopedWhiteList(groupSync); ok {
+			if err := groupSync.SyncFromWhiteList(whiteList); err != nil {
+				return nil, directoryError(err)
+			}
+		}
+	}
+	if context.Options.IsModeGroupDeprovision() {
+		beginMode(cli.MODE_SYNC_GROUP_DEPROVISION)
+		seelog.Trace("Start Sync: Group Deprovision")
+		seelog.Infof("Deprovisioning Group (Google Group -> Dropbox Group)")
+		groupSync, err := newGroupSync()
+		if err != nil {
+			return nil, err
+		}
+		if whiteList, ok := scopedWhiteList(groupSync); ok {
+			if err := groupSync.SyncDeprovisionFromWhiteList(whiteList); err != nil {
+				return nil, directoryError(err)
+			}
+		}
+	}
+	seelog.Tracef("Plan created: %d operation(s)", len(p.Operations))
+	return p, nil
+}
+
+func planLimits(context context.ExecutionContext) []plan.Limit {
+	o := context.Options
+	return []plan.Limit{
+		{
+			Name:           "User remove",
+			OperationTypes: []string{plan.OPERATION_MEMBERS_REMOVE, plan.OPERATION_MEMBERS_SUSPEND},
+			MaxCount:       o.LimitUserRemove,
+			MaxPercent:     o.LimitUserRemovePercent,
+		},
+		{
+			Name:           "User add",
+			OperationTypes: []string{plan.OPERATION_MEMBERS_ADD},
+			MaxCount:       o.LimitUserAdd,
+			MaxPercent:     o.LimitUserAddPercent,
+		},
+		{
+			Name:           "Group member remove",
+			OperationTypes: []string{plan.OPERATION_GROUPS_MEMBERS_REMOVE},
+			MaxCount:       o.LimitGroupMemberRemove,
+			MaxPercent:     o.LimitGroupMemberRemovePercent,
+		},
+		{
+			Name:           "Group delete",
+			OperationTypes: []string{plan.OPERATION_GROUPS_DELETE},
+			MaxCount:       o.LimitGroupDelete,
+		},
+	}
+}
+
+// Returns false if the plan exceeds safety limits, and execution is not forced.
+func verifyLimits(context context.ExecutionContext, p *plan.Plan) bool {
+	violations := p.CheckLimits(planLimits(context), p.TeamSize)
+	if len(violations) == 0 {
+		return true
+	}
+	if context.Options.ForceLargeChange {
+		for _, x := range violations {
+			seelog.Warnf("Safety limit exceeded (forced): %s", x)
+		}
+		return true
+	}
+	for _, x := range violations {
+		seelog.Errorf("Safety limit exceeded: %s", x)
+		explorer.ReportFailure("Safety limit exceeded: %s", x)
+	}
+	explorer.ReportFailure("No change executed (reason: safety limit exceeded, please review the change and use `-force-large-change` if the change is intentional)")
+	return false
+}
+
+func loadDeprovisionState(context context.ExecutionContext) (*usersync.DeprovisionState, error) {
+	path := context.Options.PathDeprovisionState()
+	state, err := usersync.LoadDeprovisionState(path)
+	if err != nil {
+		seelog.Errorf("Unable to load deprovision state file: file[%s] err[%v]", path, err)
+		return nil, newDispatchError(EXIT_CODE_FAILURE, err, "Ensure file [%s] is appropriate JSON format, or remove the file", path)
+	}
+	return state, nil
+}
+
+// Record suspensions applied by the plan into the state. Failed operations are
+// not recorded.
+func recordSuspensions(state *usersync.DeprovisionState, p *plan.Plan, appliedAt time.Time) {
+	failed := make(map[plan.Operation]bool)
+	for _, x := range p.Failed() {
+		failed[x] = true
+	}
+	for _, x := range p.Operations {
+		if failed[x] {
+			continue
+		}
+		switch x.Type {
+		case plan.OPERATION_MEMBERS_SUSPEND:
+			state.MarkSuspended(x.Email, appliedAt)
+		case plan.OPERATION_MEMBERS_UNSUSPEND, plan.OPERATION_MEMBERS_REMOVE:
+			state.ForgetSuspended(x.Email)
+		}
+	}
+}
+
+// Persist deprovision state only if the changes are actually executed.
+func saveDeprovisionState(context context.ExecutionContext, state *usersync.DeprovisionState) {
+	if context.Options.DryRun {
+		return
+	}
+	if !context.Options.IsModeSyncUserDeprovision() && !context.Options.IsModeSyncUserSuspend() {
+		return
+	}
+	path := context.Options.PathDeprovisionState()
+	if err := state.Save(path); err != nil {
+		seelog.Errorf("Unable to write deprovision state file: file[%s] err[%v]", path, err)
+		explorer.ReportFailure("Unable to write deprovision state file: [%s]", path)
+	}
+}
+
+func applyPlan(context context.ExecutionContext, p *plan.Plan, state *usersync.DeprovisionState) error {
+	if !verifyLimits(context, p) {
+		return newDispatchError(EXIT_CODE_REFUSED, nil, "Please review the change and use `-force-large-change` if the change is intentional")
+	}
+	if !context.Options.DryRun && len(p.Operations) > 0 {
+		log, err := openAuditLog(context)
+		if err != nil {
+			return err
+		}
+		defer log.Close()
+		context.AuditLog = log
+	}
+	err := p.ApplyUntil(connector.CreateConnector(context), context.Stop)
+	if !context.Options.DryRun {
+		observeApplied(p)
+
+		// Suspensions executed before the failure must be recorded
+		recordSuspensions(state, p, time.Now())
+		saveDeprovisionState(context, state)
+	}
+	if err == plan.ErrInterrupted {
+		return newDispatchError(EXIT_CODE_APPLY_FAILURE, err, "Remaining changes will be synced by the next run")
+	}
+	if connector.IsAudit(err) {
+		seelog.Errorf("Unable to write the audit log: Err[%v]", err)
+		return newDispatchError(EXIT_CODE_APPLY_FAILURE, err, "Ensure file [%s] is writable, then re-run", context.Options.PathAuditLog())
+	}
+	if err != nil {
+		seelog.Errorf("Unable to apply the plan: Err[%v]", err)
+		return newDispatchError(EXIT_CODE_APPLY_FAILURE, err, "Please re-run `-auth dropbox`, then re-run")
+	}
+	return nil
+}
+
+func savePlan(context context.ExecutionContext, p *plan.Plan) error {
+	path := context.Options.PathPlan(p.CreatedAt)
+	if err := p.Save(path); err != nil {
+		seelog.Errorf("Unable to write plan file: file[%s] err[%v]", path, err)
+		return newDispatchError(EXIT_CODE_FAILURE, err, "Ensure directory [%s] is writable", context.Options.BasePath)
+	}
+	for _, x := range p.Operations {
+		explorer.SetReportMode(x.Mode)
+		explorer.ReportOperationPlanned(x.Target(), "Planned: %s", x)
+	}
+	explorer.SetReportMode("")
+	explorer.ReportSuccess("Plan saved: [%s] %d operation(s)", path, len(p.Operations))
+	return nil
+}
+
+// Limit the white list to `groups`. Returns error if one of groups is not in
+// the white list.
+func filterWhiteList(whiteList []string, groups []string) ([]string, error) {
+	if len(groups) < 1 {
+		return whiteList, nil
+	}
+	listed := make(map[string]string)
+	for _, x := range whiteList {
+		listed[strings.ToLower(x)] = x
+	}
+	filtered := make([]string, 0, len(groups))
+	for _, x := range groups {
+		g, e := listed[strings.ToLower(x)]
+		if !e {
+			return nil, errors.New(fmt.Sprintf("Group [%s] is not in the white list", x))
+		}
+		filtered = append(filtered, g)
+	}
+	return filtered, nil
+}
+
+func loadWhiteList(context context.ExecutionContext) ([]string, error) {
+	if !context.Options.IsModeGroupProvision() && !context.Options.IsModeGroupDeprovision() {
+		return []string{}, nil
+	}
+	whiteList, err := groupsync.LoadWhiteList(context)
+	if err != nil {
+		return nil, newDispatchError(EXIT_CODE_FAILURE, err, "Ensure file exist and readable: file[%s]", context.Options.GroupWhiteList)
+	}
+	if len(context.SyncGroups) > 0 && context.Options.IsModeGroupDeprovision() {
+		// Deprovisioning by the partial list removes other groups
+		return nil, newDispatchError(EXIT_CODE_FAILURE, nil, "Mode `%s` cannot be limited to groups", cli.MODE_SYNC_GROUP_DEPROVISION)
+	}
+	whiteList, err = filterWhiteList(whiteList, context.SyncGroups)
+	if err != nil {
+		return nil, newDispatchError(EXIT_CODE_FAILURE, err, "Add the group to the white list file [%s]", context.Options.GroupWhiteList)
+	}
+	return whiteList, nil
+}
+
+func DispatchSync(context context.ExecutionContext) error {
+	_, err := runSync(context)
+	return err
+}
+
+// Run sync, and returns the plan. The plan is nil if no plan created (e.g.
+// initialisation failure, or no change since the last sync).
+func runSync(context context.ExecutionContext) (*plan.Plan, error) {
+	if err := context.InitForSync(); err != nil {
+		seelog.Errorf("Initialisation failure: %v", err)
+		return nil, newDispatchError(EXIT_CODE_FAILURE, err, "Please review configuration")
+	}
+	groupWhiteList, err := loadWhiteList(context)
+	if err != nil {
+		return nil, err
+	}
+	state, err := loadDeprovisionState(context)
+	if err != nil {
+		return nil, err
+	}
+	startedAt := time.Now().UTC()
+	checkpoint, err := loadCheckpoint(context)
+	if err != nil {
+		return nil, err
+	}
+	scope := prepareScope(context, checkpoint, groupWhiteList, state, startedAt)
+	if scope.IsEmpty() {
+		explorer.ReportSuccess("No change since the last sync: [%s]", checkpoint.LastSync.Format(time.RFC3339))
+		saveCheckpoint(context, checkpoint, scope, nil, groupWhiteList, startedAt)
+		return nil, nil
+	}
+	next := state.Clone()
+	p, err := createPlan(context, groupWhiteList, next, scope)
+	if err != nil {
+		return nil, err
+	}
+	observePlanned(p)
+	if context.Options.PlanOnly {
+		if err := savePlan(context, p); err != nil {
+			return p, err
+		}
+		verifyLimits(context, p)
+		return p, nil
+	}
+	if err := applyPlan(context, p, next); err != nil {
+		return p, err
+	}
+	saveCheckpoint(context, checkpoint, scope, p, groupWhiteList, startedAt)
+	return p, nil
+}
+
+// Apply the plan file verbatim. The plan is recreated from the live directories
+// first, and apply is refused if the result differs from the plan file.
+func DispatchApply(context context.ExecutionContext) error {
+	if err := context.InitForSync(); err != nil {
+		seelog.Errorf("Initialisation failure: %v", err)
+		return newDispatchError(EXIT_CODE_FAILURE, err, "Please review configuration")
+	}
+	path := context.Options.ApplyPlan
+	p, err := plan.Load(path)
+	if err != nil {
+		seelog.Errorf("Unable to load plan file: file[%s] err[%v]", path, err)
+		return newDispatchError(EXIT_CODE_FAILURE, err, "Ensure file [%s] is a plan file created by `-plan`", path)
+	}
+	seelog.Infof("Verifying plan: file[%s] created[%s] %d operation(s)", path, p.CreatedAt, len(p.Operations))
+
+	context.Options.ModeSync = strings.Join(p.Modes, ",")
+
+	// Drift must be verified against live directories, not the cache
+	context.Options.CacheRefresh = true
+
+	state, err := loadDeprovisionState(context)
+	if err != nil {
+		return err
+	}
+	next := state.Clone()
+	current, err := createPlan(context, p.GroupWhiteList, next, incremental.NewFullScope())
+	if err != nil {
+		return err
+	}
+	missing, unexpected := p.Diff(current)
+	if len(missing) > 0 || len(unexpected) > 0 {
+		for _, x := range missing {
+			seelog.Warnf("Planned operation no longer matches the directory: %s", x)
+			explorer.ReportFailure("Drift detected: planned operation no longer required: %s", x)
+		}
+		for _, x := range unexpected {
+			seelog.Warnf("Operation required but not in the plan: %s", x)
+			explorer.ReportFailure("Drift detected: operation not in the plan: %s", x)
+		}
+		seelog.Errorf("Directory changed since the plan created. Plan is not applied: file[%s]", path)
+		explorer.ReportFailure("Plan not applied: [%s] (reason: directory changed since the plan created, please re-run `-plan`)", path)
+		return newDispatchError(EXIT_CODE_REFUSED, nil, "Please re-create the plan by `-plan`")
 	}
+	p.TeamSize = current.TeamSize
+	p.CopyEvidence(current)
+	observePlanned(p)
+	return applyPlan(context, p, next)
 }
 
-func Dispatch(context context.ExecutionContext) {
+// Dispatch the command. Returns exit code for the process.
+func Dispatch(context context.ExecutionContext) int {
 	defer explorer.Report()
+	registerFatalNotification(context)
 
+	startedAt := time.Now()
+	context = withTrigger(context, startedAt.UTC().Format("20060102-150405"), RUN_TRIGGER_CLI, "")
+	var err error
 	switch {
+	case context.Options.AuditVerify:
+		return ExitCode(DispatchAuditVerify(context))
 	case context.Options.IsModeAuth():
-		DispatchAuth(context)
+		return ExitCode(DispatchAuth(context))
+	case context.Options.IsModeApply():
+		err = DispatchApply(context)
 	case context.Options.IsModeSync():
-		DispatchSync(context)
+		err = DispatchSync(context)
 	}
+	exitCode := ExitCode(err)
+	observeRun(context, startedAt, exitCode)
+	notifyRun(context, writeReport(context, startedAt, exitCode))
+	return exitCode
 }
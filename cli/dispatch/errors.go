@@ -0,0 +1,66 @@
+package dispatch
+
+import (
+	"fmt"
+	"github.com/cihub/seelog"
+)
+
+const (
+	EXIT_CODE_SUCCESS = 0
+
+	// Generic failure, e.g. configuration or file access
+	EXIT_CODE_FAILURE = 1
+
+	// Unable to load Google or Dropbox directory
+	EXIT_CODE_DIRECTORY_FAILURE = 2
+
+	// Apply aborted in the middle
+	EXIT_CODE_APPLY_FAILURE = 3
+
+	// Changes refused due to safety limits or drift of the plan
+	EXIT_CODE_REFUSED = 4
+)
+
+// Error of dispatch with exit code and suggested workaround for the CLI.
+type DispatchError struct {
+	ExitCode   int
+	Workaround string
+	Err        error
+}
+
+func (e *DispatchError) Error() string {
+	if e.Err == nil {
+		return e.Workaround
+	}
+	return e.Err.Error()
+}
+
+func newDispatchError(exitCode int, err error, workaround string, values ...interface{}) *DispatchError {
+	return &DispatchError{
+		ExitCode:   exitCode,
+		Workaround: fmt.Sprintf(workaround, values...),
+		Err:        err,
+	}
+}
+
+func directoryError(err error) *DispatchError {
+	return newDispatchError(EXIT_CODE_DIRECTORY_FAILURE, err, "Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google` or `-auth dropbox`")
+}
+
+// Log the error with suggested workaround, then returns exit code for the error.
+func ExitCode(err error) int {
+	if err == nil {
+		return EXIT_CODE_SUCCESS
+	}
+	de, ok := err.(*DispatchError)
+	if !ok {
+		seelog.Errorf("Error: %v", err)
+		return EXIT_CODE_FAILURE
+	}
+	if de.Err != nil {
+		seelog.Errorf("Error: %v", de.Err)
+	}
+	seelog.Errorf("Suggested workaround:")
+	seelog.Errorf(de.Workaround)
+	return de.ExitCode
+}
@@ -0,0 +1,92 @@
+package dispatch
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/integration/context"
+	"github.com/watermint/dcfg/integration/directory"
+	"github.com/watermint/dcfg/sync/incremental"
+	"github.com/watermint/dcfg/sync/plan"
+	"github.com/watermint/dcfg/sync/usersync"
+	"time"
+)
+
+const (
+	// Periods of change feeds are overlapped with the previous sync, because
+	// Google audit reports may be delayed.
+	changeFeedOverlap = 1 * time.Hour
+)
+
+func changeFeeds(context context.ExecutionContext) []directory.ChangeFeed {
+	feeds := []directory.ChangeFeed{
+		&directory.GoogleReportsFeed{ExecutionContext: context},
+	}
+	if context.DropboxAuditClient != nil {
+		feeds = append(feeds, &directory.DropboxTeamLogFeed{ExecutionContext: context})
+	} else {
+		seelog.Warnf("Dropbox team events are not loaded, changes on Dropbox will be synced on the next full sync. Run `-auth %s` to load team events", cli.MODE_AUTH_DROPBOX_AUDIT)
+	}
+	return feeds
+}
+
+func loadCheckpoint(context context.ExecutionContext) (*incremental.Checkpoint, error) {
+	path := context.Options.PathCheckpoint()
+	checkpoint, err := incremental.LoadCheckpoint(path)
+	if err != nil {
+		seelog.Errorf("Unable to load checkpoint file: file[%s] err[%v]", path, err)
+		return nil, newDispatchError(EXIT_CODE_FAILURE, err, "Ensure file [%s] is appropriate JSON format, or remove the file", path)
+	}
+	return checkpoint, nil
+}
+
+// Returns the scope of the sync. Falls back to the full sync if the checkpoint
+// is not available, or changes cannot be loaded.
+func prepareScope(context context.ExecutionContext, checkpoint *incremental.Checkpoint, groupWhiteList []string, state *usersync.DeprovisionState, startedAt time.Time) *incremental.Scope {
+	o := context.Options
+	if !o.Incremental || len(context.SyncGroups) > 0 {
+		return incremental.NewFullScope()
+	}
+	reason := checkpoint.FullSyncReason(startedAt, o.IncrementalFullInterval, o.SyncModes(), incremental.WhiteListHash(groupWhiteList))
+	if reason != "" {
+		seelog.Infof("Full sync (reason: %s)", reason)
+		return incremental.NewFullScope()
+	}
+
+	since := checkpoint.LastSync.Add(-changeFeedOverlap)
+	changes := directory.NewChangeSet()
+	for _, feed := range changeFeeds(context) {
+		if err := feed.Collect(since, startedAt, changes); err != nil {
+			seelog.Warnf("Unable to load changes, fallback to full sync: Err[%v]", err)
+			explorer.ReportFailure("Full sync executed instead of incremental sync (reason: unable to load changes: %v)", err)
+			return incremental.NewFullScope()
+		}
+	}
+	changes.Merge(checkpoint.Pending)
+
+	// Users in grace period of deprovisioning must be checked on every sync
+	for email := range state.FirstSeenMissing {
+		changes.AddUser(email)
+	}
+	seelog.Infof("Incremental sync since %s: %d user(s), %d Google group(s), %d Dropbox group(s) changed", since.Format(time.RFC3339), len(changes.Users), len(changes.GoogleGroups), len(changes.DropboxGroupIds))
+	return incremental.NewScope(changes, checkpoint)
+}
+
+// Persist checkpoint only if the changes are actually executed.
+func saveCheckpoint(context context.ExecutionContext, checkpoint *incremental.Checkpoint, scope *incremental.Scope, p *plan.Plan, groupWhiteList []string, startedAt time.Time) {
+	o := context.Options
+	if !o.Incremental || o.DryRun || len(context.SyncGroups) > 0 {
+		return
+	}
+	failed := directory.NewChangeSet()
+	if p != nil {
+		failed = incremental.ChangesOfOperations(p.Failed())
+	}
+	checkpoint.Update(startedAt, scope.IsFull(), o.SyncModes(), incremental.WhiteListHash(groupWhiteList), scope, failed)
+
+	path := o.PathCheckpoint()
+	if err := checkpoint.Save(path); err != nil {
+		seelog.Errorf("Unable to write checkpoint file: file[%s] err[%v]", path, err)
+		explorer.ReportFailure("Unable to write checkpoint file: [%s]", path)
+	}
+}
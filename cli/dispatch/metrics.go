@@ -0,0 +1,74 @@
+package dispatch
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/common/metrics"
+	"github.com/watermint/dcfg/integration/context"
+	"github.com/watermint/dcfg/sync/plan"
+	"net"
+	"net/http"
+	"time"
+)
+
+const (
+	metricsPath = "/metrics"
+)
+
+func observePlanned(p *plan.Plan) {
+	for _, x := range p.Operations {
+		metrics.ObserveOperation(metrics.OPERATIONS_PLANNED, x.Type)
+	}
+}
+
+// Record results of operations executed by apply.
+func observeApplied(p *plan.Plan) {
+	failed := make(map[string]int)
+	for _, x := range p.Failed() {
+		failed[x.Type]++
+		metrics.ObserveOperation(metrics.OPERATIONS_FAILED, x.Type)
+	}
+	for _, x := range p.Operations {
+		if failed[x.Type] > 0 {
+			failed[x.Type]--
+			continue
+		}
+		metrics.ObserveOperation(metrics.OPERATIONS_SUCCEEDED, x.Type)
+	}
+}
+
+// Record the result of the run, then write metrics into the textfile if configured.
+// The time of the last success is carried over from the textfile of the previous run.
+func observeRun(context context.ExecutionContext, startedAt time.Time, exitCode int) {
+	path := context.Options.MetricsTextfile
+	if path != "" {
+		if err := metrics.RestoreLastSuccess(path); err != nil {
+			seelog.Warnf("Unable to read metrics file: file[%s] err[%v]", path, err)
+		}
+	}
+	metrics.ObserveRun(startedAt, time.Now(), exitCode)
+
+	if path == "" {
+		return
+	}
+	if err := metrics.Default.WriteFile(path); err != nil {
+		seelog.Warnf("Unable to write metrics file: file[%s] err[%v]", path, err)
+	}
+}
+
+// Start serving metrics in background.
+func startMetricsServer(address string) (net.Listener, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		seelog.Errorf("Metrics: Unable to listen: address[%s] err[%v]", address, err)
+		return nil, err
+	}
+	mux := http.NewServeMux()
+	mux.Handle(metricsPath, metrics.Default)
+	seelog.Infof("Metrics: Listening on %s%s", listener.Addr(), metricsPath)
+	go func() {
+		if err := newHttpServer(mux).Serve(listener); err != nil {
+			seelog.Tracef("Metrics: Server stopped: err[%v]", err)
+		}
+	}()
+	return listener, nil
+}
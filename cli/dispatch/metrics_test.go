@@ -0,0 +1,39 @@
+package dispatch
+
+import (
+	"github.com/watermint/dcfg/common/metrics"
+	"github.com/watermint/dcfg/integration/connector"
+	"github.com/watermint/dcfg/sync/plan"
+	"testing"
+)
+
+func TestObserveApplied(t *testing.T) {
+	metrics.Default.Reset()
+	defer metrics.Default.Reset()
+
+	p := plan.NewPlan([]string{"user-suspend"}, []string{})
+	recorder := plan.NewRecorder(p)
+	recorder.MembersSuspend("a@example.com", "")
+	recorder.MembersSuspend("b@example.com", "")
+	recorder.MembersUnsuspend("c@example.com", "")
+
+	mock := connector.DropboxConnectorMock{}
+	mock.MockErrors = map[string]error{
+		mock.CreateOperationLog("MembersSuspend", "b@example.com"): connector.NewDropboxError(connector.ERROR_KIND_NOT_FOUND, "MembersSuspend", "user_not_found"),
+	}
+	p.Apply(&mock)
+	observePlanned(p)
+	observeApplied(p)
+
+	suspend := metrics.Labels{"type": plan.OPERATION_MEMBERS_SUSPEND}
+	unsuspend := metrics.Labels{"type": plan.OPERATION_MEMBERS_UNSUSPEND}
+	if metrics.Default.Get(metrics.OPERATIONS_PLANNED, suspend) != 2 || metrics.Default.Get(metrics.OPERATIONS_PLANNED, unsuspend) != 1 {
+		t.Error("Unexpected planned operations")
+	}
+	if metrics.Default.Get(metrics.OPERATIONS_SUCCEEDED, suspend) != 1 || metrics.Default.Get(metrics.OPERATIONS_SUCCEEDED, unsuspend) != 1 {
+		t.Error("Unexpected succeeded operations")
+	}
+	if metrics.Default.Get(metrics.OPERATIONS_FAILED, suspend) != 1 || metrics.Default.Get(metrics.OPERATIONS_FAILED, unsuspend) != 0 {
+		t.Error("Unexpected failed operations")
+	}
+}
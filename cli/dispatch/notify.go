@@ -0,0 +1,179 @@
+package dispatch
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/integration/context"
+	"github.com/watermint/dcfg/integration/notify"
+	"github.com/watermint/dcfg/sync/plan"
+	"io/ioutil"
+	"strings"
+	"time"
+)
+
+// Returns true if the report has failures, or the run failed.
+func isFailedRun(report *explorer.RunReport) bool {
+	if report.ExitCode != EXIT_CODE_SUCCESS {
+		return true
+	}
+	for _, x := range report.Records {
+		if x.Outcome != explorer.OUTCOME_SUCCESS {
+			return true
+		}
+	}
+	return false
+}
+
+// Returns true if any Dropbox operation is reported, including planned
+// operations and operations on dryrun.
+func hasChanges(report *explorer.RunReport) bool {
+	for _, x := range report.Records {
+		if x.Operation != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func shouldNotify(notifyOn string, report *explorer.RunReport) bool {
+	switch notifyOn {
+	case cli.NOTIFY_ON_ALWAYS:
+		return true
+	case cli.NOTIFY_ON_CHANGE:
+		return isFailedRun(report) || hasChanges(report)
+	default:
+		return isFailedRun(report)
+	}
+}
+
+// Accounts removed or suspended by user-deprovision, and actually executed by
+// the run. Planned operations, operations on dryrun and suspensions by
+// user-suspend are not included.
+func deprovisionedAccounts(report *explorer.RunReport) []explorer.ReportRecord {
+	accounts := make([]explorer.ReportRecord, 0)
+	if report.DryRun {
+		return accounts
+	}
+	for _, x := range report.Records {
+		if x.Outcome != explorer.OUTCOME_SUCCESS || x.DryRun || x.Planned || x.Mode != cli.MODE_SYNC_USER_DEPROVISION {
+			continue
+		}
+		if x.Operation == plan.OPERATION_MEMBERS_REMOVE || x.Operation == plan.OPERATION_MEMBERS_SUSPEND {
+			accounts = append(accounts, x)
+		}
+	}
+	return accounts
+}
+
+func notificationSubject(report *explorer.RunReport) string {
+	success, failure := report.Count()
+	result := "succeeded"
+	if isFailedRun(report) {
+		result = "failed"
+	}
+	dryRun := ""
+	if report.DryRun {
+		dryRun = " (dryrun)"
+	}
+	return fmt.Sprintf("[DCFG] Sync %s%s: %d success, %d failure", result, dryRun, success, failure)
+}
+
+// Summary of the report in plain text. Same content as the summary in the log.
+func notificationBody(report *explorer.RunReport) string {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "Started: %s\n", report.StartedAt.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Finished: %s\n", report.FinishedAt.Format(time.RFC3339))
+	fmt.Fprintf(&buf, "Modes: %s\n", strings.Join(report.Modes, ", "))
+	fmt.Fprintf(&buf, "Dryrun: %t\n", report.DryRun)
+	fmt.Fprintf(&buf, "Exit code: %d\n", report.ExitCode)
+
+	if accounts := deprovisionedAccounts(report); len(accounts) > 0 {
+		fmt.Fprintf(&buf, "\nDeprovisioned accounts:\n")
+		for _, x := range accounts {
+			fmt.Fprintf(&buf, "  %s (%s)\n", x.Email, x.Operation)
+		}
+	}
+
+	section := func(title string, success bool) {
+		i := 0
+		for _, x := range report.Records {
+			if (x.Outcome == explorer.OUTCOME_SUCCESS) != success {
+				continue
+			}
+			if i == 0 {
+				fmt.Fprintf(&buf, "\n%s:\n", title)
+			}
+			i++
+			fmt.Fprintf(&buf, "  [%d] %s\n", i, x.Message)
+		}
+	}
+	section("Failure", false)
+	section("Success", true)
+	if len(report.Records) == 0 {
+		fmt.Fprintf(&buf, "\nNo update.\n")
+	}
+	return buf.String()
+}
+
+// Mailer configured by options. Returns nil if mail notification is not configured.
+func newMailer(context context.ExecutionContext) (*notify.SmtpMailer, error) {
+	o := context.Options
+	if o.SmtpHost == "" {
+		return nil, nil
+	}
+	m := &notify.SmtpMailer{
+		Host:     o.SmtpHost,
+		Port:     o.SmtpPort,
+		StartTLS: o.SmtpStartTLS,
+		Username: o.SmtpUsername,
+		From:     o.SmtpFrom,
+		To:       o.SmtpRecipients(),
+	}
+	if o.SmtpUsername != "" {
+		password, err := ioutil.ReadFile(o.PathSmtpPassword())
+		if err != nil {
+			return nil, err
+		}
+		m.Password = strings.TrimSpace(string(password))
+	}
+	return m, nil
+}
+
+func sendMail(context context.ExecutionContext, subject, body string) {
+	m, err := newMailer(context)
+	if err != nil {
+		seelog.Warnf("Unable to load SMTP password file: file[%s] err[%v]", context.Options.PathSmtpPassword(), err)
+		return
+	}
+	if m == nil {
+		return
+	}
+	if err := m.Send(subject, body); err != nil {
+		seelog.Warnf("Unable to send notification mail: host[%s] err[%v]", context.Options.SmtpHost, err)
+		return
+	}
+	seelog.Infof("Notification mail sent: [%s]", strings.Join(m.To, ", "))
+}
+
+// Notify the result of the run, if the result matches the policy. Failures on
+// notification do not affect the result of the run.
+func notifyRun(context context.ExecutionContext, report *explorer.RunReport) {
+	if !shouldNotify(context.Options.NotifyOn, report) {
+		return
+	}
+	sendMail(context, notificationSubject(report), notificationBody(report))
+	postWebhooks(context, slackRunMessage(report), webhookRunPayload(report))
+}
+
+// Notify on FatalShutdown. Fatal errors are notified regardless of the policy.
+func registerFatalNotification(context context.ExecutionContext) {
+	explorer.OnFatalShutdown(func(message string) {
+		subject := "[DCFG] Fatal error"
+		body := fmt.Sprintf("DCFG stopped due to a fatal error.\n\nSuggested workaround:\n%s\n", message)
+		sendMail(context, subject, body)
+		postWebhooks(context, slackFatalMessage(message), webhookFatalPayload(message))
+	})
+}
@@ -0,0 +1,92 @@
+package dispatch
+
+import (
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/cli/explorer"
+	"strings"
+	"testing"
+)
+
+func TestShouldNotify(t *testing.T) {
+	noChange := &explorer.RunReport{
+		Records: []explorer.ReportRecord{
+			{Outcome: explorer.OUTCOME_SUCCESS, Message: "No change since the last sync"},
+		},
+	}
+	changed := &explorer.RunReport{
+		Records: []explorer.ReportRecord{
+			{Outcome: explorer.OUTCOME_SUCCESS, Operation: "MembersAdd", Email: "a@example.com"},
+		},
+	}
+	failed := &explorer.RunReport{
+		ExitCode: EXIT_CODE_APPLY_FAILURE,
+	}
+
+	cases := []struct {
+		notifyOn string
+		report   *explorer.RunReport
+		expected bool
+	}{
+		{"", noChange, false},
+		{cli.NOTIFY_ON_FAILURE, changed, false},
+		{cli.NOTIFY_ON_FAILURE, failed, true},
+		{cli.NOTIFY_ON_CHANGE, noChange, false},
+		{cli.NOTIFY_ON_CHANGE, changed, true},
+		{cli.NOTIFY_ON_CHANGE, failed, true},
+		{cli.NOTIFY_ON_ALWAYS, noChange, true},
+	}
+	for _, c := range cases {
+		if actual := shouldNotify(c.notifyOn, c.report); actual != c.expected {
+			t.Errorf("Unexpected result: notifyOn[%s] report[%v] expected[%t]", c.notifyOn, c.report, c.expected)
+		}
+	}
+}
+
+func TestNotificationBody(t *testing.T) {
+	report := &explorer.RunReport{
+		Modes: []string{cli.MODE_SYNC_USER_DEPROVISION},
+		Records: []explorer.ReportRecord{
+			{Outcome: explorer.OUTCOME_SUCCESS, Mode: cli.MODE_SYNC_USER_DEPROVISION, Operation: "MembersRemove", Email: "a@example.com", Message: "Member account should be removed from Dropbox: Email[a@example.com]"},
+			{Outcome: explorer.OUTCOME_FAILURE, Mode: cli.MODE_SYNC_USER_DEPROVISION, Operation: "MembersSuspend", Email: "b@example.com", ErrorClass: "auth", Message: "Unable to suspend member Dropbox account: Email[b@example.com]"},
+		},
+	}
+	if s := notificationSubject(report); s != "[DCFG] Sync failed: 1 success, 1 failure" {
+		t.Errorf("Unexpected subject: %s", s)
+	}
+	body := notificationBody(report)
+	for _, x := range []string{"Deprovisioned accounts:\n  a@example.com (MembersRemove)", "Failure:\n  [1] Unable to suspend", "Success:\n  [1] Member account should be removed"} {
+		if !strings.Contains(body, x) {
+			t.Errorf("Body should contain: %s\n%s", x, body)
+		}
+	}
+	if strings.Contains(body, "b@example.com (MembersSuspend)") {
+		t.Errorf("Failed operation should not be listed as deprovisioned: %s", body)
+	}
+}
+
+func TestDeprovisionedAccounts(t *testing.T) {
+	records := []explorer.ReportRecord{
+		{Outcome: explorer.OUTCOME_SUCCESS, Mode: cli.MODE_SYNC_USER_DEPROVISION, Operation: "MembersRemove", Email: "a@example.com"},
+		{Outcome: explorer.OUTCOME_SUCCESS, Mode: cli.MODE_SYNC_USER_DEPROVISION, Operation: "MembersSuspend", Email: "b@example.com"},
+		{Outcome: explorer.OUTCOME_SUCCESS, Mode: cli.MODE_SYNC_USER_SUSPEND, Operation: "MembersSuspend", Email: "c@example.com"},
+		{Outcome: explorer.OUTCOME_SUCCESS, Mode: cli.MODE_SYNC_USER_DEPROVISION, Operation: "MembersRemove", Email: "d@example.com", Planned: true},
+		{Outcome: explorer.OUTCOME_SUCCESS, Mode: cli.MODE_SYNC_USER_DEPROVISION, Operation: "MembersRemove", Email: "e@example.com", DryRun: true},
+	}
+	accounts := deprovisionedAccounts(&explorer.RunReport{Records: records})
+	if len(accounts) != 2 || accounts[0].Email != "a@example.com" || accounts[1].Email != "b@example.com" {
+		t.Errorf("Only executed operations of user-deprovision should be included: %v", accounts)
+	}
+
+	// Dryrun
+	if accounts := deprovisionedAccounts(&explorer.RunReport{DryRun: true, Records: records}); len(accounts) != 0 {
+		t.Errorf("Operations on dryrun should not be included: %v", accounts)
+	}
+
+	// Plan
+	planned := []explorer.ReportRecord{
+		{Outcome: explorer.OUTCOME_SUCCESS, Mode: cli.MODE_SYNC_USER_DEPROVISION, Operation: "MembersRemove", Email: "a@example.com", Planned: true},
+	}
+	if accounts := deprovisionedAccounts(&explorer.RunReport{Records: planned}); len(accounts) != 0 {
+		t.Errorf("Planned operations should not be included: %v", accounts)
+	}
+}
@@ -0,0 +1,52 @@
+package dispatch
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/integration/context"
+	"os"
+	"path"
+	"time"
+)
+
+const (
+	reportExtJSON = "json"
+	reportExtCSV  = "csv"
+)
+
+// Create the report of the run from reported records, then write into report files.
+// Failures on writing files do not affect the result of the run.
+func writeReport(context context.ExecutionContext, startedAt time.Time, exitCode int) *explorer.RunReport {
+	r := &explorer.RunReport{
+		StartedAt:  startedAt.UTC(),
+		FinishedAt: time.Now().UTC(),
+		Modes:      context.Options.SyncModes(),
+		DryRun:     context.Options.DryRun,
+		ExitCode:   exitCode,
+		Records:    explorer.ReportRecords(),
+		Groups:     explorer.ReportGroups(),
+	}
+
+	// HTML report is written next to the log
+	htmlPath := context.Options.PathReportHtml(startedAt)
+	if err := r.WriteHTML(htmlPath); err != nil {
+		seelog.Warnf("Unable to write report file: file[%s] err[%v]", htmlPath, err)
+	} else {
+		seelog.Infof("HTML report saved: [%s]", htmlPath)
+	}
+
+	jsonPath := context.Options.PathReport(startedAt, reportExtJSON)
+	csvPath := context.Options.PathReport(startedAt, reportExtCSV)
+	if err := os.MkdirAll(path.Dir(jsonPath), 0700); err != nil {
+		seelog.Warnf("Unable to create report directory: path[%s] err[%v]", path.Dir(jsonPath), err)
+		return r
+	}
+	if err := r.WriteJSON(jsonPath); err != nil {
+		seelog.Warnf("Unable to write report file: file[%s] err[%v]", jsonPath, err)
+	}
+	if err := r.WriteCSV(csvPath); err != nil {
+		seelog.Warnf("Unable to write report file: file[%s] err[%v]", csvPath, err)
+	}
+	seelog.Infof("Report saved: [%s] [%s]", jsonPath, csvPath)
+	return r
+}
@@ -0,0 +1,139 @@
+package dispatch
+
+import (
+	"fmt"
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/integration/context"
+	"github.com/watermint/dcfg/integration/notify"
+	"strconv"
+	"strings"
+)
+
+const (
+	WEBHOOK_EVENT_RUN_FINISHED = "run_finished"
+	WEBHOOK_EVENT_FATAL        = "fatal"
+
+	// Max lines of each list in Slack messages
+	slackMaxLines = 20
+)
+
+// Payload of generic JSON webhooks.
+type WebhookPayload struct {
+	Event   string `json:"event"`
+	Success bool   `json:"success"`
+	Summary string `json:"summary"`
+
+	// Suggested workaround of the fatal error
+	Message string `json:"message,omitempty"`
+
+	// Report of the run including operations. Not available for fatal errors.
+	Report *explorer.RunReport `json:"report,omitempty"`
+}
+
+func webhookRunPayload(report *explorer.RunReport) WebhookPayload {
+	return WebhookPayload{
+		Event:   WEBHOOK_EVENT_RUN_FINISHED,
+		Success: !isFailedRun(report),
+		Summary: notificationSubject(report),
+		Report:  report,
+	}
+}
+
+func webhookFatalPayload(message string) WebhookPayload {
+	return WebhookPayload{
+		Event:   WEBHOOK_EVENT_FATAL,
+		Success: false,
+		Summary: "[DCFG] Fatal error",
+		Message: message,
+	}
+}
+
+// Lines of the list, truncated to slackMaxLines.
+func slackList(lines []string) string {
+	if len(lines) > slackMaxLines {
+		more := len(lines) - slackMaxLines
+		lines = append(lines[:slackMaxLines:slackMaxLines], fmt.Sprintf("... and %d more (see the report file)", more))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func slackRunMessage(report *explorer.RunReport) notify.SlackMessage {
+	success, failure := report.Count()
+	color := notify.SLACK_COLOR_GOOD
+	if isFailedRun(report) {
+		color = notify.SLACK_COLOR_DANGER
+	}
+	subject := notificationSubject(report)
+	attachment := notify.SlackAttachment{
+		Color:    color,
+		Fallback: subject,
+		Fields: []notify.SlackField{
+			{Title: "Modes", Value: strings.Join(report.Modes, ", "), Short: true},
+			{Title: "Dryrun", Value: strconv.FormatBool(report.DryRun), Short: true},
+			{Title: "Exit code", Value: strconv.Itoa(report.ExitCode), Short: true},
+			{Title: "Success / Failure", Value: fmt.Sprintf("%d / %d", success, failure), Short: true},
+		},
+	}
+	if accounts := deprovisionedAccounts(report); len(accounts) > 0 {
+		lines := make([]string, 0, len(accounts))
+		for _, x := range accounts {
+			lines = append(lines, fmt.Sprintf("%s (%s)", x.Email, x.Operation))
+		}
+		attachment.Fields = append(attachment.Fields, notify.SlackField{Title: "Deprovisioned accounts", Value: slackList(lines)})
+	}
+	if failure > 0 {
+		lines := make([]string, 0, failure)
+		for _, x := range report.Records {
+			if x.Outcome != explorer.OUTCOME_SUCCESS {
+				lines = append(lines, x.Message)
+			}
+		}
+		attachment.Fields = append(attachment.Fields, notify.SlackField{Title: "Failures", Value: slackList(lines)})
+	}
+	return notify.SlackMessage{
+		Text:        subject,
+		Attachments: []notify.SlackAttachment{attachment},
+	}
+}
+
+func slackFatalMessage(message string) notify.SlackMessage {
+	return notify.SlackMessage{
+		Text: "[DCFG] Fatal error",
+		Attachments: []notify.SlackAttachment{
+			{
+				Color:    notify.SLACK_COLOR_DANGER,
+				Title:    "Suggested workaround",
+				Text:     message,
+				Fallback: message,
+			},
+		},
+	}
+}
+
+// Post payloads to configured webhooks. Failures are logged, and do not affect
+// the result of the run.
+func postWebhooks(context context.ExecutionContext, slack notify.SlackMessage, payload WebhookPayload) {
+	post := func(url string, p interface{}) {
+		w := notify.Webhook{Url: url}
+		if err := w.Post(p); err != nil {
+			seelog.Warnf("Unable to post webhook: url[%s] err[%v]", notify.RedactUrl(url), err)
+			return
+		}
+		seelog.Tracef("Webhook posted: url[%s]", notify.RedactUrl(url))
+	}
+	slackUrls, err := context.Options.WebhookSlackUrls()
+	if err != nil {
+		seelog.Warnf("Unable to load webhook file: file[%s] err[%v]", context.Options.PathWebhookSlack(), err)
+	}
+	for _, x := range slackUrls {
+		post(x, slack)
+	}
+	jsonUrls, err := context.Options.WebhookJsonUrls()
+	if err != nil {
+		seelog.Warnf("Unable to load webhook file: file[%s] err[%v]", context.Options.PathWebhookJson(), err)
+	}
+	for _, x := range jsonUrls {
+		post(x, payload)
+	}
+}
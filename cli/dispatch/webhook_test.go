@@ -0,0 +1,88 @@
+package dispatch
+
+import (
+	"encoding/json"
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/integration/context"
+	"github.com/watermint/dcfg/integration/notify"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestPostWebhooks(t *testing.T) {
+	received := make(map[string][]byte)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		received[r.URL.Path] = body
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "dcfg-webhook")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	ctx := context.ExecutionContext{
+		Options: cli.Options{
+			BasePath: dir,
+		},
+	}
+	if err := ioutil.WriteFile(ctx.Options.PathWebhookSlack(), []byte(server.URL+"/slack\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(ctx.Options.PathWebhookJson(), []byte(server.URL+"/json\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	report := &explorer.RunReport{
+		Modes:    []string{cli.MODE_SYNC_USER_DEPROVISION},
+		ExitCode: EXIT_CODE_SUCCESS,
+		Records: []explorer.ReportRecord{
+			{Outcome: explorer.OUTCOME_SUCCESS, Mode: cli.MODE_SYNC_USER_DEPROVISION, Operation: "MembersRemove", Email: "a@example.com", Message: "Remove Dropbox account: Email[a@example.com]"},
+		},
+	}
+	postWebhooks(ctx, slackRunMessage(report), webhookRunPayload(report))
+
+	slack := notify.SlackMessage{}
+	if err := json.Unmarshal(received["/slack"], &slack); err != nil {
+		t.Fatal(err)
+	}
+	if len(slack.Attachments) != 1 || slack.Attachments[0].Color != notify.SLACK_COLOR_GOOD {
+		t.Errorf("Unexpected Slack message: %v", slack)
+	}
+	found := false
+	for _, x := range slack.Attachments[0].Fields {
+		if x.Title == "Deprovisioned accounts" && strings.Contains(x.Value, "a@example.com") {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Deprovisioned accounts not found: %v", slack)
+	}
+
+	payload := WebhookPayload{}
+	if err := json.Unmarshal(received["/json"], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if payload.Event != WEBHOOK_EVENT_RUN_FINISHED || !payload.Success || payload.Report == nil || len(payload.Report.Records) != 1 || payload.Report.Records[0].Operation != "MembersRemove" {
+		t.Errorf("Unexpected payload: %v", payload)
+	}
+}
+
+func TestSlackList(t *testing.T) {
+	lines := make([]string, slackMaxLines+5)
+	for i := range lines {
+		lines[i] = "line"
+	}
+	list := strings.Split(slackList(lines), "\n")
+	if len(list) != slackMaxLines+1 || list[slackMaxLines] != "... and 5 more (see the report file)" {
+		t.Errorf("Unexpected list: %v", list)
+	}
+	if len(lines) != slackMaxLines+5 || lines[slackMaxLines] != "line" {
+		t.Errorf("Original lines should not be modified: %v", lines)
+	}
+}
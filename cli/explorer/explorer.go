@@ -14,6 +14,7 @@ import (
 
 var (
 	startupSystemLog bool
+	fatalHandlers    []func(message string)
 )
 
 const (
@@ -45,9 +46,18 @@ func replaceLogger(basePath string, appVersion string) {
 	seelog.Info("dcfg version: ", appVersion)
 }
 
+// Register the handler called on FatalShutdown before exit, e.g. for notifications.
+func OnFatalShutdown(handler func(message string)) {
+	fatalHandlers = append(fatalHandlers, handler)
+}
+
 func FatalShutdown(suggestedWorkaround string, values ...interface{}) {
 	seelog.Errorf("Suggested workaround:")
 	seelog.Errorf(suggestedWorkaround, values...)
+	message := fmt.Sprintf(suggestedWorkaround, values...)
+	for _, h := range fatalHandlers {
+		h(message)
+	}
 	seelog.Flush()
 	os.Exit(1)
 }
@@ -128,6 +138,7 @@ func logNetwork() {
 // Start the explorer
 func Start(options cli.Options, appVersion string) {
 	replaceLogger(options.BasePath, appVersion)
+	ResetReport(options.DryRun)
 	logSystem()
 	options.UpdateEnv()
 	logNetwork()
@@ -1,46 +1,264 @@
 package explorer
 
 import (
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
 	"github.com/cihub/seelog"
+	"os"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
 )
 
+const (
+	OUTCOME_SUCCESS = "success"
+	OUTCOME_FAILURE = "failure"
+)
+
+// Reported event of the run. Operation fields are empty for events not related
+// to a Dropbox operation (e.g. safety limit exceeded).
+type ReportRecord struct {
+	Timestamp  time.Time `json:"timestamp"`
+	Outcome    string    `json:"outcome"`
+	Mode       string    `json:"mode,omitempty"`
+	Operation  string    `json:"operation,omitempty"`
+	Email      string    `json:"email,omitempty"`
+	GroupId    string    `json:"group_id,omitempty"`
+	GroupName  string    `json:"group_name,omitempty"`
+	DryRun     bool      `json:"dry_run"`
+	ErrorClass string    `json:"error_class,omitempty"`
+	Message    string    `json:"message"`
+	Planned    bool      `json:"planned,omitempty"`
+}
+
+// Target of the Dropbox operation. Operation is the operation type of the plan
+// (e.g. `MembersAdd`).
+type Target struct {
+	Operation string
+	Email     string
+	GroupId   string
+	GroupName string
+}
+
+// Membership of the Dropbox Group before and after the sync. Members are
+// sorted by email.
+type GroupMembership struct {
+	Mode      string   `json:"mode,omitempty"`
+	GroupId   string   `json:"group_id"`
+	GroupName string   `json:"group_name"`
+	Before    []string `json:"before"`
+	After     []string `json:"after"`
+}
+
+// Report of the run, written into report files.
+type RunReport struct {
+	StartedAt  time.Time         `json:"started_at"`
+	FinishedAt time.Time         `json:"finished_at"`
+	Modes      []string          `json:"modes"`
+	DryRun     bool              `json:"dry_run"`
+	ExitCode   int               `json:"exit_code"`
+	Records    []ReportRecord    `json:"records"`
+	Groups     []GroupMembership `json:"groups,omitempty"`
+}
+
 var (
-	reportSuccess []string
-	reportFailure []string
+	reportRecords []ReportRecord
+	reportGroups  []GroupMembership
+	reportDryRun  bool
+	reportMode    string
+	reportMutex   sync.Mutex
+
+	reportCsvHeader = []string{"timestamp", "outcome", "mode", "operation", "email", "group_id", "group_name", "dry_run", "error_class", "message", "planned"}
 )
 
 func init() {
-	reportSuccess = []string{}
-	reportFailure = []string{}
+	reportRecords = []ReportRecord{}
+	reportGroups = []GroupMembership{}
+}
+
+func report(outcome string, target Target, errorClass string, planned bool, format string, values ...interface{}) {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	reportRecords = append(reportRecords, ReportRecord{
+		Timestamp:  time.Now().UTC(),
+		Outcome:    outcome,
+		Mode:       reportMode,
+		Operation:  target.Operation,
+		Email:      target.Email,
+		GroupId:    target.GroupId,
+		GroupName:  target.GroupName,
+		DryRun:     reportDryRun,
+		ErrorClass: errorClass,
+		Message:    fmt.Sprintf(format, values...),
+		Planned:    planned,
+	})
 }
 
 func ReportSuccess(format string, values ...interface{}) {
-	reportSuccess = append(reportSuccess, fmt.Sprintf(format, values...))
+	report(OUTCOME_SUCCESS, Target{}, "", false, format, values...)
 }
 
 func ReportFailure(format string, values ...interface{}) {
-	reportFailure = append(reportFailure, fmt.Sprintf(format, values...))
+	report(OUTCOME_FAILURE, Target{}, "", false, format, values...)
+}
+
+func ReportOperationSuccess(target Target, format string, values ...interface{}) {
+	report(OUTCOME_SUCCESS, target, "", false, format, values...)
+}
+
+// Report the operation written into the plan file by `-plan`. The operation is
+// not executed by the run.
+func ReportOperationPlanned(target Target, format string, values ...interface{}) {
+	report(OUTCOME_SUCCESS, target, "", true, format, values...)
+}
+
+// Report failure of the operation. `errorClass` is the kind of the error (e.g.
+// `conflict` or `auth` of the connector, `skipped` if not executed).
+func ReportOperationFailure(target Target, errorClass string, format string, values ...interface{}) {
+	report(OUTCOME_FAILURE, target, errorClass, false, format, values...)
+}
+
+// Clear reported records, and set dry run flag of records. Used for starting
+// new run on daemon mode.
+func ResetReport(dryRun bool) {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	reportRecords = []ReportRecord{}
+	reportGroups = []GroupMembership{}
+	reportDryRun = dryRun
+	reportMode = ""
+}
+
+// Set sync mode of records reported after this call. Empty for records not
+// related to a sync mode.
+func SetReportMode(mode string) {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	reportMode = mode
+}
+
+// Report membership of the Dropbox Group changed by the sync.
+func ReportGroupMembership(groupId, groupName string, before, after []string) {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	m := GroupMembership{
+		Mode:      reportMode,
+		GroupId:   groupId,
+		GroupName: groupName,
+		Before:    append([]string{}, before...),
+		After:     append([]string{}, after...),
+	}
+	sort.Strings(m.Before)
+	sort.Strings(m.After)
+	reportGroups = append(reportGroups, m)
+}
+
+// Copy of reported group memberships since the last reset.
+func ReportGroups() []GroupMembership {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	return append([]GroupMembership{}, reportGroups...)
+}
+
+// Copy of reported records since the last reset.
+func ReportRecords() []ReportRecord {
+	reportMutex.Lock()
+	defer reportMutex.Unlock()
+	return append([]ReportRecord{}, reportRecords...)
+}
+
+func countRecords(records []ReportRecord) (success int, failure int) {
+	for _, x := range records {
+		if x.Outcome == OUTCOME_SUCCESS {
+			success++
+		} else {
+			failure++
+		}
+	}
+	return
+}
+
+// Number of reported records since the last reset.
+func ReportCount() (success int, failure int) {
+	return countRecords(ReportRecords())
+}
+
+// Number of records of the run.
+func (r *RunReport) Count() (success int, failure int) {
+	return countRecords(r.Records)
 }
 
 func reportLine(format string, args ...interface{}) {
 	seelog.Infof(format, args...)
 }
 
+// Write summary of reported records into the log.
 func Report() {
-	if len(reportSuccess) == 0 && len(reportFailure) == 0 {
+	records := ReportRecords()
+	success, failure := ReportCount()
+	if success == 0 && failure == 0 {
 		reportLine("No update.")
 	} else {
-		if len(reportSuccess) > 0 {
-			for i, line := range reportSuccess {
-				reportLine("Success: [%d] %s", i+1, line)
+		i := 0
+		for _, x := range records {
+			if x.Outcome == OUTCOME_SUCCESS {
+				i++
+				reportLine("Success: [%d] %s", i, x.Message)
 			}
 		}
-		if len(reportFailure) > 0 {
-			for i, line := range reportFailure {
-				reportLine("Failure: [%d] %s", i+1, line)
+		i = 0
+		for _, x := range records {
+			if x.Outcome != OUTCOME_SUCCESS {
+				i++
+				reportLine("Failure: [%d] %s", i, x.Message)
 			}
 		}
 	}
 	reportLine("Done")
 }
+
+func (r *RunReport) WriteJSON(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func (r *RunReport) WriteCSV(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := csv.NewWriter(f)
+	w.Write(reportCsvHeader)
+	for _, x := range r.Records {
+		w.Write([]string{
+			x.Timestamp.Format(time.RFC3339),
+			x.Outcome,
+			x.Mode,
+			x.Operation,
+			x.Email,
+			x.GroupId,
+			x.GroupName,
+			strconv.FormatBool(x.DryRun),
+			x.ErrorClass,
+			x.Message,
+			strconv.FormatBool(x.Planned),
+		})
+	}
+	w.Flush()
+	err = w.Error()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
@@ -0,0 +1,227 @@
+package explorer
+
+import (
+	"html/template"
+	"os"
+	"sort"
+	"time"
+)
+
+const (
+	reportHtmlOtherSection = "(other)"
+
+	MEMBER_ADDED     = "added"
+	MEMBER_REMOVED   = "removed"
+	MEMBER_UNCHANGED = "unchanged"
+)
+
+type htmlMember struct {
+	Email  string
+	Change string
+}
+
+type htmlSection struct {
+	Title   string
+	Success int
+	Failure int
+	Records []ReportRecord
+
+	// Membership of the group. Only for sections of groups changed by the sync.
+	Members []htmlMember
+}
+
+type htmlReport struct {
+	*RunReport
+	Success int
+	Failure int
+	ByMode  []*htmlSection
+	ByGroup []*htmlSection
+}
+
+var reportHtmlTemplate = template.Must(template.New("report").Funcs(template.FuncMap{
+	"time": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>DCFG Report {{time .StartedAt}}</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; margin: 2em; color: #222; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: left; vertical-align: top; }
+th { background: #f0f0f0; }
+tr.failure td { background: #fde2e2; }
+.count-failure { color: #c00; font-weight: bold; }
+.member-added { color: #080; }
+.member-removed { color: #c00; text-decoration: line-through; }
+.dryrun { background: #fff3cd; padding: 4px 8px; display: inline-block; }
+</style>
+</head>
+<body>
+<h1>DCFG Report</h1>
+{{if .DryRun}}<p class="dryrun">Dryrun: no change executed on Dropbox</p>{{end}}
+<table>
+<tr><th>Started</th><td>{{time .StartedAt}}</td></tr>
+<tr><th>Finished</th><td>{{time .FinishedAt}}</td></tr>
+<tr><th>Modes</th><td>{{range $i, $m := .Modes}}{{if $i}}, {{end}}{{$m}}{{end}}</td></tr>
+<tr><th>Exit code</th><td>{{.ExitCode}}</td></tr>
+<tr><th>Success</th><td>{{.Success}}</td></tr>
+<tr><th>Failure</th><td{{if .Failure}} class="count-failure"{{end}}>{{.Failure}}</td></tr>
+</table>
+
+<h2>By sync mode</h2>
+{{range .ByMode}}{{template "section" .}}{{else}}<p>No update.</p>{{end}}
+
+<h2>By Dropbox Group</h2>
+{{range .ByGroup}}{{template "section" .}}{{else}}<p>No group changed.</p>{{end}}
+</body>
+</html>
+{{define "section"}}
+<h3>{{.Title}}</h3>
+<p>Success: {{.Success}} / Failure: <span{{if .Failure}} class="count-failure"{{end}}>{{.Failure}}</span></p>
+{{if .Members}}
+<table>
+<tr><th>Member</th><th>Change</th></tr>
+{{range .Members}}<tr><td class="member-{{.Change}}">{{.Email}}</td><td>{{.Change}}</td></tr>
+{{end}}</table>
+{{end}}
+{{if .Records}}
+<table>
+<tr><th>Time</th><th>Outcome</th><th>Operation</th><th>Email</th><th>Group</th><th>Error</th><th>Message</th></tr>
+{{range .Records}}<tr class="{{.Outcome}}"><td>{{time .Timestamp}}</td><td>{{.Outcome}}</td><td>{{.Operation}}</td><td>{{.Email}}</td><td>{{if .GroupName}}{{.GroupName}}{{else}}{{.GroupId}}{{end}}</td><td>{{.ErrorClass}}</td><td>{{.Message}}</td></tr>
+{{end}}</table>
+{{end}}
+{{end}}
+`))
+
+func (s *htmlSection) add(r ReportRecord) {
+	s.Records = append(s.Records, r)
+	if r.Outcome == OUTCOME_SUCCESS {
+		s.Success++
+	} else {
+		s.Failure++
+	}
+}
+
+// Members of the group, with changes between before and after.
+func membershipChanges(m GroupMembership) []htmlMember {
+	before := make(map[string]bool)
+	for _, x := range m.Before {
+		before[x] = true
+	}
+	after := make(map[string]bool)
+	for _, x := range m.After {
+		after[x] = true
+	}
+	members := make([]htmlMember, 0, len(m.Before)+len(m.After))
+	for _, x := range m.After {
+		if before[x] {
+			members = append(members, htmlMember{Email: x, Change: MEMBER_UNCHANGED})
+		} else {
+			members = append(members, htmlMember{Email: x, Change: MEMBER_ADDED})
+		}
+	}
+	for _, x := range m.Before {
+		if !after[x] {
+			members = append(members, htmlMember{Email: x, Change: MEMBER_REMOVED})
+		}
+	}
+	sort.SliceStable(members, func(i, j int) bool {
+		return members[i].Email < members[j].Email
+	})
+	return members
+}
+
+func newHtmlReport(r *RunReport) htmlReport {
+	h := htmlReport{
+		RunReport: r,
+	}
+
+	// Sections of sync modes in order of execution, then records not related to modes
+	modes := make(map[string]*htmlSection)
+	for _, x := range r.Modes {
+		if _, exist := modes[x]; !exist {
+			modes[x] = &htmlSection{Title: x}
+		}
+	}
+	groups := make(map[string]*htmlSection)
+	groupSection := func(groupId, groupName string) *htmlSection {
+		s, exist := groups[groupId]
+		if !exist {
+			s = &htmlSection{Title: groupId}
+			groups[groupId] = s
+		}
+		if groupName != "" {
+			s.Title = groupName
+		}
+		return s
+	}
+
+	for _, x := range r.Records {
+		if x.Outcome == OUTCOME_SUCCESS {
+			h.Success++
+		} else {
+			h.Failure++
+		}
+		mode := x.Mode
+		if mode == "" {
+			mode = reportHtmlOtherSection
+		}
+		s, exist := modes[mode]
+		if !exist {
+			s = &htmlSection{Title: mode}
+			modes[mode] = s
+		}
+		s.add(x)
+		if x.GroupId != "" {
+			groupSection(x.GroupId, x.GroupName).add(x)
+		}
+	}
+	for _, x := range r.Groups {
+		groupSection(x.GroupId, x.GroupName).Members = membershipChanges(x)
+	}
+
+	for _, x := range r.Modes {
+		if s, exist := modes[x]; exist && len(s.Records) > 0 {
+			h.ByMode = append(h.ByMode, s)
+			delete(modes, x)
+		}
+	}
+	others := make([]*htmlSection, 0, len(modes))
+	for mode, s := range modes {
+		if mode != reportHtmlOtherSection && len(s.Records) > 0 {
+			others = append(others, s)
+		}
+	}
+	sort.Slice(others, func(i, j int) bool {
+		return others[i].Title < others[j].Title
+	})
+	h.ByMode = append(h.ByMode, others...)
+	if s, exist := modes[reportHtmlOtherSection]; exist && len(s.Records) > 0 {
+		h.ByMode = append(h.ByMode, s)
+	}
+
+	for _, s := range groups {
+		h.ByGroup = append(h.ByGroup, s)
+	}
+	sort.Slice(h.ByGroup, func(i, j int) bool {
+		return h.ByGroup[i].Title < h.ByGroup[j].Title
+	})
+	return h
+}
+
+// Write the report as a self-contained HTML file, grouped by sync mode and by
+// Dropbox Group. Failures are highlighted.
+func (r *RunReport) WriteHTML(path string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = reportHtmlTemplate.Execute(f, newHtmlReport(r))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
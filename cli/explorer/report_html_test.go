@@ -0,0 +1,72 @@
+package explorer
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunReport_WriteHTML(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ResetReport(true)
+	defer ResetReport(false)
+	ReportSuccess("Plan saved")
+	SetReportMode("group-provision")
+	ReportOperationSuccess(Target{Operation: "GroupsMembersAdd", Email: "c@example.com", GroupId: "g:1"}, "Member should be added")
+	ReportOperationFailure(Target{Operation: "GroupsMembersRemove", Email: "b@example.com", GroupId: "g:1"}, "conflict", "Unable to remove <b@example.com>")
+	ReportGroupMembership("g:1", "Sales", []string{"b@example.com", "a@example.com"}, []string{"a@example.com", "c@example.com"})
+	SetReportMode("")
+
+	r := RunReport{
+		Modes:   []string{"user-provision", "group-provision"},
+		DryRun:  true,
+		Records: ReportRecords(),
+		Groups:  ReportGroups(),
+	}
+	h := newHtmlReport(&r)
+	if h.Success != 2 || h.Failure != 1 {
+		t.Errorf("Unexpected count: success[%d] failure[%d]", h.Success, h.Failure)
+	}
+	if len(h.ByMode) != 2 || h.ByMode[0].Title != "group-provision" || h.ByMode[1].Title != reportHtmlOtherSection {
+		t.Errorf("Unexpected mode sections: %v", h.ByMode)
+	}
+	if len(h.ByGroup) != 1 || h.ByGroup[0].Title != "Sales" || h.ByGroup[0].Failure != 1 {
+		t.Fatalf("Unexpected group sections: %v", h.ByGroup)
+	}
+	expected := []htmlMember{
+		{Email: "a@example.com", Change: MEMBER_UNCHANGED},
+		{Email: "b@example.com", Change: MEMBER_REMOVED},
+		{Email: "c@example.com", Change: MEMBER_ADDED},
+	}
+	members := h.ByGroup[0].Members
+	if len(members) != len(expected) {
+		t.Fatalf("Unexpected members: %v", members)
+	}
+	for i, x := range expected {
+		if members[i] != x {
+			t.Errorf("Unexpected member: expected[%v] actual[%v]", x, members[i])
+		}
+	}
+
+	path := filepath.Join(dir, "report.html")
+	if err := r.WriteHTML(path); err != nil {
+		t.Fatal(err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := string(b)
+	for _, x := range []string{"<h3>Sales</h3>", `<tr class="failure">`, "Unable to remove &lt;b@example.com&gt;", "Dryrun"} {
+		if !strings.Contains(content, x) {
+			t.Errorf("Report should contain: %s", x)
+		}
+	}
+}
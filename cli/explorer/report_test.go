@@ -0,0 +1,91 @@
+package explorer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestReport_Records(t *testing.T) {
+	ResetReport(true)
+	defer ResetReport(false)
+
+	ReportSuccess("Plan saved")
+	ReportOperationSuccess(Target{Operation: "MembersAdd", Email: "alice@example.com"}, "Add Dropbox account: %s", "alice@example.com")
+	ReportOperationFailure(Target{Operation: "GroupsMembersAdd", Email: "bob@example.com", GroupId: "g:1234"}, "conflict", "Unable to add member")
+
+	if success, failure := ReportCount(); success != 2 || failure != 1 {
+		t.Errorf("Unexpected count: success[%d] failure[%d]", success, failure)
+	}
+	records := ReportRecords()
+	if len(records) != 3 {
+		t.Fatalf("Unexpected records: %v", records)
+	}
+	if r := records[1]; r.Outcome != OUTCOME_SUCCESS || r.Operation != "MembersAdd" || r.Email != "alice@example.com" || !r.DryRun || r.Message != "Add Dropbox account: alice@example.com" {
+		t.Errorf("Unexpected record: %v", r)
+	}
+	if r := records[2]; r.Outcome != OUTCOME_FAILURE || r.GroupId != "g:1234" || r.ErrorClass != "conflict" {
+		t.Errorf("Unexpected record: %v", r)
+	}
+
+	ResetReport(false)
+	if records := ReportRecords(); len(records) != 0 {
+		t.Errorf("Records should be cleared: %v", records)
+	}
+}
+
+func TestRunReport_Write(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-report")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	ResetReport(false)
+	ReportOperationFailure(Target{Operation: "MembersRemove", Email: "carol@example.com"}, "auth", "Unable to remove member, \"quoted\"")
+	r := RunReport{
+		Modes:   []string{"user-deprovision"},
+		Records: ReportRecords(),
+	}
+	ResetReport(false)
+	if success, failure := r.Count(); success != 0 || failure != 1 {
+		t.Errorf("Unexpected count: success[%d] failure[%d]", success, failure)
+	}
+
+	jsonPath := filepath.Join(dir, "report.json")
+	if err := r.WriteJSON(jsonPath); err != nil {
+		t.Fatal(err)
+	}
+	loaded := RunReport{}
+	if b, err := ioutil.ReadFile(jsonPath); err != nil {
+		t.Fatal(err)
+	} else if err := json.Unmarshal(b, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Records) != 1 || loaded.Records[0].Email != "carol@example.com" || loaded.Records[0].ErrorClass != "auth" {
+		t.Errorf("Unexpected report: %v", loaded)
+	}
+
+	csvPath := filepath.Join(dir, "report.csv")
+	if err := r.WriteCSV(csvPath); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.Open(csvPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	rows, err := csv.NewReader(f).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 2 || len(rows[0]) != len(reportCsvHeader) {
+		t.Fatalf("Unexpected rows: %v", rows)
+	}
+	if rows[1][1] != OUTCOME_FAILURE || rows[1][3] != "MembersRemove" || rows[1][9] != "Unable to remove member, \"quoted\"" {
+		t.Errorf("Unexpected row: %v", rows[1])
+	}
+}
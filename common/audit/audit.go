@@ -0,0 +1,264 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cihub/seelog"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	// Hash of the entry before the first entry
+	GENESIS_HASH = "0000000000000000000000000000000000000000000000000000000000000000"
+
+	// Size of blocks to read the last entry from the end of the file
+	tailBlockSize = 4096
+)
+
+// Entry of the audit log. Each entry is a line of JSON. The hash covers the
+// entry without the hash, and the hash of the previous entry, so that
+// modification or removal of entries breaks the chain.
+//
+// The chain cannot detect removal of entries from the end of the file, since
+// the remaining entries are still a valid chain. Detecting that requires an
+// external anchor, e.g. the hash of the last entry kept outside of the file.
+type Entry struct {
+	Sequence  int64           `json:"seq"`
+	Timestamp time.Time       `json:"timestamp"`
+	PrevHash  string          `json:"prev_hash"`
+	Record    json.RawMessage `json:"record"`
+	Hash      string          `json:"hash"`
+}
+
+// Part of the entry covered by the hash. Field order must not change.
+type hashedEntry struct {
+	Sequence  int64           `json:"seq"`
+	Timestamp time.Time       `json:"timestamp"`
+	PrevHash  string          `json:"prev_hash"`
+	Record    json.RawMessage `json:"record"`
+}
+
+func (e *Entry) computeHash() (string, error) {
+	b, err := json.Marshal(hashedEntry{
+		Sequence:  e.Sequence,
+		Timestamp: e.Timestamp,
+		PrevHash:  e.PrevHash,
+		Record:    e.Record,
+	})
+	if err != nil {
+		return "", err
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+// Append-only audit log in JSON lines. The file is opened in append mode, and
+// never truncated or rotated. Safe for concurrent use in the process, but the
+// file must not be written by multiple processes at the same time.
+type Log struct {
+	path     string
+	file     *os.File
+	sequence int64
+	lastHash string
+	mutex    sync.Mutex
+}
+
+// Open the audit log, or create if not exist. The chain continues from the last
+// entry of the file. A partially written last entry (e.g. crashed while Append)
+// is truncated with a warning.
+func Open(path string) (*Log, error) {
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if n, err := truncatePartialLine(f); err != nil {
+		f.Close()
+		return nil, err
+	} else if n > 0 {
+		seelog.Warnf("Partially written entry truncated from the audit log: file[%s] bytes[%d]", path, n)
+	}
+	l := &Log{
+		path:     path,
+		file:     f,
+		lastHash: GENESIS_HASH,
+	}
+	last, err := lastLine(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if len(last) > 0 {
+		e := Entry{}
+		if err := json.Unmarshal(last, &e); err != nil {
+			f.Close()
+			return nil, errors.New(fmt.Sprintf("Unable to parse the last entry of the audit log: %v", err))
+		}
+		l.sequence = e.Sequence
+		l.lastHash = e.Hash
+	}
+	return l, nil
+}
+
+// Truncate the last line if the line has no trailing newline. Append writes
+// the entry and the newline at once, thus such line is a partially written entry.
+// Returns number of truncated bytes.
+func truncatePartialLine(f *os.File) (int64, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return 0, err
+	}
+	size := info.Size()
+	for offset := size; offset > 0; {
+		n := int64(tailBlockSize)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		block := make([]byte, n)
+		if _, err := f.ReadAt(block, offset); err != nil && err != io.EOF {
+			return 0, err
+		}
+		i := bytes.LastIndexByte(block, '\n')
+		if i < 0 && offset > 0 {
+			continue
+		}
+		end := offset + int64(i) + 1
+		if end == size {
+			return 0, nil
+		}
+		if err := f.Truncate(end); err != nil {
+			return 0, err
+		}
+		if err := f.Sync(); err != nil {
+			return 0, err
+		}
+		return size - end, nil
+	}
+	return 0, nil
+}
+
+// Read the last non-empty line from the end of the file.
+func lastLine(f *os.File) ([]byte, error) {
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	var tail []byte
+	for offset := info.Size(); offset > 0; {
+		n := int64(tailBlockSize)
+		if offset < n {
+			n = offset
+		}
+		offset -= n
+		block := make([]byte, n)
+		if _, err := f.ReadAt(block, offset); err != nil && err != io.EOF {
+			return nil, err
+		}
+		tail = append(block, tail...)
+		trimmed := bytes.TrimRight(tail, "\n")
+		if i := bytes.LastIndexByte(trimmed, '\n'); i >= 0 {
+			return trimmed[i+1:], nil
+		}
+		if offset == 0 {
+			return trimmed, nil
+		}
+	}
+	return nil, nil
+}
+
+func (l *Log) Path() string {
+	return l.path
+}
+
+// Append the record as a new entry. The entry is synced to the disk before return.
+func (l *Log) Append(record interface{}) error {
+	r, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	e := Entry{
+		Sequence:  l.sequence + 1,
+		Timestamp: time.Now().UTC(),
+		PrevHash:  l.lastHash,
+		Record:    r,
+	}
+	if e.Hash, err = e.computeHash(); err != nil {
+		return err
+	}
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	if _, err := l.file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if err := l.file.Sync(); err != nil {
+		return err
+	}
+	l.sequence = e.Sequence
+	l.lastHash = e.Hash
+	return nil
+}
+
+func (l *Log) Close() error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return l.file.Close()
+}
+
+// Verify the hash chain of the audit log. Returns number of verified entries,
+// and error on the first broken entry.
+func Verify(path string) (int64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	prevHash := GENESIS_HASH
+	var count int64
+	for lineNum := 1; ; lineNum++ {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			return count, nil
+		}
+		if err != nil && err != io.EOF {
+			return count, err
+		}
+		line = bytes.TrimRight(line, "\n")
+		if len(line) == 0 {
+			return count, errors.New(fmt.Sprintf("Empty line: line[%d]", lineNum))
+		}
+		e := Entry{}
+		if err := json.Unmarshal(line, &e); err != nil {
+			return count, errors.New(fmt.Sprintf("Invalid entry: line[%d] err[%v]", lineNum, err))
+		}
+		if e.Sequence != count+1 {
+			return count, errors.New(fmt.Sprintf("Unexpected sequence: line[%d] expected[%d] actual[%d]", lineNum, count+1, e.Sequence))
+		}
+		if e.PrevHash != prevHash {
+			return count, errors.New(fmt.Sprintf("Chain broken: line[%d] previous hash does not match", lineNum))
+		}
+		hash, err := e.computeHash()
+		if err != nil {
+			return count, err
+		}
+		if e.Hash != hash {
+			return count, errors.New(fmt.Sprintf("Entry modified: line[%d] hash does not match", lineNum))
+		}
+		prevHash = e.Hash
+		count++
+	}
+}
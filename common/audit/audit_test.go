@@ -0,0 +1,137 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+type testRecord struct {
+	Operation string `json:"operation"`
+	Email     string `json:"email"`
+}
+
+func TestLog_AppendVerify(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []string{"a@example.com", "b@example.com"} {
+		if err := l.Append(testRecord{Operation: "MembersRemove", Email: x}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	// Chain continues after reopen
+	l, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if l.sequence != 2 {
+		t.Errorf("Unexpected sequence: %d", l.sequence)
+	}
+	if err := l.Append(testRecord{Operation: "MembersAdd", Email: "c@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	if n, err := Verify(path); err != nil || n != 3 {
+		t.Errorf("Unexpected result: entries[%d] err[%v]", n, err)
+	}
+}
+
+func TestVerify_Tampered(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, x := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		if err := l.Append(testRecord{Operation: "MembersRemove", Email: x}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	l.Close()
+
+	original, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bytes.SplitAfter(original, []byte("\n"))
+
+	// Modify the record
+	modified := bytes.Replace(original, []byte("b@example.com"), []byte("x@example.com"), 1)
+	if err := ioutil.WriteFile(path, modified, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Verify(path); err == nil || n != 1 {
+		t.Errorf("Modification should be detected: entries[%d] err[%v]", n, err)
+	}
+
+	// Remove the entry
+	removed := append(append([]byte{}, lines[0]...), lines[2]...)
+	if err := ioutil.WriteFile(path, removed, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := Verify(path); err == nil || n != 1 {
+		t.Errorf("Removal should be detected: entries[%d] err[%v]", n, err)
+	}
+}
+
+func TestOpen_PartialEntry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+
+	l, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.Append(testRecord{Operation: "MembersRemove", Email: "a@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	// Emulate crash while writing the second entry
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte(`{"seq":2,"timestamp":"2017-01-01T00:00:00Z","prev`))
+	f.Close()
+
+	l, err = Open(path)
+	if err != nil {
+		t.Fatalf("Partial entry should be truncated: %v", err)
+	}
+	if l.sequence != 1 {
+		t.Errorf("Unexpected sequence: %d", l.sequence)
+	}
+	if err := l.Append(testRecord{Operation: "MembersAdd", Email: "b@example.com"}); err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+
+	if n, err := Verify(path); err != nil || n != 2 {
+		t.Errorf("Unexpected result: entries[%d] err[%v]", n, err)
+	}
+}
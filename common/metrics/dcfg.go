@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"time"
+)
+
+const (
+	OPERATIONS_PLANNED   = "dcfg_operations_planned_total"
+	OPERATIONS_SUCCEEDED = "dcfg_operations_succeeded_total"
+	OPERATIONS_FAILED    = "dcfg_operations_failed_total"
+
+	API_CALLS   = "dcfg_api_calls_total"
+	API_ERRORS  = "dcfg_api_errors_total"
+	API_RETRIES = "dcfg_api_retries_total"
+
+	RUNS                   = "dcfg_runs_total"
+	RUN_DURATION           = "dcfg_run_duration_seconds"
+	LAST_RUN_TIMESTAMP     = "dcfg_last_run_timestamp_seconds"
+	LAST_RUN_EXIT_CODE     = "dcfg_last_run_exit_code"
+	LAST_SUCCESS_TIMESTAMP = "dcfg_last_success_timestamp_seconds"
+
+	DIRECTORY_SIZE = "dcfg_directory_size"
+
+	PROVIDER_GOOGLE  = "google"
+	PROVIDER_DROPBOX = "dropbox"
+
+	DIRECTORY_GOOGLE_USERS    = "google_users"
+	DIRECTORY_GOOGLE_GROUPS   = "google_groups"
+	DIRECTORY_DROPBOX_MEMBERS = "dropbox_members"
+	DIRECTORY_DROPBOX_GROUPS  = "dropbox_groups"
+)
+
+func init() {
+	Default.Register(OPERATIONS_PLANNED, TYPE_COUNTER, "Dropbox operations planned, by operation type")
+	Default.Register(OPERATIONS_SUCCEEDED, TYPE_COUNTER, "Dropbox operations succeeded, by operation type")
+	Default.Register(OPERATIONS_FAILED, TYPE_COUNTER, "Dropbox operations failed or skipped, by operation type")
+	Default.Register(API_CALLS, TYPE_COUNTER, "API calls including retries, by provider and endpoint")
+	Default.Register(API_ERRORS, TYPE_COUNTER, "API calls failed, by provider, endpoint and error kind")
+	Default.Register(API_RETRIES, TYPE_COUNTER, "API calls retried, by provider and endpoint")
+	Default.Register(RUNS, TYPE_COUNTER, "Runs, by result (success or failure)")
+	Default.Register(RUN_DURATION, TYPE_GAUGE, "Duration of the last run in seconds")
+	Default.Register(LAST_RUN_TIMESTAMP, TYPE_GAUGE, "Time of the last run finished, in unix time")
+	Default.Register(LAST_RUN_EXIT_CODE, TYPE_GAUGE, "Exit code of the last run")
+	Default.Register(LAST_SUCCESS_TIMESTAMP, TYPE_GAUGE, "Time of the last successful run finished, in unix time")
+	Default.Register(DIRECTORY_SIZE, TYPE_GAUGE, "Number of users or groups loaded on the last run, by directory")
+}
+
+// Record an attempt of API call. `attempt` starts from 1. `errorKind` is empty
+// if the call succeeded.
+func ObserveApiCall(provider, endpoint string, attempt int, errorKind string) {
+	labels := Labels{"provider": provider, "endpoint": endpoint}
+	Default.Add(API_CALLS, labels, 1)
+	if attempt > 1 {
+		Default.Add(API_RETRIES, labels, 1)
+	}
+	if errorKind != "" {
+		Default.Add(API_ERRORS, Labels{"provider": provider, "endpoint": endpoint, "kind": errorKind}, 1)
+	}
+}
+
+func ObserveOperation(metric, operationType string) {
+	Default.Add(metric, Labels{"type": operationType}, 1)
+}
+
+func ObserveRun(startedAt, finishedAt time.Time, exitCode int) {
+	result := "success"
+	if exitCode != 0 {
+		result = "failure"
+	} else {
+		Default.Set(LAST_SUCCESS_TIMESTAMP, nil, float64(finishedAt.Unix()))
+	}
+	Default.Add(RUNS, Labels{"result": result}, 1)
+	Default.Set(RUN_DURATION, nil, finishedAt.Sub(startedAt).Seconds())
+	Default.Set(LAST_RUN_TIMESTAMP, nil, float64(finishedAt.Unix()))
+	Default.Set(LAST_RUN_EXIT_CODE, nil, float64(exitCode))
+}
+
+// Restore the time of the last successful run from the textfile written by the
+// previous run, unless recorded by this process. The gauge is kept on failed runs.
+func RestoreLastSuccess(path string) error {
+	if Default.Get(LAST_SUCCESS_TIMESTAMP, nil) != 0 {
+		return nil
+	}
+	v, found, err := ReadFileValue(path, LAST_SUCCESS_TIMESTAMP)
+	if err != nil || !found {
+		return err
+	}
+	Default.Set(LAST_SUCCESS_TIMESTAMP, nil, v)
+	return nil
+}
+
+func SetDirectorySize(directory string, size int) {
+	Default.Set(DIRECTORY_SIZE, Labels{"directory": directory}, float64(size))
+}
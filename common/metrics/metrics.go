@@ -0,0 +1,233 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	TYPE_COUNTER = "counter"
+	TYPE_GAUGE   = "gauge"
+
+	contentType = "text/plain; version=0.0.4; charset=utf-8"
+)
+
+type Labels map[string]string
+
+// Registry of metrics. Metrics are written in Prometheus text exposition format.
+type Registry struct {
+	families map[string]*family
+	mutex    sync.Mutex
+}
+
+type family struct {
+	name       string
+	help       string
+	metricType string
+	series     map[string]*series // key of labels -> series
+}
+
+type series struct {
+	labels string // formatted labels, e.g. `{type="MembersAdd"}`
+	value  float64
+}
+
+var (
+	Default = NewRegistry()
+)
+
+func NewRegistry() *Registry {
+	return &Registry{
+		families: make(map[string]*family),
+	}
+}
+
+func (r *Registry) Register(name, metricType, help string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, e := r.families[name]; e {
+		return
+	}
+	r.families[name] = &family{
+		name:       name,
+		help:       help,
+		metricType: metricType,
+		series:     make(map[string]*series),
+	}
+}
+
+func escapeLabelValue(v string) string {
+	v = strings.Replace(v, `\`, `\\`, -1)
+	v = strings.Replace(v, `"`, `\"`, -1)
+	return strings.Replace(v, "\n", `\n`, -1)
+}
+
+func formatLabels(labels Labels) string {
+	if len(labels) == 0 {
+		return ""
+	}
+	names := make([]string, 0, len(labels))
+	for n := range labels {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	pairs := make([]string, 0, len(names))
+	for _, n := range names {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, n, escapeLabelValue(labels[n])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// Returns series of the metric. Caller must hold the lock. Metrics not
+// registered are ignored.
+func (r *Registry) series(name string, labels Labels) *series {
+	f, e := r.families[name]
+	if !e {
+		return nil
+	}
+	key := formatLabels(labels)
+	s, e := f.series[key]
+	if !e {
+		s = &series{labels: key}
+		f.series[key] = s
+	}
+	return s
+}
+
+// Add the value to the counter or the gauge.
+func (r *Registry) Add(name string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if s := r.series(name, labels); s != nil {
+		s.value += value
+	}
+}
+
+// Set the value of the gauge.
+func (r *Registry) Set(name string, labels Labels, value float64) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if s := r.series(name, labels); s != nil {
+		s.value = value
+	}
+}
+
+// Current value of the metric. Zero if not recorded.
+func (r *Registry) Get(name string, labels Labels) float64 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	f, e := r.families[name]
+	if !e {
+		return 0
+	}
+	if s, e := f.series[formatLabels(labels)]; e {
+		return s.value
+	}
+	return 0
+}
+
+// Clear recorded values. Registered metrics are kept.
+func (r *Registry) Reset() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, f := range r.families {
+		f.series = make(map[string]*series)
+	}
+}
+
+// Write metrics in Prometheus text exposition format. Metrics without values
+// are omitted.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	names := make([]string, 0, len(r.families))
+	for n := range r.families {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+
+	b := bufio.NewWriter(w)
+	for _, n := range names {
+		f := r.families[n]
+		if len(f.series) == 0 {
+			continue
+		}
+		fmt.Fprintf(b, "# HELP %s %s\n", f.name, strings.Replace(f.help, "\n", " ", -1))
+		fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.metricType)
+		keys := make([]string, 0, len(f.series))
+		for k := range f.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Fprintf(b, "%s%s %s\n", f.name, k, strconv.FormatFloat(f.series[k].value, 'g', -1, 64))
+		}
+	}
+	return b.Flush()
+}
+
+// Read the value of the metric without labels from the file written by WriteFile.
+// Returns false if the file or the metric does not exist.
+func ReadFileValue(path, name string) (float64, bool, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, err
+	}
+	defer f.Close()
+
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		fields := strings.Fields(s.Text())
+		if len(fields) != 2 || fields[0] != name {
+			continue
+		}
+		v, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return 0, false, err
+		}
+		return v, true, nil
+	}
+	return 0, false, s.Err()
+}
+
+// Write metrics into the file, for the textfile collector of node exporter.
+// The file is replaced atomically, to avoid the collector reading partially
+// written file.
+func (r *Registry) WriteFile(path string) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	err = r.Write(tmp)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Chmod(tmp.Name(), 0644)
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", contentType)
+	r.Write(w)
+}
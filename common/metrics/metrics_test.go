@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRegistry_Write(t *testing.T) {
+	r := NewRegistry()
+	r.Register("test_calls_total", TYPE_COUNTER, "Calls")
+	r.Register("test_size", TYPE_GAUGE, "Size")
+	r.Register("test_unused", TYPE_GAUGE, "Unused")
+
+	r.Add("test_calls_total", Labels{"provider": "google", "endpoint": "Users.List"}, 1)
+	r.Add("test_calls_total", Labels{"endpoint": "Users.List", "provider": "google"}, 2)
+	r.Add("test_calls_total", Labels{"provider": "dropbox", "endpoint": "a\"b\\c"}, 1)
+	r.Set("test_size", nil, 10)
+	r.Set("test_size", nil, 12)
+	r.Add("test_not_registered", nil, 1)
+
+	if v := r.Get("test_calls_total", Labels{"provider": "google", "endpoint": "Users.List"}); v != 3 {
+		t.Errorf("Unexpected value: %v", v)
+	}
+
+	var buf bytes.Buffer
+	if err := r.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	expected := `# HELP test_calls_total Calls
+# TYPE test_calls_total counter
+test_calls_total{endpoint="Users.List",provider="google"} 3
+test_calls_total{endpoint="a\"b\\c",provider="dropbox"} 1
+# HELP test_size Size
+# TYPE test_size gauge
+test_size 12
+`
+	if buf.String() != expected {
+		t.Errorf("Unexpected output:\n%s", buf.String())
+	}
+
+	r.Reset()
+	buf.Reset()
+	r.Write(&buf)
+	if buf.Len() != 0 {
+		t.Errorf("Values should be cleared: %s", buf.String())
+	}
+}
+
+func TestRegistry_WriteFileAndServe(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	r := NewRegistry()
+	r.Register("test_size", TYPE_GAUGE, "Size")
+	r.Set("test_size", nil, 1)
+
+	p := path.Join(dir, "dcfg.prom")
+	if err := r.WriteFile(p); err != nil {
+		t.Fatal(err)
+	}
+	content, err := ioutil.ReadFile(p)
+	if err != nil || !strings.Contains(string(content), "test_size 1\n") {
+		t.Errorf("Unexpected file: %s %v", content, err)
+	}
+	if files, _ := ioutil.ReadDir(dir); len(files) != 1 {
+		t.Errorf("Temporary file should be removed: %v", files)
+	}
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if !strings.HasPrefix(rec.Header().Get("Content-Type"), "text/plain") || !strings.Contains(rec.Body.String(), "test_size 1\n") {
+		t.Errorf("Unexpected response: %s", rec.Body.String())
+	}
+}
+
+func TestObserveRun(t *testing.T) {
+	Default.Reset()
+	defer Default.Reset()
+
+	startedAt := time.Unix(1000, 0)
+	ObserveRun(startedAt, startedAt.Add(3*time.Second), 0)
+	ObserveRun(startedAt, startedAt.Add(5*time.Second), 2)
+
+	if Default.Get(RUNS, Labels{"result": "success"}) != 1 || Default.Get(RUNS, Labels{"result": "failure"}) != 1 {
+		t.Error("Unexpected runs")
+	}
+	if Default.Get(RUN_DURATION, nil) != 5 || Default.Get(LAST_RUN_EXIT_CODE, nil) != 2 || Default.Get(LAST_SUCCESS_TIMESTAMP, nil) != 1003 {
+		t.Error("Unexpected last run")
+	}
+}
+
+func TestRestoreLastSuccess(t *testing.T) {
+	Default.Reset()
+	defer Default.Reset()
+
+	dir, err := ioutil.TempDir("", "dcfg-metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	p := path.Join(dir, "dcfg.prom")
+
+	if err := RestoreLastSuccess(p); err != nil {
+		t.Errorf("Missing file should be ignored: %v", err)
+	}
+	startedAt := time.Unix(1000, 0)
+	ObserveRun(startedAt, startedAt.Add(3*time.Second), 0)
+	if err := Default.WriteFile(p); err != nil {
+		t.Fatal(err)
+	}
+
+	// Next process fails
+	Default.Reset()
+	if err := RestoreLastSuccess(p); err != nil {
+		t.Fatal(err)
+	}
+	ObserveRun(startedAt, startedAt.Add(10*time.Second), 2)
+	if err := Default.WriteFile(p); err != nil {
+		t.Fatal(err)
+	}
+	if v, found, err := ReadFileValue(p, LAST_SUCCESS_TIMESTAMP); err != nil || !found || v != 1003 {
+		t.Errorf("Last success should be kept: value[%v] found[%t] err[%v]", v, found, err)
+	}
+	if v, _, _ := ReadFileValue(p, LAST_RUN_TIMESTAMP); v != 1010 {
+		t.Errorf("Unexpected last run: %v", v)
+	}
+}
@@ -0,0 +1,161 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule of runs.
+type Schedule interface {
+	// Returns the time of the next run after `t`. Zero time if no more run.
+	Next(t time.Time) time.Time
+
+	// Description of the schedule for logs.
+	String() string
+}
+
+// Runs with fixed interval.
+type Interval struct {
+	Interval time.Duration
+}
+
+func (i *Interval) Next(t time.Time) time.Time {
+	return t.Add(i.Interval)
+}
+
+func (i *Interval) String() string {
+	return fmt.Sprintf("every %s", i.Interval)
+}
+
+// Runs on cron expression of five fields (minute, hour, day of month, month,
+// day of week). Fields accept `*`, numbers, ranges (`1-5`), steps (`*/15`,
+// `0-30/10`) and lists (`1,15`). Day of week is 0-7 (0 and 7 are Sunday).
+// Like cron, the day matches if either day of month or day of week matches,
+// when both fields are restricted.
+type Cron struct {
+	expr       string
+	minute     []bool
+	hour       []bool
+	dayOfMonth []bool
+	month      []bool
+	dayOfWeek  []bool
+
+	// True if the field does not start with `*` (e.g. `*` or `*/2`)
+	dayOfMonthRestricted bool
+	dayOfWeekRestricted  bool
+}
+
+// Years to look ahead for the next run. Expressions like `0 0 30 2 *` never match.
+const cronLookAheadYears = 5
+
+func ParseCron(expr string) (*Cron, error) {
+	fields := strings.Fields(expr)
+	if len(fields) != 5 {
+		return nil, errors.New(fmt.Sprintf("Cron expression requires 5 fields (minute hour day-of-month month day-of-week): [%s]", expr))
+	}
+	c := &Cron{expr: expr}
+	var err error
+	if c.minute, err = parseCronField(fields[0], 0, 59); err != nil {
+		return nil, err
+	}
+	if c.hour, err = parseCronField(fields[1], 0, 23); err != nil {
+		return nil, err
+	}
+	if c.dayOfMonth, err = parseCronField(fields[2], 1, 31); err != nil {
+		return nil, err
+	}
+	if c.month, err = parseCronField(fields[3], 1, 12); err != nil {
+		return nil, err
+	}
+	if c.dayOfWeek, err = parseCronField(fields[4], 0, 7); err != nil {
+		return nil, err
+	}
+	if c.dayOfWeek[7] {
+		c.dayOfWeek[0] = true
+	}
+	c.dayOfMonthRestricted = !strings.HasPrefix(fields[2], "*")
+	c.dayOfWeekRestricted = !strings.HasPrefix(fields[4], "*")
+	return c, nil
+}
+
+// Returns flags of matching values, indexed by the value.
+func parseCronField(field string, min, max int) ([]bool, error) {
+	values := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s < 1 {
+				return nil, errors.New(fmt.Sprintf("Invalid step in cron field: [%s]", field))
+			}
+			rangePart, step = part[:i], s
+		}
+
+		from, to := min, max
+		switch {
+		case rangePart == "*":
+		case strings.Contains(rangePart, "-"):
+			bounds := strings.SplitN(rangePart, "-", 2)
+			f, err1 := strconv.Atoi(bounds[0])
+			t, err2 := strconv.Atoi(bounds[1])
+			if err1 != nil || err2 != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid range in cron field: [%s]", field))
+			}
+			from, to = f, t
+		default:
+			v, err := strconv.Atoi(rangePart)
+			if err != nil {
+				return nil, errors.New(fmt.Sprintf("Invalid value in cron field: [%s]", field))
+			}
+			from, to = v, v
+			if step > 1 {
+				// `5/15` means from 5 to max by 15
+				to = max
+			}
+		}
+		if from < min || to > max || from > to {
+			return nil, errors.New(fmt.Sprintf("Out of range (%d-%d) in cron field: [%s]", min, max, field))
+		}
+		for v := from; v <= to; v += step {
+			values[v] = true
+		}
+	}
+	return values, nil
+}
+
+func (c *Cron) dayMatches(t time.Time) bool {
+	dom := c.dayOfMonth[t.Day()]
+	dow := c.dayOfWeek[int(t.Weekday())]
+	if c.dayOfMonthRestricted && c.dayOfWeekRestricted {
+		return dom || dow
+	}
+	return dom && dow
+}
+
+func (c *Cron) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(cronLookAheadYears, 0, 0)
+	for t.Before(limit) {
+		switch {
+		case !c.month[int(t.Month())]:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, loc)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, loc)
+		case !c.hour[t.Hour()]:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, loc)
+		case !c.minute[t.Minute()]:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *Cron) String() string {
+	return fmt.Sprintf("cron [%s]", c.expr)
+}
@@ -0,0 +1,65 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestInterval_Next(t *testing.T) {
+	base := time.Date(2016, 10, 1, 10, 20, 30, 0, time.UTC)
+	s := &Interval{Interval: 15 * time.Minute}
+	if n := s.Next(base); !n.Equal(base.Add(15 * time.Minute)) {
+		t.Errorf("Unexpected next run: %s", n)
+	}
+}
+
+func TestParseCron(t *testing.T) {
+	valid := []string{"* * * * *", "*/15 * * * *", "0 9-18 * * 1-5", "0,30 0 1,15 * *", "5/10 * * * 7"}
+	for _, x := range valid {
+		if _, err := ParseCron(x); err != nil {
+			t.Errorf("Expression should be valid: [%s] %v", x, err)
+		}
+	}
+	invalid := []string{"", "* * * *", "60 * * * *", "* 24 * * *", "* * 0 * *", "* * * 13 *", "* * * * 8", "*/0 * * * *", "a * * * *", "5-1 * * * *"}
+	for _, x := range invalid {
+		if _, err := ParseCron(x); err == nil {
+			t.Errorf("Expression should be invalid: [%s]", x)
+		}
+	}
+}
+
+func TestCron_Next(t *testing.T) {
+	// Saturday
+	base := time.Date(2016, 10, 1, 10, 20, 30, 0, time.UTC)
+	cases := map[string]time.Time{
+		"* * * * *":         time.Date(2016, 10, 1, 10, 21, 0, 0, time.UTC),
+		"*/15 * * * *":      time.Date(2016, 10, 1, 10, 30, 0, 0, time.UTC),
+		"0 * * * *":         time.Date(2016, 10, 1, 11, 0, 0, 0, time.UTC),
+		"30 2 * * *":        time.Date(2016, 10, 2, 2, 30, 0, 0, time.UTC),
+		"0 9 * * 1-5":       time.Date(2016, 10, 3, 9, 0, 0, 0, time.UTC),
+		"0 0 1 * *":         time.Date(2016, 11, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 1 1 *":         time.Date(2017, 1, 1, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 0":         time.Date(2016, 10, 2, 0, 0, 0, 0, time.UTC),
+		"0 0 * * 7":         time.Date(2016, 10, 2, 0, 0, 0, 0, time.UTC),
+		"0 0 15 * 1":        time.Date(2016, 10, 3, 0, 0, 0, 0, time.UTC),
+		"0 0 29 2 *":        time.Date(2020, 2, 29, 0, 0, 0, 0, time.UTC),
+		"20-25/5 10 1 10 *": time.Date(2016, 10, 1, 10, 25, 0, 0, time.UTC),
+		"0 0 */2 * 2":       time.Date(2016, 10, 11, 0, 0, 0, 0, time.UTC),
+		"0 0 15 * */2":      time.Date(2016, 10, 15, 0, 0, 0, 0, time.UTC),
+	}
+	for expr, expected := range cases {
+		c, err := ParseCron(expr)
+		if err != nil {
+			t.Errorf("Unable to parse: [%s] %v", expr, err)
+			continue
+		}
+		if n := c.Next(base); !n.Equal(expected) {
+			t.Errorf("Unexpected next run: [%s] expected[%s] actual[%s]", expr, expected, n)
+		}
+	}
+
+	c, _ := ParseCron("0 0 30 2 *")
+	if n := c.Next(base); !n.IsZero() {
+		t.Errorf("Expression should never match: %s", n)
+	}
+}
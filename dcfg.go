@@ -25,11 +25,16 @@ func main() {
 
 	explorer.Start(options, AppVersion)
 
-	defer seelog.Flush()
-
 	ec := context.ExecutionContext{
 		Options: options,
 	}
 
-	dispatch.Dispatch(ec)
+	var exitCode int
+	if options.Daemon {
+		exitCode = dispatch.DispatchDaemon(ec)
+	} else {
+		exitCode = dispatch.Dispatch(ec)
+	}
+	seelog.Flush()
+	os.Exit(exitCode)
 }
@@ -31,12 +31,22 @@ func TestIntegration(t *testing.T) {
 		t.Errorf("Fail: GetInfo: %v", err)
 	}
 
-	groupSync := groupsync.NewGroupSync(ctx)
-	groupSync.SyncFromList(ctx)
+	groupSync, err := groupsync.NewGroupSync(ctx)
+	if err != nil {
+		t.Fatalf("Fail: NewGroupSync: %v", err)
+	}
+	if err := groupSync.SyncFromList(ctx); err != nil {
+		t.Errorf("Fail: SyncFromList: %v", err)
+	}
 
-	userSync := usersync.NewUserSync(ctx)
+	userSync, err := usersync.NewUserSync(ctx)
+	if err != nil {
+		t.Fatalf("Fail: NewUserSync: %v", err)
+	}
 	userSync.SyncProvision()
-	userSync.SyncDeprovision()
+	if err := userSync.SyncDeprovision(); err != nil {
+		t.Errorf("Fail: SyncDeprovision: %v", err)
+	}
 
 	explorer.Report()
 }
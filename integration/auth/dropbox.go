@@ -30,10 +30,10 @@ func verifyDropboxToken(context context.ExecutionContext, token string) {
 	explorer.ReportSuccess("Verified token for Dropbox Team: TeamId[%s] TeamName[%s] Provisioned[%d] Num Licenses[%d]", team.TeamId, team.Name, team.NumProvisionedUsers, team.NumLicensedUsers)
 }
 
-func getDropboxTokenFromConsole() string {
+func getDropboxTokenFromConsole(permissionType string) string {
 	seelog.Flush()
 
-	fmt.Println("Dropbox Business API (permisson type: Team member management)")
+	fmt.Printf("Dropbox Business API (permisson type: %s)\n", permissionType)
 	fmt.Println("")
 	fmt.Println("------")
 	fmt.Println("Paste generated code here:")
@@ -49,12 +49,20 @@ func getDropboxTokenFromConsole() string {
 	return code
 }
 
-func updateDropboxToken(ctx context.ExecutionContext) {
-	token := getDropboxTokenFromConsole()
-	path := ctx.Options.PathDropboxToken()
-	dt := context.NewDropboxToken(token)
+// Load current tokens to keep the other token on update. Returns empty tokens if the file does not exist.
+func loadDropboxToken(path string) context.DropboxToken {
+	dt := context.DropboxToken{}
+	if !file.FileExist(path) {
+		return dt
+	}
+	if _, err := file.LoadJSON(path, &dt); err != nil {
+		seelog.Warnf("Unable to load current Dropbox token file, the file will be overwritten: file[%s] Err[%v]", path, err)
+		return context.DropboxToken{}
+	}
+	return dt
+}
 
-	verifyDropboxToken(ctx, token)
+func saveDropboxToken(path string, dt context.DropboxToken) {
 	err := file.SaveJSON(path, dt)
 	if err != nil {
 		seelog.Errorf("Unable to write Dropbox token file", path, err)
@@ -63,7 +71,33 @@ func updateDropboxToken(ctx context.ExecutionContext) {
 	explorer.ReportSuccess("Dropbox Token file updated: [%s]", path)
 }
 
+func updateDropboxToken(ctx context.ExecutionContext) {
+	token := getDropboxTokenFromConsole("Team member management")
+	path := ctx.Options.PathDropboxToken()
+	dt := loadDropboxToken(path)
+	dt.TeamManagementToken = token
+
+	verifyDropboxToken(ctx, token)
+	saveDropboxToken(path, dt)
+}
+
+func updateDropboxAuditToken(ctx context.ExecutionContext) {
+	token := getDropboxTokenFromConsole("Team auditing")
+	path := ctx.Options.PathDropboxToken()
+	dt := loadDropboxToken(path)
+	dt.TeamAuditingToken = token
+
+	verifyDropboxToken(ctx, token)
+	saveDropboxToken(path, dt)
+}
+
 func AuthDropbox(context context.ExecutionContext) {
 	seelog.Info("Start authentication sequence for Dropbox")
 	updateDropboxToken(context)
 }
+
+// Token for team events, which is used by the incremental sync.
+func AuthDropboxAudit(context context.ExecutionContext) {
+	seelog.Info("Start authentication sequence for Dropbox (Team auditing)")
+	updateDropboxAuditToken(context)
+}
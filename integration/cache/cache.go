@@ -0,0 +1,151 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/cihub/seelog"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+)
+
+// On-disk cache of API responses. Entries are stored as JSON files under
+// `Dir/<api>/`, one file per request. Nil store, or store without TTL, disables
+// the cache.
+type Store struct {
+	Dir string
+
+	// Entries are used without API calls within TTL.
+	TTL time.Duration
+
+	// Ignore cached entries, and replace them by the fresh data.
+	ForceRefresh bool
+}
+
+type entry struct {
+	Api       string          `json:"api"`
+	Request   string          `json:"request"`
+	ETag      string          `json:"etag,omitempty"`
+	FetchedAt time.Time       `json:"fetched_at"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Fetch the data from API, and returns ETag (or any validator) of the data.
+// `etag` is the ETag of the cached entry, or empty if not available. Returns
+// true as `notModified` if the cached entry is still valid (e.g. 304 Not Modified).
+type Fetcher func(etag string) (newEtag string, notModified bool, err error)
+
+var now = time.Now
+
+func (s *Store) Enabled() bool {
+	return s != nil && s.TTL > 0
+}
+
+// Load the data from the cache or `fetch`. `data` must be a pointer, and `fetch`
+// must store fetched data into `data`.
+func (s *Store) Load(api, request string, data interface{}, fetch Fetcher) error {
+	if !s.Enabled() {
+		_, _, err := fetch("")
+		return err
+	}
+
+	cached, found := s.get(api, request, data)
+	if found && !s.ForceRefresh && now().Sub(cached.FetchedAt) < s.TTL {
+		seelog.Tracef("Cache: Hit: Api[%s] Request[%s] FetchedAt[%s]", api, request, cached.FetchedAt)
+		return nil
+	}
+
+	etag := ""
+	if found && !s.ForceRefresh {
+		etag = cached.ETag
+	}
+	newEtag, notModified, err := fetch(etag)
+	if err != nil {
+		return err
+	}
+	if notModified && found {
+		seelog.Tracef("Cache: Not modified: Api[%s] Request[%s] ETag[%s]", api, request, etag)
+		cached.FetchedAt = now()
+		s.save(cached)
+		return nil
+	}
+
+	return s.put(api, request, newEtag, data)
+}
+
+// Store the data with the ETag.
+func (s *Store) put(api, request, etag string, data interface{}) error {
+	seelog.Tracef("Cache: Update: Api[%s] Request[%s] ETag[%s]", api, request, etag)
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	s.save(&entry{
+		Api:       api,
+		Request:   request,
+		ETag:      etag,
+		FetchedAt: now(),
+		Data:      raw,
+	})
+	return nil
+}
+
+func (s *Store) path(api, request string) string {
+	h := sha256.Sum256([]byte(request))
+	return path.Join(s.Dir, api, hex.EncodeToString(h[:])+".json")
+}
+
+// Returns the cached entry, and stores data of the entry into `data`.
+func (s *Store) get(api, request string, data interface{}) (*entry, bool) {
+	raw, err := ioutil.ReadFile(s.path(api, request))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			seelog.Warnf("Cache: Unable to read cache: Api[%s] Request[%s] Err[%v]", api, request, err)
+		}
+		return nil, false
+	}
+	e := &entry{}
+	if err := json.Unmarshal(raw, e); err != nil || e.Api != api || e.Request != request {
+		seelog.Warnf("Cache: Broken cache entry ignored: Api[%s] Request[%s] Err[%v]", api, request, err)
+		return nil, false
+	}
+	if err := json.Unmarshal(e.Data, data); err != nil {
+		seelog.Warnf("Cache: Broken cache entry ignored: Api[%s] Request[%s] Err[%v]", api, request, err)
+		return nil, false
+	}
+	return e, true
+}
+
+// Save the entry. Failure is not fatal because the data can be fetched again.
+func (s *Store) save(e *entry) {
+	p := s.path(e.Api, e.Request)
+	if err := os.MkdirAll(path.Dir(p), 0700); err != nil {
+		seelog.Warnf("Cache: Unable to create cache directory: Path[%s] Err[%v]", path.Dir(p), err)
+		return
+	}
+	raw, err := json.Marshal(e)
+	if err != nil {
+		seelog.Warnf("Cache: Unable to save cache: Api[%s] Request[%s] Err[%v]", e.Api, e.Request, err)
+		return
+	}
+
+	// Write into temporary file then rename, to avoid partially written entries.
+	tmp, err := ioutil.TempFile(path.Dir(p), "tmp-")
+	if err != nil {
+		seelog.Warnf("Cache: Unable to save cache: Api[%s] Request[%s] Err[%v]", e.Api, e.Request, err)
+		return
+	}
+	_, err = tmp.Write(raw)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), p)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		seelog.Warnf("Cache: Unable to save cache: Api[%s] Request[%s] Err[%v]", e.Api, e.Request, err)
+	}
+}
@@ -0,0 +1,145 @@
+package cache
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+)
+
+func newTestStore(t *testing.T) (*Store, func()) {
+	dir, err := ioutil.TempDir("", "dcfg-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &Store{Dir: dir, TTL: 10 * time.Minute}, func() {
+		os.RemoveAll(dir)
+		now = time.Now
+	}
+}
+
+// Returns fetcher which stores `value` into `data`, and records ETags of requests.
+func testFetcher(data *[]string, value []string, etag string, requestedEtags *[]string) Fetcher {
+	return func(requested string) (string, bool, error) {
+		*requestedEtags = append(*requestedEtags, requested)
+		if requested != "" && requested == etag {
+			return etag, true, nil
+		}
+		*data = value
+		return etag, false, nil
+	}
+}
+
+func TestStore_LoadTTL(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	base := time.Now()
+	now = func() time.Time { return base }
+
+	requested := make([]string, 0)
+	var d1 []string
+	if err := s.Load("google", "users", &d1, testFetcher(&d1, []string{"a"}, "", &requested)); err != nil {
+		t.Fatal(err)
+	}
+
+	now = func() time.Time { return base.Add(5 * time.Minute) }
+	var d2 []string
+	if err := s.Load("google", "users", &d2, testFetcher(&d2, []string{"b"}, "", &requested)); err != nil {
+		t.Fatal(err)
+	}
+	if len(requested) != 1 || len(d2) != 1 || d2[0] != "a" {
+		t.Errorf("Cached data should be used within TTL: data[%v] requested[%v]", d2, requested)
+	}
+
+	now = func() time.Time { return base.Add(15 * time.Minute) }
+	var d3 []string
+	if err := s.Load("google", "users", &d3, testFetcher(&d3, []string{"c"}, "", &requested)); err != nil {
+		t.Fatal(err)
+	}
+	if len(requested) != 2 || len(d3) != 1 || d3[0] != "c" {
+		t.Errorf("Expired data should be fetched: data[%v] requested[%v]", d3, requested)
+	}
+}
+
+func TestStore_LoadETag(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	base := time.Now()
+	now = func() time.Time { return base }
+
+	requested := make([]string, 0)
+	var d1 []string
+	s.Load("google", "members:g1", &d1, testFetcher(&d1, []string{"a"}, "etag1", &requested))
+
+	now = func() time.Time { return base.Add(15 * time.Minute) }
+	var d2 []string
+	if err := s.Load("google", "members:g1", &d2, testFetcher(&d2, []string{"b"}, "etag1", &requested)); err != nil {
+		t.Fatal(err)
+	}
+	if len(requested) != 2 || requested[1] != "etag1" || len(d2) != 1 || d2[0] != "a" {
+		t.Errorf("Cached data should be used if not modified: data[%v] requested[%v]", d2, requested)
+	}
+
+	// FetchedAt renewed by not modified response
+	now = func() time.Time { return base.Add(20 * time.Minute) }
+	var d3 []string
+	s.Load("google", "members:g1", &d3, testFetcher(&d3, []string{"c"}, "etag2", &requested))
+	if len(requested) != 2 || d3[0] != "a" {
+		t.Errorf("Cached data should be used within TTL: data[%v] requested[%v]", d3, requested)
+	}
+}
+
+func TestStore_ForceRefresh(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	requested := make([]string, 0)
+	var d1 []string
+	s.Load("google", "members:g1", &d1, testFetcher(&d1, []string{"a"}, "1", &requested))
+
+	s.ForceRefresh = true
+	var d2 []string
+	s.Load("google", "members:g1", &d2, testFetcher(&d2, []string{"b"}, "1", &requested))
+	if len(requested) != 2 || requested[1] != "" || d2[0] != "b" {
+		t.Errorf("Cached data should be ignored on force refresh: data[%v] requested[%v]", d2, requested)
+	}
+}
+
+func TestStore_LoadError(t *testing.T) {
+	s, cleanup := newTestStore(t)
+	defer cleanup()
+
+	var d []string
+	err := s.Load("google", "users", &d, func(etag string) (string, bool, error) {
+		return "", false, errors.New("backend error")
+	})
+	if err == nil {
+		t.Error("Error should be returned")
+	}
+	called := false
+	s.Load("google", "users", &d, func(etag string) (string, bool, error) {
+		called = true
+		return "", false, nil
+	})
+	if !called {
+		t.Error("Failed fetch should not be cached")
+	}
+}
+
+func TestStore_Disabled(t *testing.T) {
+	var s *Store
+	calls := 0
+	for i := 0; i < 2; i++ {
+		var d []string
+		s.Load("google", "users", &d, func(etag string) (string, bool, error) {
+			calls++
+			return "", false, nil
+		})
+	}
+	if calls != 2 {
+		t.Errorf("Nil store should not cache: calls[%d]", calls)
+	}
+}
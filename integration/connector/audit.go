@@ -0,0 +1,98 @@
+package connector
+
+import (
+	"fmt"
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli/explorer"
+)
+
+// Record of the audit log for each change executed on Dropbox.
+type AuditRecord struct {
+	RunId   string `json:"run_id"`
+	Trigger string `json:"trigger"`
+	Actor   string `json:"actor"`
+
+	Operation string `json:"operation"`
+	Email     string `json:"email,omitempty"`
+	GroupId   string `json:"group_id,omitempty"`
+	GroupName string `json:"group_name,omitempty"`
+
+	// Google directory state which requires the change
+	Evidence string `json:"evidence,omitempty"`
+
+	// Result of the Dropbox API call
+	Outcome    string `json:"outcome"`
+	ErrorClass string `json:"error_class,omitempty"`
+	Message    string `json:"message"`
+}
+
+// Evidence of i-th member of batch operations. Empty if not given.
+func EvidenceAt(evidence []string, i int) string {
+	if i < len(evidence) {
+		return evidence[i]
+	}
+	return ""
+}
+
+// Returns ERROR_KIND_AUDIT error if the record cannot be written.
+func (dps *DropboxConnectorImpl) audit(evidence string, target explorer.Target, outcome, errorClass, message string) error {
+	log := dps.ExecutionContext.AuditLog
+	if log == nil {
+		return nil
+	}
+	trigger := dps.ExecutionContext.Trigger
+	r := AuditRecord{
+		RunId:      trigger.RunId,
+		Trigger:    trigger.Trigger,
+		Actor:      trigger.Actor,
+		Operation:  target.Operation,
+		Email:      target.Email,
+		GroupId:    target.GroupId,
+		GroupName:  target.GroupName,
+		Evidence:   evidence,
+		Outcome:    outcome,
+		ErrorClass: errorClass,
+		Message:    message,
+	}
+	if err := log.Append(r); err != nil {
+		seelog.Errorf("Unable to write audit log: file[%s] record[%v] err[%v]", log.Path(), r, err)
+		explorer.ReportOperationFailure(target, ERROR_KIND_AUDIT, "Unable to write audit log: %s", message)
+		return &DropboxError{
+			Kind:      ERROR_KIND_AUDIT,
+			Operation: target.Operation,
+			Summary:   "audit_log_write_failed",
+			Err:       err,
+		}
+	}
+	return nil
+}
+
+// Report and audit the change succeeded. Returns error if the audit log cannot be written.
+func (dps *DropboxConnectorImpl) reportSuccess(evidence string, target explorer.Target, format string, values ...interface{}) error {
+	explorer.ReportOperationSuccess(target, format, values...)
+	return dps.audit(evidence, target, explorer.OUTCOME_SUCCESS, "", fmt.Sprintf(format, values...))
+}
+
+// Report and audit the change failed with err. Returns err, or error of the audit log
+// if the audit log cannot be written.
+func (dps *DropboxConnectorImpl) reportFailure(evidence string, target explorer.Target, err error, format string, values ...interface{}) error {
+	explorer.ReportOperationFailure(target, ErrorKind(err), format, values...)
+	if e := dps.audit(evidence, target, explorer.OUTCOME_FAILURE, ErrorKind(err), fmt.Sprintf(format, values...)); e != nil {
+		return e
+	}
+	return err
+}
+
+// Returns true if the batch must be aborted due to errors of executed members
+// (errs[start:end]). Errors of remaining members are filled with the error.
+func abortBatch(errs []error, start, end int) bool {
+	for _, err := range errs[start:end] {
+		if IsAbort(err) {
+			for i := end; i < len(errs); i++ {
+				errs[i] = err
+			}
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,114 @@
+package connector
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/watermint/dcfg/common/audit"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDropboxConnectorImpl_Audit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "audit.jsonl")
+	log, err := audit.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &batchClientMock{
+		alreadyOnTeam: map[string]bool{"b@example.com": true},
+	}
+	dc := newBatchConnector(client)
+	dc.ExecutionContext.AuditLog = log
+	dc.ExecutionContext.Trigger.RunId = "run-1"
+	dc.ExecutionContext.Trigger.Trigger = "cli"
+	dc.ExecutionContext.Trigger.Actor = "admin@host"
+
+	dc.MembersAddBatch([]NewMember{{Email: "a@example.com", Evidence: "e-a"}, {Email: "b@example.com", Evidence: "e-b"}})
+	dc.MembersAdd("c@example.com", "", "", "", "")
+	log.Close()
+
+	if n, err := audit.Verify(path); err != nil || n != 3 {
+		t.Errorf("Unexpected audit log: entries[%d] err[%v]", n, err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	records := make([]AuditRecord, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		e := audit.Entry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			t.Fatal(err)
+		}
+		r := AuditRecord{}
+		if err := json.Unmarshal(e.Record, &r); err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, r)
+	}
+	expected := []struct {
+		email    string
+		evidence string
+		outcome  string
+	}{
+		{"a@example.com", "e-a", "success"},
+		{"b@example.com", "e-b", "failure"},
+		{"c@example.com", "", "success"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("Unexpected records: %v", records)
+	}
+	for i, x := range expected {
+		r := records[i]
+		if r.Email != x.email || r.Evidence != x.evidence || r.Outcome != x.outcome {
+			t.Errorf("Unexpected record: %v", r)
+		}
+		if r.RunId != "run-1" || r.Trigger != "cli" || r.Actor != "admin@host" || r.Operation != "MembersAdd" {
+			t.Errorf("Unexpected trigger: %v", r)
+		}
+	}
+}
+
+func TestDropboxConnectorImpl_AuditFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	log, err := audit.Open(filepath.Join(dir, "audit.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Append fails after close
+	log.Close()
+
+	client := &batchClientMock{}
+	dc := newBatchConnector(client)
+	dc.ExecutionContext.AuditLog = log
+
+	members := make([]NewMember, 0)
+	for i := 0; i < dropboxMembersAddBatchSize+5; i++ {
+		members = append(members, NewMember{Email: fmt.Sprintf("a%d@example.com", i)})
+	}
+	errs := dc.MembersAddBatch(members)
+	if len(client.membersAddCalls) != 1 {
+		t.Errorf("Remaining batches should not be executed: %v", client.membersAddCalls)
+	}
+	for i, err := range errs {
+		if !IsAudit(err) {
+			t.Errorf("Audit error expected: member[%s] err[%v]", members[i].Email, err)
+		}
+	}
+}
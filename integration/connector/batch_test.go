@@ -0,0 +1,228 @@
+package connector
+
+import (
+	"fmt"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/async"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team"
+	"github.com/watermint/dcfg/integration/context"
+	"testing"
+	"time"
+)
+
+// Implements members/add and groups/members/add of team.Client. Other methods are not implemented.
+type batchClientMock struct {
+	team.Client
+
+	async           bool
+	alreadyOnTeam   map[string]bool
+	notInTeam       map[string]bool
+	membersAddCalls []int
+	groupAddCalls   []int
+	jobResults      map[string][]*team.MemberAddResult
+	jobPolls        int
+
+	// Status of group jobs: "in_progress", "complete" or error summary
+	groupJobStatus []string
+}
+
+func (c *batchClientMock) MembersAdd(arg *team.MembersAddArg) (*team.MembersAddLaunch, error) {
+	c.membersAddCalls = append(c.membersAddCalls, len(arg.NewMembers))
+	results := make([]*team.MemberAddResult, 0, len(arg.NewMembers))
+	for _, x := range arg.NewMembers {
+		if c.alreadyOnTeam[x.MemberEmail] {
+			results = append(results, &team.MemberAddResult{
+				Tagged:            dropbox.Tagged{Tag: "user_already_on_team"},
+				UserAlreadyOnTeam: x.MemberEmail,
+			})
+		} else {
+			results = append(results, &team.MemberAddResult{
+				Tagged: dropbox.Tagged{Tag: "success"},
+			})
+		}
+	}
+	if c.async {
+		jobId := fmt.Sprintf("job-%d", len(c.membersAddCalls))
+		c.jobResults[jobId] = results
+		return &team.MembersAddLaunch{
+			Tagged:     dropbox.Tagged{Tag: "async_job_id"},
+			AsyncJobId: jobId,
+		}, nil
+	}
+	return &team.MembersAddLaunch{
+		Tagged:   dropbox.Tagged{Tag: "complete"},
+		Complete: results,
+	}, nil
+}
+
+// Job completes on the second poll.
+func (c *batchClientMock) MembersAddJobStatusGet(arg *async.PollArg) (*team.MembersAddJobStatus, error) {
+	c.jobPolls++
+	if c.jobPolls < 2 {
+		return &team.MembersAddJobStatus{Tagged: dropbox.Tagged{Tag: "in_progress"}}, nil
+	}
+	return &team.MembersAddJobStatus{
+		Tagged:   dropbox.Tagged{Tag: "complete"},
+		Complete: c.jobResults[arg.AsyncJobId],
+	}, nil
+}
+
+func (c *batchClientMock) GroupsMembersAdd(arg *team.GroupMembersAddArg) (*team.GroupMembersChangeResult, error) {
+	c.groupAddCalls = append(c.groupAddCalls, len(arg.Members))
+	for _, x := range arg.Members {
+		if c.notInTeam[x.User.Email] {
+			return nil, endpointAPIError{dropbox.APIError{ErrorSummary: "users_not_found/..."}}
+		}
+	}
+	r := &team.GroupMembersChangeResult{
+		GroupInfo: &team.GroupFullInfo{GroupId: arg.Group.GroupId},
+	}
+	if c.async {
+		r.AsyncJobId = "group-job"
+	}
+	return r, nil
+}
+
+// Returns groupJobStatus in order, then keeps the last status.
+func (c *batchClientMock) GroupsJobStatusGet(arg *async.PollArg) (*async.PollEmptyResult, error) {
+	status := c.groupJobStatus[0]
+	if len(c.groupJobStatus) > 1 {
+		c.groupJobStatus = c.groupJobStatus[1:]
+	}
+	c.jobPolls++
+	switch status {
+	case "in_progress", "complete":
+		return &async.PollEmptyResult{Tagged: dropbox.Tagged{Tag: status}}, nil
+	default:
+		return nil, endpointAPIError{dropbox.APIError{ErrorSummary: status}}
+	}
+}
+
+func newBatchConnector(client team.Client) *DropboxConnectorImpl {
+	return &DropboxConnectorImpl{
+		ExecutionContext: context.ExecutionContext{
+			DropboxClient: client,
+		},
+	}
+}
+
+func TestDropboxConnectorImpl_MembersAddBatch(t *testing.T) {
+	client := &batchClientMock{
+		alreadyOnTeam: map[string]bool{"a3@example.com": true},
+	}
+	dc := newBatchConnector(client)
+
+	members := make([]NewMember, 0)
+	for i := 0; i < dropboxMembersAddBatchSize+5; i++ {
+		members = append(members, NewMember{Email: fmt.Sprintf("a%d@example.com", i)})
+	}
+	errs := dc.MembersAddBatch(members)
+	if len(client.membersAddCalls) != 2 || client.membersAddCalls[0] != dropboxMembersAddBatchSize || client.membersAddCalls[1] != 5 {
+		t.Errorf("Invalid batches: %v", client.membersAddCalls)
+	}
+	for i, err := range errs {
+		if i == 3 {
+			if !IsConflict(err) {
+				t.Errorf("Conflict expected: %v", err)
+			}
+		} else if err != nil {
+			t.Errorf("Unexpected error: member[%s] err[%v]", members[i].Email, err)
+		}
+	}
+}
+
+func TestDropboxConnectorImpl_MembersAddAsync(t *testing.T) {
+	jobSleep = func(d time.Duration) {}
+	defer func() { jobSleep = time.Sleep }()
+
+	client := &batchClientMock{
+		async:         true,
+		alreadyOnTeam: map[string]bool{"a@example.com": true},
+		jobResults:    make(map[string][]*team.MemberAddResult),
+	}
+	dc := newBatchConnector(client)
+	if err := dc.MembersAdd("a@example.com", "gn", "sn", "", ""); !IsConflict(err) {
+		t.Errorf("Result of the job expected: %v", err)
+	}
+	if client.jobPolls != 2 {
+		t.Errorf("Job should be polled until complete: %d", client.jobPolls)
+	}
+}
+
+func TestDropboxConnectorImpl_GroupsMembersAddBatch(t *testing.T) {
+	client := &batchClientMock{
+		notInTeam: map[string]bool{"b@example.com": true},
+	}
+	dc := newBatchConnector(client)
+
+	errs := dc.GroupsMembersAddBatch("g1", []string{"a@example.com", "b@example.com", "c@example.com"}, nil)
+	if errs[0] != nil || errs[2] != nil || !IsNotFound(errs[1]) {
+		t.Errorf("Invalid result: %v", errs)
+	}
+	// A batch, then one by one
+	if len(client.groupAddCalls) != 4 || client.groupAddCalls[0] != 3 {
+		t.Errorf("Invalid calls: %v", client.groupAddCalls)
+	}
+}
+
+func TestDropboxConnectorMock_BatchAbortOnAuthError(t *testing.T) {
+	mock := DropboxConnectorMock{}
+	mock.MockErrors = map[string]error{
+		mock.CreateOperationLog("GroupsMembersAdd", "g1", "b@example.com"): NewDropboxError(ERROR_KIND_AUTH, "GroupsMembersAdd", "invalid_access_token"),
+	}
+	errs := mock.GroupsMembersAddBatch("g1", []string{"a@example.com", "b@example.com", "c@example.com"}, nil)
+	if errs[0] != nil || !IsAuth(errs[1]) || !IsAuth(errs[2]) {
+		t.Errorf("Invalid result: %v", errs)
+	}
+	unexpected, missing, success := mock.AssertLogs([]string{
+		mock.CreateOperationLog("GroupsMembersAdd", "g1", "a@example.com"),
+		mock.CreateOperationLog("GroupsMembersAdd", "g1", "b@example.com"),
+	})
+	if !success {
+		t.Error("Batch should be aborted", unexpected, missing, success)
+	}
+}
+
+func TestDropboxConnectorImpl_GroupsMembersAddJob(t *testing.T) {
+	jobSleep = func(d time.Duration) {}
+	defer func() { jobSleep = time.Sleep }()
+
+	// Completed
+	client := &batchClientMock{
+		async:          true,
+		groupJobStatus: []string{"in_progress", "in_progress", "complete"},
+	}
+	dc := newBatchConnector(client)
+	if err := dc.GroupsMembersAdd("g1", "a@example.com", ""); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if client.jobPolls != 3 {
+		t.Errorf("Job should be polled until complete: %d", client.jobPolls)
+	}
+
+	// Failed
+	client = &batchClientMock{
+		async:          true,
+		groupJobStatus: []string{"in_progress", "access_error/..."},
+	}
+	dc = newBatchConnector(client)
+	errs := dc.GroupsMembersAddBatch("g1", []string{"a@example.com", "b@example.com"}, nil)
+	if errs[0] == nil || errs[1] == nil {
+		t.Errorf("Failure of the job should be reported for each member: %v", errs)
+	}
+
+	// Timed out
+	client = &batchClientMock{
+		async:          true,
+		groupJobStatus: []string{"in_progress"},
+	}
+	dc = newBatchConnector(client)
+	dc.ExecutionContext.Options.JobTimeout = 3 * jobPollInterval
+	err := dc.GroupsMembersAdd("g1", "a@example.com", "")
+	if e, ok := err.(*DropboxError); !ok || e.Summary != "async_job_timeout" {
+		t.Errorf("Timeout expected: %v", err)
+	}
+	if client.jobPolls != 4 {
+		t.Errorf("Invalid number of polls: %d", client.jobPolls)
+	}
+}
@@ -4,20 +4,54 @@ import (
 	"fmt"
 	"github.com/cihub/seelog"
 	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/async"
 	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team"
 	"github.com/watermint/dcfg/cli/explorer"
 	"github.com/watermint/dcfg/common/util"
 	"github.com/watermint/dcfg/integration/context"
+	"strings"
 )
 
+const (
+	// Number of members per call of batch operations
+	dropboxMembersAddBatchSize    = 20
+	dropboxGroupsMembersBatchSize = 20
+)
+
+// Operations against Dropbox. Methods return *DropboxError on failure,
+// see ErrorKind and IsConflict, IsNotFound etc. for classification.
+//
+// Evidence is the Google directory state which requires the change, and
+// recorded into the audit log with the outcome.
 type DropboxConnector interface {
-	GroupsCreate(groupName, groupExternalId string) string
-	GroupsUpdate(groupId, newGroupName string)
-	GroupsMembersAdd(groupId, accountEmail string)
-	GroupsMembersRemove(groupId, accountEmail string)
+	GroupsCreate(groupName, groupExternalId, evidence string) (string, error)
+	GroupsUpdate(groupId, newGroupName, evidence string) error
+	GroupsDelete(groupId, evidence string) error
+	GroupsMembersAdd(groupId, accountEmail, evidence string) error
+	GroupsMembersRemove(groupId, accountEmail, evidence string) error
+
+	MembersRemove(email string, wipeData bool, transferDestEmail, transferAdminEmail, evidence string) error
+	MembersSuspend(email, evidence string) error
+	MembersUnsuspend(email, evidence string) error
+	MembersAdd(email, givenName, surname, externalId, evidence string) error
+	MembersSetProfile(email, givenName, surname, evidence string) error
+	MembersSetEmail(email, newEmail, evidence string) error
+	MembersSetExternalId(email, externalId, evidence string) error
+
+	// Batch operations. Returns errors in the same order of arguments, nil for succeeded members.
+	// Evidence is in the same order of accountEmails.
+	GroupsMembersAddBatch(groupId string, accountEmails, evidence []string) []error
+	GroupsMembersRemoveBatch(groupId string, accountEmails, evidence []string) []error
+	MembersAddBatch(members []NewMember) []error
+}
 
-	MembersRemove(email string)
-	MembersAdd(email, givenName, surname string)
+// Member to be added by MembersAddBatch.
+type NewMember struct {
+	Email      string
+	GivenName  string
+	Surname    string
+	ExternalId string
+	Evidence   string
 }
 
 func CreateConnector(context context.ExecutionContext) DropboxConnector {
@@ -32,6 +66,9 @@ func CreateConnector(context context.ExecutionContext) DropboxConnector {
 
 type DropboxConnectorMock struct {
 	history []string
+
+	// Operation log (see CreateOperationLog) -> error returned from the operation.
+	MockErrors map[string]error
 }
 
 func (dpm *DropboxConnectorMock) ClearOperationHistory() {
@@ -56,34 +93,138 @@ func (dpm *DropboxConnectorMock) AssertLogs(expected []string) (unexpected []str
 	return unexpected, missing, len(unexpected) == 0 && len(missing) == 0
 }
 
-func (dpm *DropboxConnectorMock) enqueueOperationLog(operationName string, arguments ...string) {
-	dpm.history = append(dpm.history, dpm.CreateOperationLog(operationName, arguments...))
+func (dpm *DropboxConnectorMock) enqueueOperationLog(operationName string, arguments ...string) error {
+	log := dpm.CreateOperationLog(operationName, arguments...)
+	dpm.history = append(dpm.history, log)
+	return dpm.MockErrors[log]
 }
 
-func (dpm *DropboxConnectorMock) GroupsCreate(groupName, groupExternalId string) string {
-	dpm.enqueueOperationLog("GroupsCreate", groupName, groupExternalId)
-	explorer.ReportSuccess("Dropbox Group should be created: GroupName[%s] ExternalId[%s]", groupName, groupExternalId)
-	return fmt.Sprintf("mock-%s", groupExternalId)
+func (dpm *DropboxConnectorMock) GroupsCreate(groupName, groupExternalId, evidence string) (string, error) {
+	if err := dpm.enqueueOperationLog("GroupsCreate", groupName, groupExternalId); err != nil {
+		return "", err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "GroupsCreate", GroupName: groupName}, "Dropbox Group should be created: GroupName[%s] ExternalId[%s]", groupName, groupExternalId)
+	return fmt.Sprintf("mock-%s", groupExternalId), nil
 }
-func (dpm *DropboxConnectorMock) GroupsUpdate(groupId, newGroupName string) {
-	dpm.enqueueOperationLog("GroupsUpdate", groupId, newGroupName)
-	explorer.ReportSuccess("Dropbox Group should be updated: GroupId[%s] NewGroupName[%s]", groupId, newGroupName)
+func (dpm *DropboxConnectorMock) GroupsUpdate(groupId, newGroupName, evidence string) error {
+	if err := dpm.enqueueOperationLog("GroupsUpdate", groupId, newGroupName); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "GroupsUpdate", GroupId: groupId, GroupName: newGroupName}, "Dropbox Group should be updated: GroupId[%s] NewGroupName[%s]", groupId, newGroupName)
+	return nil
 }
-func (dpm *DropboxConnectorMock) GroupsMembersAdd(groupId, accountEmail string) {
-	dpm.enqueueOperationLog("GroupsMembersAdd", groupId, accountEmail)
-	explorer.ReportSuccess("Member should be added to Dropbox Group: GroupId[%s] Member[%s]", groupId, accountEmail)
+func (dpm *DropboxConnectorMock) GroupsDelete(groupId, evidence string) error {
+	if err := dpm.enqueueOperationLog("GroupsDelete", groupId); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "GroupsDelete", GroupId: groupId}, "Dropbox Group should be deleted: GroupId[%s]", groupId)
+	return nil
 }
-func (dpm *DropboxConnectorMock) GroupsMembersRemove(groupId, accountEmail string) {
-	dpm.enqueueOperationLog("GroupsMembersRemove", groupId, accountEmail)
-	explorer.ReportSuccess("Member should be removed from Dropbox Group: GroupId[%s] Member[%s]", groupId, accountEmail)
+func (dpm *DropboxConnectorMock) GroupsMembersAdd(groupId, accountEmail, evidence string) error {
+	if err := dpm.enqueueOperationLog("GroupsMembersAdd", groupId, accountEmail); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "GroupsMembersAdd", Email: accountEmail, GroupId: groupId}, "Member should be added to Dropbox Group: GroupId[%s] Member[%s]", groupId, accountEmail)
+	return nil
 }
-func (dpm *DropboxConnectorMock) MembersRemove(email string) {
-	dpm.enqueueOperationLog("MembersRemove", email)
-	explorer.ReportSuccess("Member account should be removed from Dropbox: Member[%s]", email)
+func (dpm *DropboxConnectorMock) GroupsMembersRemove(groupId, accountEmail, evidence string) error {
+	if err := dpm.enqueueOperationLog("GroupsMembersRemove", groupId, accountEmail); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "GroupsMembersRemove", Email: accountEmail, GroupId: groupId}, "Member should be removed from Dropbox Group: GroupId[%s] Member[%s]", groupId, accountEmail)
+	return nil
 }
-func (dpm *DropboxConnectorMock) MembersAdd(email, givenName, surname string) {
-	dpm.enqueueOperationLog("MembersAdd", email, givenName, surname)
-	explorer.ReportSuccess("Member account should be added to Dropbox: Email[%s] GivenName[%s] Surname[%s]", email, givenName, surname)
+func (dpm *DropboxConnectorMock) MembersRemove(email string, wipeData bool, transferDestEmail, transferAdminEmail, evidence string) error {
+	args := []string{email}
+	if wipeData {
+		args = append(args, "wipe_data")
+	}
+	if transferDestEmail != "" {
+		args = append(args, transferDestEmail, transferAdminEmail)
+	}
+	if err := dpm.enqueueOperationLog("MembersRemove", args...); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "MembersRemove", Email: email}, "Member account should be removed from Dropbox: Member[%s] WipeData[%t] TransferTo[%s]", email, wipeData, transferDestEmail)
+	return nil
+}
+func (dpm *DropboxConnectorMock) MembersSuspend(email, evidence string) error {
+	if err := dpm.enqueueOperationLog("MembersSuspend", email); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "MembersSuspend", Email: email}, "Member account should be suspended on Dropbox: Member[%s]", email)
+	return nil
+}
+func (dpm *DropboxConnectorMock) MembersUnsuspend(email, evidence string) error {
+	if err := dpm.enqueueOperationLog("MembersUnsuspend", email); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "MembersUnsuspend", Email: email}, "Member account should be unsuspended on Dropbox: Member[%s]", email)
+	return nil
+}
+func (dpm *DropboxConnectorMock) MembersAdd(email, givenName, surname, externalId, evidence string) error {
+	args := []string{email, givenName, surname}
+	if externalId != "" {
+		args = append(args, externalId)
+	}
+	if err := dpm.enqueueOperationLog("MembersAdd", args...); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "MembersAdd", Email: email}, "Member account should be added to Dropbox: Email[%s] GivenName[%s] Surname[%s]", email, givenName, surname)
+	return nil
+}
+
+func (dpm *DropboxConnectorMock) MembersSetProfile(email, givenName, surname, evidence string) error {
+	if err := dpm.enqueueOperationLog("MembersSetProfile", email, givenName, surname); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "MembersSetProfile", Email: email}, "Member profile should be updated on Dropbox: Email[%s] GivenName[%s] Surname[%s]", email, givenName, surname)
+	return nil
+}
+func (dpm *DropboxConnectorMock) MembersSetEmail(email, newEmail, evidence string) error {
+	if err := dpm.enqueueOperationLog("MembersSetEmail", email, newEmail); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "MembersSetEmail", Email: email}, "Member email should be changed on Dropbox: Email[%s] NewEmail[%s]", email, newEmail)
+	return nil
+}
+func (dpm *DropboxConnectorMock) MembersSetExternalId(email, externalId, evidence string) error {
+	if err := dpm.enqueueOperationLog("MembersSetExternalId", email, externalId); err != nil {
+		return err
+	}
+	explorer.ReportOperationSuccess(explorer.Target{Operation: "MembersSetExternalId", Email: email}, "Member external ID should be updated on Dropbox: Email[%s] ExternalId[%s]", email, externalId)
+	return nil
+}
+
+// Execute f for each member, and stop on auth error as the connector does.
+func (dpm *DropboxConnectorMock) batch(n int, f func(i int) error) []error {
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		errs[i] = f(i)
+		if IsAbort(errs[i]) {
+			for j := i + 1; j < n; j++ {
+				errs[j] = errs[i]
+			}
+			break
+		}
+	}
+	return errs
+}
+func (dpm *DropboxConnectorMock) GroupsMembersAddBatch(groupId string, accountEmails, evidence []string) []error {
+	return dpm.batch(len(accountEmails), func(i int) error {
+		return dpm.GroupsMembersAdd(groupId, accountEmails[i], "")
+	})
+}
+func (dpm *DropboxConnectorMock) GroupsMembersRemoveBatch(groupId string, accountEmails, evidence []string) []error {
+	return dpm.batch(len(accountEmails), func(i int) error {
+		return dpm.GroupsMembersRemove(groupId, accountEmails[i], "")
+	})
+}
+func (dpm *DropboxConnectorMock) MembersAddBatch(members []NewMember) []error {
+	return dpm.batch(len(members), func(i int) error {
+		x := members[i]
+		return dpm.MembersAdd(x.Email, x.GivenName, x.Surname, x.ExternalId, x.Evidence)
+	})
 }
 
 type DropboxConnectorImpl struct {
@@ -113,136 +254,456 @@ func (dps *DropboxConnectorImpl) createMemberAccess(accountEmail string) *team.M
 	}
 }
 
-func (dps *DropboxConnectorImpl) GroupsCreate(groupName, groupExternalId string) string {
+func (dps *DropboxConnectorImpl) GroupsCreate(groupName, groupExternalId, evidence string) (string, error) {
 	client := dps.ExecutionContext.DropboxClient
 	a := team.GroupCreateArg{
 		GroupName:       groupName,
 		GroupExternalId: groupExternalId,
 	}
-	g, err := client.GroupsCreate(&a)
+	var g *team.GroupFullInfo
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "GroupsCreate", func() (err error) {
+		g, err = client.GroupsCreate(&a)
+		return
+	})
 	if err != nil {
 		seelog.Warnf("Unable to create Dropbox Group: GroupName[%s] ExternalId[%s] Err[%s]", groupName, groupExternalId, err)
-		explorer.ReportFailure("Unable to create Dropbox Group: GroupName[%s] ExternalId[%s]", groupName, groupExternalId)
-		return ""
+		return "", dps.reportFailure(evidence, explorer.Target{Operation: "GroupsCreate", GroupName: groupName}, err, "Unable to create Dropbox Group: GroupName[%s] ExternalId[%s] (%s)", groupName, groupExternalId, ErrorKind(err))
 	} else {
 		seelog.Tracef("Dropbox Group Created: GroupId[%s] GroupName[%s] ExternalId[%s]", g.GroupId, g.GroupName, g.GroupExternalId)
-		explorer.ReportSuccess("Dropbox Group Created: GroupId[%s] GroupName[%s] ExternalId[%s]", g.GroupId, g.GroupName, g.GroupExternalId)
-		return g.GroupId
+		return g.GroupId, dps.reportSuccess(evidence, explorer.Target{Operation: "GroupsCreate", GroupId: g.GroupId, GroupName: g.GroupName}, "Dropbox Group Created: GroupId[%s] GroupName[%s] ExternalId[%s]", g.GroupId, g.GroupName, g.GroupExternalId)
 	}
 }
 
-func (dps *DropboxConnectorImpl) GroupsUpdate(groupId, newGroupName string) {
+func (dps *DropboxConnectorImpl) GroupsUpdate(groupId, newGroupName, evidence string) error {
 	client := dps.ExecutionContext.DropboxClient
 
 	a := &team.GroupUpdateArgs{
 		Group:        dps.createGroupSelector(groupId),
 		NewGroupName: newGroupName,
 	}
-	g, err := client.GroupsUpdate(a)
+	var g *team.GroupFullInfo
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "GroupsUpdate", func() (err error) {
+		g, err = client.GroupsUpdate(a)
+		return
+	})
 	if err != nil {
-		seelog.Warnf("Unable to update Dropbox Group: GroupId[%s] NewGroupname[%s] Err[%s]", err)
-		explorer.ReportFailure("Unable to update Dropbox Group: GroupId[%s] NewGroupName[%s]", groupId, newGroupName)
-	} else {
-		seelog.Tracef("Dropbox Group Update: GroupId[%s] GroupName[%s] ExternalId[%s]")
-		explorer.ReportSuccess("Dropbox Group Updated: GroupId[%s] GroupName[%s] ExternalId[%s]", g.GroupId, g.GroupName, g.GroupExternalId)
+		seelog.Warnf("Unable to update Dropbox Group: GroupId[%s] NewGroupname[%s] Err[%s]", groupId, newGroupName, err)
+		return dps.reportFailure(evidence, explorer.Target{Operation: "GroupsUpdate", GroupId: groupId, GroupName: newGroupName}, err, "Unable to update Dropbox Group: GroupId[%s] NewGroupName[%s] (%s)", groupId, newGroupName, ErrorKind(err))
 	}
+	seelog.Tracef("Dropbox Group Update: GroupId[%s] GroupName[%s] ExternalId[%s]", g.GroupId, g.GroupName, g.GroupExternalId)
+	return dps.reportSuccess(evidence, explorer.Target{Operation: "GroupsUpdate", GroupId: g.GroupId, GroupName: g.GroupName}, "Dropbox Group Updated: GroupId[%s] GroupName[%s] ExternalId[%s]", g.GroupId, g.GroupName, g.GroupExternalId)
 }
 
-func (dps *DropboxConnectorImpl) GroupsMembersAdd(groupId, accountEmail string) {
+func (dps *DropboxConnectorImpl) GroupsDelete(groupId, evidence string) error {
 	client := dps.ExecutionContext.DropboxClient
 
-	m := []*team.MemberAccess{dps.createMemberAccess(accountEmail)}
-	a := &team.GroupMembersAddArg{
-		Group:   dps.createGroupSelector(groupId),
-		Members: m,
+	var r *async.LaunchEmptyResult
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "GroupsDelete", func() (err error) {
+		r, err = client.GroupsDelete(dps.createGroupSelector(groupId))
+		return
+	})
+	if err == nil {
+		err = dps.waitEmptyJob("GroupsDelete", r.AsyncJobId, client.GroupsJobStatusGet)
 	}
-	r, err := client.GroupsMembersAdd(a)
 	if err != nil {
-		seelog.Warnf("Unable to add member to Dropbox Group: GroupId[%s] AccountEmail[%s] Err[%s]", groupId, accountEmail, err)
-		explorer.ReportFailure("Unable to add member to Dropbox Group: GroupId[%s] Email[%s]", groupId, accountEmail)
-	} else {
-		seelog.Tracef("Dropbox Group: Member added (Queued): GroupId[%s] GroupName[%s] AccountEmail[%s] AsyncJobId[%s]", r.GroupInfo.GroupId, r.GroupInfo.GroupName, accountEmail, r.AsyncJobId)
-		explorer.ReportSuccess("Dropbox Group: Member added: GroupId[%s] GroupName[%s] AccountEmail[%s]", r.GroupInfo.GroupId, r.GroupInfo.GroupName, accountEmail)
+		seelog.Warnf("Unable to delete Dropbox Group: GroupId[%s] Err[%s]", groupId, err)
+		return dps.reportFailure(evidence, explorer.Target{Operation: "GroupsDelete", GroupId: groupId}, err, "Unable to delete Dropbox Group: GroupId[%s] (%s)", groupId, ErrorKind(err))
 	}
+	seelog.Tracef("Dropbox Group deleted: GroupId[%s] AsyncJobId[%s]", groupId, r.AsyncJobId)
+	return dps.reportSuccess(evidence, explorer.Target{Operation: "GroupsDelete", GroupId: groupId}, "Dropbox Group deleted: GroupId[%s]", groupId)
+}
+
+func (dps *DropboxConnectorImpl) GroupsMembersAdd(groupId, accountEmail, evidence string) error {
+	return dps.GroupsMembersAddBatch(groupId, []string{accountEmail}, []string{evidence})[0]
 }
 
-func (dps *DropboxConnectorImpl) GroupsMembersRemove(groupId, accountEmail string) {
+func (dps *DropboxConnectorImpl) GroupsMembersRemove(groupId, accountEmail, evidence string) error {
+	return dps.GroupsMembersRemoveBatch(groupId, []string{accountEmail}, []string{evidence})[0]
+}
+
+// Dropbox rejects entire request if one of members is not applicable (e.g. not in the team).
+// Returns true if the batch should be retried one by one to identify the member.
+func shouldSplitBatch(err error, batchSize int) bool {
+	if batchSize < 2 {
+		return false
+	}
+	if e, ok := err.(*DropboxError); ok && strings.Contains(e.Summary, "group_not_found") {
+		return false
+	}
+	return IsConflict(err) || IsNotFound(err)
+}
+
+func (dps *DropboxConnectorImpl) GroupsMembersAddBatch(groupId string, accountEmails, evidence []string) []error {
 	client := dps.ExecutionContext.DropboxClient
+	errs := make([]error, len(accountEmails))
+
+	for start := 0; start < len(accountEmails); start += dropboxGroupsMembersBatchSize {
+		end := start + dropboxGroupsMembersBatchSize
+		if end > len(accountEmails) {
+			end = len(accountEmails)
+		}
+		chunk := accountEmails[start:end]
 
-	a := &team.GroupMembersRemoveArg{
-		Group: dps.createGroupSelector(groupId),
-		Users: []*team.UserSelectorArg{dps.createUserSelectArg(accountEmail)},
+		m := make([]*team.MemberAccess, 0, len(chunk))
+		for _, x := range chunk {
+			m = append(m, dps.createMemberAccess(x))
+		}
+		a := &team.GroupMembersAddArg{
+			Group:   dps.createGroupSelector(groupId),
+			Members: m,
+		}
+		seelog.Tracef("Adding members to Dropbox Group: GroupId[%s] AccountEmails[%s]", groupId, strings.Join(chunk, ","))
+		var r *team.GroupMembersChangeResult
+		err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "GroupsMembersAdd", func() (err error) {
+			r, err = client.GroupsMembersAdd(a)
+			return
+		})
+		if err == nil {
+			err = dps.waitEmptyJob("GroupsMembersAdd", r.AsyncJobId, client.GroupsJobStatusGet)
+		}
+		if err != nil && shouldSplitBatch(err, len(chunk)) {
+			seelog.Tracef("Batch rejected, add members one by one: GroupId[%s] Err[%s]", groupId, err)
+			for i, x := range chunk {
+				errs[start+i] = dps.GroupsMembersAdd(groupId, x, EvidenceAt(evidence, start+i))
+				if abortBatch(errs, start+i, start+i+1) {
+					return errs
+				}
+			}
+			continue
+		}
+		for i, x := range chunk {
+			if err != nil {
+				seelog.Warnf("Unable to add member to Dropbox Group: GroupId[%s] AccountEmail[%s] Err[%s]", groupId, x, err)
+				errs[start+i] = dps.reportFailure(EvidenceAt(evidence, start+i), explorer.Target{Operation: "GroupsMembersAdd", Email: x, GroupId: groupId}, err, "Unable to add member to Dropbox Group: GroupId[%s] Email[%s] (%s)", groupId, x, ErrorKind(err))
+				continue
+			}
+			seelog.Tracef("Dropbox Group: Member added: GroupId[%s] GroupName[%s] AccountEmail[%s] AsyncJobId[%s]", r.GroupInfo.GroupId, r.GroupInfo.GroupName, x, r.AsyncJobId)
+			errs[start+i] = dps.reportSuccess(EvidenceAt(evidence, start+i), explorer.Target{Operation: "GroupsMembersAdd", Email: x, GroupId: r.GroupInfo.GroupId, GroupName: r.GroupInfo.GroupName}, "Dropbox Group: Member added: GroupId[%s] GroupName[%s] AccountEmail[%s]", r.GroupInfo.GroupId, r.GroupInfo.GroupName, x)
+		}
+		if abortBatch(errs, start, end) {
+			break
+		}
 	}
-	r, err := client.GroupsMembersRemove(a)
-	if err != nil {
-		seelog.Warnf("Unable to remove member form Dropbox Group: GroupId[%s] AccountEmail[%s] Err[%s]", groupId, accountEmail, err)
-		explorer.ReportFailure("Unable to remove member from Dropbox Group: GroupId[%s] AccountEmail[%s]", groupId, accountEmail)
-	} else {
-		seelog.Tracef("Dropbox Group: Member removed (queued): GroupId[%s] GroupName[%s] AccountEmail[%s] AsyncJobId[%s]", r.GroupInfo, r.GroupInfo.GroupName, accountEmail, r.AsyncJobId)
-		explorer.ReportSuccess("Dropbox Group: Member removed: GroupId[%s] GroupName[%s] AccountEmail[%s]", r.GroupInfo.GroupId, r.GroupInfo.GroupName, accountEmail)
+	return errs
+}
+
+func (dps *DropboxConnectorImpl) GroupsMembersRemoveBatch(groupId string, accountEmails, evidence []string) []error {
+	client := dps.ExecutionContext.DropboxClient
+	errs := make([]error, len(accountEmails))
+
+	for start := 0; start < len(accountEmails); start += dropboxGroupsMembersBatchSize {
+		end := start + dropboxGroupsMembersBatchSize
+		if end > len(accountEmails) {
+			end = len(accountEmails)
+		}
+		chunk := accountEmails[start:end]
+
+		u := make([]*team.UserSelectorArg, 0, len(chunk))
+		for _, x := range chunk {
+			u = append(u, dps.createUserSelectArg(x))
+		}
+		a := &team.GroupMembersRemoveArg{
+			Group: dps.createGroupSelector(groupId),
+			Users: u,
+		}
+		seelog.Tracef("Removing members from Dropbox Group: GroupId[%s] AccountEmails[%s]", groupId, strings.Join(chunk, ","))
+		var r *team.GroupMembersChangeResult
+		err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "GroupsMembersRemove", func() (err error) {
+			r, err = client.GroupsMembersRemove(a)
+			return
+		})
+		if err == nil {
+			err = dps.waitEmptyJob("GroupsMembersRemove", r.AsyncJobId, client.GroupsJobStatusGet)
+		}
+		if err != nil && shouldSplitBatch(err, len(chunk)) {
+			seelog.Tracef("Batch rejected, remove members one by one: GroupId[%s] Err[%s]", groupId, err)
+			for i, x := range chunk {
+				errs[start+i] = dps.GroupsMembersRemove(groupId, x, EvidenceAt(evidence, start+i))
+				if abortBatch(errs, start+i, start+i+1) {
+					return errs
+				}
+			}
+			continue
+		}
+		for i, x := range chunk {
+			if err != nil {
+				seelog.Warnf("Unable to remove member form Dropbox Group: GroupId[%s] AccountEmail[%s] Err[%s]", groupId, x, err)
+				errs[start+i] = dps.reportFailure(EvidenceAt(evidence, start+i), explorer.Target{Operation: "GroupsMembersRemove", Email: x, GroupId: groupId}, err, "Unable to remove member from Dropbox Group: GroupId[%s] AccountEmail[%s] (%s)", groupId, x, ErrorKind(err))
+				continue
+			}
+			seelog.Tracef("Dropbox Group: Member removed: GroupId[%s] GroupName[%s] AccountEmail[%s] AsyncJobId[%s]", r.GroupInfo.GroupId, r.GroupInfo.GroupName, x, r.AsyncJobId)
+			errs[start+i] = dps.reportSuccess(EvidenceAt(evidence, start+i), explorer.Target{Operation: "GroupsMembersRemove", Email: x, GroupId: r.GroupInfo.GroupId, GroupName: r.GroupInfo.GroupName}, "Dropbox Group: Member removed: GroupId[%s] GroupName[%s] AccountEmail[%s]", r.GroupInfo.GroupId, r.GroupInfo.GroupName, x)
+		}
+		if abortBatch(errs, start, end) {
+			break
+		}
 	}
+	return errs
 }
 
-func (dps *DropboxConnectorImpl) MembersRemove(email string) {
+// Returns nil if the member is not a team admin. Returns error with failure report
+// if the member is a team admin, or the member info is not available.
+func (dps *DropboxConnectorImpl) verifyNotTeamAdmin(evidence, email, operation, operationName string) error {
 	client := dps.ExecutionContext.DropboxClient
 
 	m := team.MembersGetInfoArgs{
 		Members: []*team.UserSelectorArg{dps.createUserSelectArg(email)},
 	}
-	u, err := client.MembersGetInfo(&m)
+	var u []*team.MembersGetInfoItem
+	err := Call(dps.ExecutionContext.RetryPolicy(), operationName, func() (err error) {
+		u, err = client.MembersGetInfo(&m)
+		return
+	})
 	if err != nil {
 		seelog.Warnf("Unable to load Dropbox member: Email[%s] Err[%s]", email, err)
-		explorer.ReportFailure("Unable to remove member Dropbox account: Email[%s] (due to failed to load member info)", email)
-		return
+		return dps.reportFailure(evidence, explorer.Target{Operation: operationName, Email: email}, err, "Unable to %s member Dropbox account: Email[%s] (due to failed to load member info)", operation, email)
 	}
-	if len(u) != 1 {
+	if len(u) != 1 || u[0].MemberInfo == nil {
 		seelog.Warnf("Unable to load Dropbox member: Email[%s] [%v]", email, u)
-		explorer.ReportFailure("Unable to remove member Dropbox account: Email[%s] (due to failed to load member info)", email)
-		return
-	} else {
-		if u[0].MemberInfo.Role.Tag == "team_admin" {
-			seelog.Warnf("Team Admin should not be removed by script: Email[%s]", email)
-			explorer.ReportFailure("Unable to remove Dropbox Team Admin account: Email[%s]", email)
-			return
-		}
+		return dps.reportFailure(evidence, explorer.Target{Operation: operationName, Email: email}, NewDropboxError(ERROR_KIND_NOT_FOUND, operationName, "user_not_found"), "Unable to %s member Dropbox account: Email[%s] (due to failed to load member info)", operation, email)
+	}
+	if u[0].MemberInfo.Role.Tag == "team_admin" {
+		seelog.Warnf("Team Admin should not be %sd by script: Email[%s]", operation, email)
+		return dps.reportFailure(evidence, explorer.Target{Operation: operationName, Email: email}, NewDropboxError(ERROR_KIND_OTHER, operationName, "team_admin"), "Unable to %s Dropbox Team Admin account: Email[%s]", operation, email)
+	}
+	return nil
+}
+
+func (dps *DropboxConnectorImpl) MembersRemove(email string, wipeData bool, transferDestEmail, transferAdminEmail, evidence string) error {
+	client := dps.ExecutionContext.DropboxClient
+
+	if err := dps.verifyNotTeamAdmin(evidence, email, "remove", "MembersRemove"); err != nil {
+		return err
 	}
 
 	a := team.MembersRemoveArg{
 		MembersDeactivateArg: team.MembersDeactivateArg{
 			User:     dps.createUserSelectArg(email),
-			WipeData: false,
+			WipeData: wipeData,
 		},
 		KeepAccount: false,
 	}
-	r, err := client.MembersRemove(&a)
+	if transferDestEmail != "" {
+		a.TransferDestId = dps.createUserSelectArg(transferDestEmail)
+		a.TransferAdminId = dps.createUserSelectArg(transferAdminEmail)
+	}
+	var r *async.LaunchEmptyResult
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "MembersRemove", func() (err error) {
+		r, err = client.MembersRemove(&a)
+		return
+	})
+	if err == nil {
+		err = dps.waitEmptyJob("MembersRemove", r.AsyncJobId, client.MembersRemoveJobStatusGet)
+	}
 	if err != nil {
-		seelog.Warnf("Unable to remove member Dropbox account: Email[%s] Err[%s]", email, err)
-		explorer.ReportFailure("Unable to remove member Dropbox account: Email[%s]", email)
-	} else {
-		seelog.Tracef("Remove Dropbox account: Email[%s] Tag[%s]", email, r.Tag)
-		explorer.ReportSuccess("Remove Dropbox account: Email[%s]", email)
+		seelog.Warnf("Unable to remove member Dropbox account: Email[%s] WipeData[%t] TransferTo[%s] Err[%s]", email, wipeData, transferDestEmail, err)
+		return dps.reportFailure(evidence, explorer.Target{Operation: "MembersRemove", Email: email}, err, "Unable to remove member Dropbox account: Email[%s] (%s)", email, ErrorKind(err))
 	}
+	seelog.Tracef("Remove Dropbox account: Email[%s] WipeData[%t] TransferTo[%s] AsyncJobId[%s]", email, wipeData, transferDestEmail, r.AsyncJobId)
+	return dps.reportSuccess(evidence, explorer.Target{Operation: "MembersRemove", Email: email}, "Remove Dropbox account: Email[%s] WipeData[%t] TransferTo[%s]", email, wipeData, transferDestEmail)
 }
 
-func (dps *DropboxConnectorImpl) MembersAdd(email, givenName, surname string) {
+func (dps *DropboxConnectorImpl) MembersSuspend(email, evidence string) error {
 	client := dps.ExecutionContext.DropboxClient
 
-	a := team.MembersAddArg{
-		NewMembers: []*team.MemberAddArg{
-			&team.MemberAddArg{
-				MemberEmail:     email,
-				MemberGivenName: givenName,
-				MemberSurname:   surname,
-				Role:            &team.AdminTier{Tagged: dropbox.Tagged{Tag: "member_only"}},
-			},
+	if err := dps.verifyNotTeamAdmin(evidence, email, "suspend", "MembersSuspend"); err != nil {
+		return err
+	}
+
+	a := team.MembersDeactivateArg{
+		User:     dps.createUserSelectArg(email),
+		WipeData: false,
+	}
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "MembersSuspend", func() error {
+		return client.MembersSuspend(&a)
+	})
+	if err != nil {
+		seelog.Warnf("Unable to suspend member Dropbox account: Email[%s] Err[%s]", email, err)
+		return dps.reportFailure(evidence, explorer.Target{Operation: "MembersSuspend", Email: email}, err, "Unable to suspend member Dropbox account: Email[%s] (%s)", email, ErrorKind(err))
+	}
+	seelog.Tracef("Suspend Dropbox account: Email[%s]", email)
+	return dps.reportSuccess(evidence, explorer.Target{Operation: "MembersSuspend", Email: email}, "Suspend Dropbox account: Email[%s]", email)
+}
+
+func (dps *DropboxConnectorImpl) MembersUnsuspend(email, evidence string) error {
+	client := dps.ExecutionContext.DropboxClient
+
+	a := team.MembersUnsuspendArg{
+		User: dps.createUserSelectArg(email),
+	}
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "MembersUnsuspend", func() error {
+		return client.MembersUnsuspend(&a)
+	})
+	if err != nil {
+		seelog.Warnf("Unable to unsuspend member Dropbox account: Email[%s] Err[%s]", email, err)
+		return dps.reportFailure(evidence, explorer.Target{Operation: "MembersUnsuspend", Email: email}, err, "Unable to unsuspend member Dropbox account: Email[%s] (%s)", email, ErrorKind(err))
+	}
+	seelog.Tracef("Unsuspend Dropbox account: Email[%s]", email)
+	return dps.reportSuccess(evidence, explorer.Target{Operation: "MembersUnsuspend", Email: email}, "Unsuspend Dropbox account: Email[%s]", email)
+}
+
+// Convert per-member result of members/add into error.
+func memberAddResultError(r *team.MemberAddResult) error {
+	if r == nil || r.Tag == "success" {
+		return nil
+	}
+	return NewDropboxError(classifyErrorTag(r.Tag), "MembersAdd", r.Tag)
+}
+
+func (dps *DropboxConnectorImpl) MembersAdd(email, givenName, surname, externalId, evidence string) error {
+	return dps.MembersAddBatch([]NewMember{
+		{
+			Email:      email,
+			GivenName:  givenName,
+			Surname:    surname,
+			ExternalId: externalId,
+			Evidence:   evidence,
 		},
+	})[0]
+}
+
+func (dps *DropboxConnectorImpl) MembersAddBatch(members []NewMember) []error {
+	errs := make([]error, len(members))
+
+	for start := 0; start < len(members); start += dropboxMembersAddBatchSize {
+		end := start + dropboxMembersAddBatchSize
+		if end > len(members) {
+			end = len(members)
+		}
+		chunk := members[start:end]
+
+		a := team.MembersAddArg{
+			NewMembers: make([]*team.MemberAddArg, 0, len(chunk)),
+		}
+		for _, x := range chunk {
+			a.NewMembers = append(a.NewMembers, &team.MemberAddArg{
+				MemberEmail:      x.Email,
+				MemberGivenName:  x.GivenName,
+				MemberSurname:    x.Surname,
+				MemberExternalId: x.ExternalId,
+				Role:             &team.AdminTier{Tagged: dropbox.Tagged{Tag: "member_only"}},
+			})
+		}
+		results, err := dps.membersAdd(&a)
+		if err == nil && len(results) != len(chunk) {
+			err = NewDropboxError(ERROR_KIND_OTHER, "MembersAdd", fmt.Sprintf("unexpected number of results: %d", len(results)))
+		}
+
+		for i, x := range chunk {
+			err := err
+			if err == nil {
+				err = memberAddResultError(results[i])
+			}
+			if err != nil {
+				seelog.Warnf("Unable to add member Dropbox account: Email[%s] GivenName[%s] Surname[%s] Err[%s]", x.Email, x.GivenName, x.Surname, err)
+				errs[start+i] = dps.reportFailure(x.Evidence, explorer.Target{Operation: "MembersAdd", Email: x.Email}, err, "Unable to add member Dropbox account: Email[%s] GivenName[%s] Surname[%s] (%s)", x.Email, x.GivenName, x.Surname, ErrorKind(err))
+				continue
+			}
+			seelog.Tracef("Add Dropbox account: Email[%s] GivenName[%s] Surname[%s] Tag[%s]", x.Email, x.GivenName, x.Surname, results[i].Tag)
+			errs[start+i] = dps.reportSuccess(x.Evidence, explorer.Target{Operation: "MembersAdd", Email: x.Email}, "Add Dropbox account: Email[%s] GivenName[%s] Surname[%s]", x.Email, x.GivenName, x.Surname)
+		}
+		if abortBatch(errs, start, end) {
+			break
+		}
 	}
-	r, err := client.MembersAdd(&a)
+	return errs
+}
+
+// Call members/add, and wait for the job if Dropbox processes it asynchronously.
+// Results are in the same order of new members.
+func (dps *DropboxConnectorImpl) membersAdd(a *team.MembersAddArg) ([]*team.MemberAddResult, error) {
+	client := dps.ExecutionContext.DropboxClient
+	policy := dps.ExecutionContext.RetryPolicy()
+
+	var r *team.MembersAddLaunch
+	err := CallUpdate(policy, "MembersAdd", func() (err error) {
+		r, err = client.MembersAdd(a)
+		return
+	})
 	if err != nil {
-		seelog.Warnf("Unable to add member Dropbox account: Email[%s] GivenName[%s] Surname[%s] Err[%s]", email, givenName, surname, err)
-		explorer.ReportFailure("Unable to add member Dropbox account: Email[%s] GivenName[%s] Surname[%s]", email, givenName, surname)
-	} else {
-		seelog.Tracef("Add Dropbox account: Email[%s] GivenName[%s] Surname[%s] Tag[%s]", email, givenName, surname, r.Tag)
-		explorer.ReportSuccess("Add Dropbox account: Email[%s] GivenName[%s] Surname[%s]", email, givenName, surname)
+		return nil, err
+	}
+	if r.AsyncJobId == "" {
+		return r.Complete, nil
+	}
+
+	var results []*team.MemberAddResult
+	err = waitJob("MembersAdd", r.AsyncJobId, dps.jobTimeout(), func() (bool, error) {
+		var status *team.MembersAddJobStatus
+		err := Call(policy, "MembersAddJobStatusGet", func() (err error) {
+			status, err = client.MembersAddJobStatusGet(&async.PollArg{AsyncJobId: r.AsyncJobId})
+			return
+		})
+		if err != nil {
+			return false, err
+		}
+		switch status.Tag {
+		case "complete":
+			results = status.Complete
+			return true, nil
+		case "failed":
+			return false, NewDropboxError(classifyErrorTag(status.Failed), "MembersAdd", status.Failed)
+		default:
+			return false, nil
+		}
+	})
+	return results, err
+}
+
+func (dps *DropboxConnectorImpl) MembersSetProfile(email, givenName, surname, evidence string) error {
+	client := dps.ExecutionContext.DropboxClient
+
+	a := team.MembersSetProfileArg{
+		User:         dps.createUserSelectArg(email),
+		NewGivenName: givenName,
+		NewSurname:   surname,
+	}
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "MembersSetProfile", func() error {
+		_, err := client.MembersSetProfile(&a)
+		return err
+	})
+	if err != nil {
+		seelog.Warnf("Unable to update member profile: Email[%s] GivenName[%s] Surname[%s] Err[%s]", email, givenName, surname, err)
+		return dps.reportFailure(evidence, explorer.Target{Operation: "MembersSetProfile", Email: email}, err, "Unable to update member profile: Email[%s] (%s)", email, ErrorKind(err))
+	}
+	seelog.Tracef("Update member profile: Email[%s] GivenName[%s] Surname[%s]", email, givenName, surname)
+	return dps.reportSuccess(evidence, explorer.Target{Operation: "MembersSetProfile", Email: email}, "Update member profile: Email[%s] GivenName[%s] Surname[%s]", email, givenName, surname)
+}
+
+func (dps *DropboxConnectorImpl) MembersSetEmail(email, newEmail, evidence string) error {
+	client := dps.ExecutionContext.DropboxClient
+
+	a := team.MembersSetProfileArg{
+		User:     dps.createUserSelectArg(email),
+		NewEmail: newEmail,
+	}
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "MembersSetEmail", func() error {
+		_, err := client.MembersSetProfile(&a)
+		return err
+	})
+	if err != nil {
+		seelog.Warnf("Unable to change member email: Email[%s] NewEmail[%s] Err[%s]", email, newEmail, err)
+		return dps.reportFailure(evidence, explorer.Target{Operation: "MembersSetEmail", Email: email}, err, "Unable to change member email: Email[%s] NewEmail[%s] (%s)", email, newEmail, ErrorKind(err))
+	}
+	seelog.Tracef("Change member email: Email[%s] NewEmail[%s]", email, newEmail)
+	return dps.reportSuccess(evidence, explorer.Target{Operation: "MembersSetEmail", Email: email}, "Change member email: Email[%s] NewEmail[%s]", email, newEmail)
+}
+
+func (dps *DropboxConnectorImpl) MembersSetExternalId(email, externalId, evidence string) error {
+	client := dps.ExecutionContext.DropboxClient
+
+	a := team.MembersSetProfileArg{
+		User:          dps.createUserSelectArg(email),
+		NewExternalId: externalId,
+	}
+	err := CallUpdate(dps.ExecutionContext.RetryPolicy(), "MembersSetExternalId", func() error {
+		_, err := client.MembersSetProfile(&a)
+		return err
+	})
+	if err != nil {
+		seelog.Warnf("Unable to update member external ID: Email[%s] ExternalId[%s] Err[%s]", email, externalId, err)
+		return dps.reportFailure(evidence, explorer.Target{Operation: "MembersSetExternalId", Email: email}, err, "Unable to update member external ID: Email[%s] (%s)", email, ErrorKind(err))
 	}
+	seelog.Tracef("Update member external ID: Email[%s] ExternalId[%s]", email, externalId)
+	return dps.reportSuccess(evidence, explorer.Target{Operation: "MembersSetExternalId", Email: email}, "Update member external ID: Email[%s] ExternalId[%s]", email, externalId)
 }
@@ -13,7 +13,7 @@ func TestDropboxConnectorMock_AssertLogs(t *testing.T) {
 		t.Errorf("Unexpected state: Unexpected[%v] Missing[%v] Success[%t]", u, m, s)
 	}
 
-	mock.GroupsCreate("TEST-GRP", "test-grp@example.com")
+	mock.GroupsCreate("TEST-GRP", "test-grp@example.com", "")
 
 	u, m, s = mock.AssertLogs([]string{logGroupsCreate})
 	if !s || len(m) > 0 || len(u) > 0 {
@@ -0,0 +1,178 @@
+package connector
+
+import (
+	"fmt"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/auth"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	ERROR_KIND_CONFLICT     = "conflict"
+	ERROR_KIND_NOT_FOUND    = "not_found"
+	ERROR_KIND_RATE_LIMITED = "rate_limited"
+	ERROR_KIND_AUTH         = "auth"
+	ERROR_KIND_TRANSIENT    = "transient"
+	ERROR_KIND_AUDIT        = "audit"
+	ERROR_KIND_OTHER        = "other"
+)
+
+var (
+	// Error tags of Dropbox API, which appear in `error_summary` or in the tag of the result.
+	errorTagsConflict = []string{
+		"group_name_already_used",
+		"external_id_already_in_use",
+		"duplicate_user",
+		"user_already_on_team",
+		"user_on_another_team",
+		"duplicate_external_member_id",
+		"duplicate_member_persistent_id",
+		"email_reserved_for_other_user",
+		"external_id_used_by_other_user",
+	}
+	errorTagsNotFound = []string{
+		"group_not_found",
+		"user_not_found",
+		"id_not_found",
+		"member_not_in_group",
+		"user_not_in_team",
+		"users_not_found",
+		"members_not_in_team",
+	}
+	errorTagsRateLimited = []string{
+		"too_many_write_operations",
+		"too_many_requests",
+	}
+	errorTagsTransient = []string{
+		"internal_error",
+		"temporary_error",
+	}
+)
+
+// Error returned from DropboxConnector.
+type DropboxError struct {
+	Kind       string        // One of ERROR_KIND_*
+	Operation  string        // Name of DropboxConnector operation
+	Summary    string        // Error summary or tag of Dropbox API
+	RetryAfter time.Duration // Only for ERROR_KIND_RATE_LIMITED, if Dropbox specified
+	Err        error         // Original error, can be nil
+}
+
+func (e *DropboxError) Error() string {
+	return fmt.Sprintf("%s failed (%s): %s", e.Operation, e.Kind, e.Summary)
+}
+
+func NewDropboxError(kind, operation, summary string) *DropboxError {
+	return &DropboxError{
+		Kind:      kind,
+		Operation: operation,
+		Summary:   summary,
+	}
+}
+
+// Returns ERROR_KIND_* of the error. Returns empty string if err is nil.
+func ErrorKind(err error) string {
+	if err == nil {
+		return ""
+	}
+	if e, ok := err.(*DropboxError); ok {
+		return e.Kind
+	}
+	return ERROR_KIND_OTHER
+}
+
+func IsConflict(err error) bool {
+	return ErrorKind(err) == ERROR_KIND_CONFLICT
+}
+
+func IsNotFound(err error) bool {
+	return ErrorKind(err) == ERROR_KIND_NOT_FOUND
+}
+
+func IsRateLimited(err error) bool {
+	return ErrorKind(err) == ERROR_KIND_RATE_LIMITED
+}
+
+func IsAuth(err error) bool {
+	return ErrorKind(err) == ERROR_KIND_AUTH
+}
+
+func IsTransient(err error) bool {
+	return ErrorKind(err) == ERROR_KIND_TRANSIENT
+}
+
+// The change might be executed, but not recorded into the audit log.
+func IsAudit(err error) bool {
+	return ErrorKind(err) == ERROR_KIND_AUDIT
+}
+
+// Remaining operations must not be executed. Operations fail with the same reason
+// for auth errors, and changes must not be executed without the audit log.
+func IsAbort(err error) bool {
+	return IsAuth(err) || IsAudit(err)
+}
+
+// Retry might succeed for rate limited or transient errors.
+func IsRetryable(err error) bool {
+	return IsRateLimited(err) || IsTransient(err)
+}
+
+// Classify error tag or error summary (e.g. `group_not_found/...`) of Dropbox API.
+func classifyErrorTag(summary string) string {
+	for _, tag := range strings.Split(summary, "/") {
+		tag = strings.TrimSpace(tag)
+		switch {
+		case containsTag(errorTagsConflict, tag):
+			return ERROR_KIND_CONFLICT
+		case containsTag(errorTagsNotFound, tag):
+			return ERROR_KIND_NOT_FOUND
+		case containsTag(errorTagsRateLimited, tag):
+			return ERROR_KIND_RATE_LIMITED
+		case containsTag(errorTagsTransient, tag):
+			return ERROR_KIND_TRANSIENT
+		}
+	}
+	return ERROR_KIND_OTHER
+}
+
+func containsTag(tags []string, tag string) bool {
+	for _, x := range tags {
+		if x == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Wrap error returned from Dropbox SDK into DropboxError.
+func wrapError(operation string, err error) error {
+	if err == nil {
+		return nil
+	}
+	e := &DropboxError{
+		Operation: operation,
+		Summary:   err.Error(),
+		Err:       err,
+	}
+	switch ae := err.(type) {
+	case auth.AuthAPIError:
+		e.Kind = ERROR_KIND_AUTH
+	case auth.RateLimitAPIError:
+		e.Kind = ERROR_KIND_RATE_LIMITED
+		if ae.RateLimitError != nil {
+			e.RetryAfter = time.Duration(ae.RateLimitError.RetryAfter) * time.Second
+		}
+	case dropbox.APIError:
+		// Generic API error is used for bad requests (400). 5xx is returned as
+		// context.DropboxServerError by the transport.
+		e.Kind = classifyErrorTag(ae.ErrorSummary)
+	case net.Error:
+		// Includes *url.Error of context.DropboxServerError
+		e.Kind = ERROR_KIND_TRANSIENT
+	default:
+		e.Kind = classifyErrorTag(err.Error())
+	}
+	return e
+}
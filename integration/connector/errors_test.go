@@ -0,0 +1,72 @@
+package connector
+
+import (
+	"errors"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/auth"
+	"github.com/watermint/dcfg/integration/context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Mimics endpoint specific errors of Dropbox SDK, e.g. GroupsCreateAPIError.
+type endpointAPIError struct {
+	dropbox.APIError
+}
+
+func TestWrapError(t *testing.T) {
+	if wrapError("GroupsCreate", nil) != nil {
+		t.Error("nil should be nil")
+	}
+
+	cases := []struct {
+		err  error
+		kind string
+	}{
+		{auth.AuthAPIError{APIError: dropbox.APIError{ErrorSummary: "invalid_access_token/"}}, ERROR_KIND_AUTH},
+		{auth.RateLimitAPIError{APIError: dropbox.APIError{ErrorSummary: "too_many_requests/"}}, ERROR_KIND_RATE_LIMITED},
+		{dropbox.APIError{ErrorSummary: "Error in call to API function \"team/members/add\": bad request"}, ERROR_KIND_OTHER},
+		{&url.Error{Op: "Post", URL: "https://api.dropboxapi.com/2/team/members/add", Err: &context.DropboxServerError{StatusCode: 503, Status: "503 Service Unavailable"}}, ERROR_KIND_TRANSIENT},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, ERROR_KIND_TRANSIENT},
+		{endpointAPIError{dropbox.APIError{ErrorSummary: "group_name_already_used/.."}}, ERROR_KIND_CONFLICT},
+		{endpointAPIError{dropbox.APIError{ErrorSummary: "group_not_found/..."}}, ERROR_KIND_NOT_FOUND},
+		{endpointAPIError{dropbox.APIError{ErrorSummary: "members_not_in_team/user_not_found/."}}, ERROR_KIND_NOT_FOUND},
+		{endpointAPIError{dropbox.APIError{ErrorSummary: "too_many_write_operations/"}}, ERROR_KIND_RATE_LIMITED},
+		{endpointAPIError{dropbox.APIError{ErrorSummary: "other/..."}}, ERROR_KIND_OTHER},
+	}
+	for _, c := range cases {
+		err := wrapError("GroupsCreate", c.err)
+		if k := ErrorKind(err); k != c.kind {
+			t.Errorf("Unexpected kind: err[%v] expected[%s] actual[%s]", c.err, c.kind, k)
+		}
+		if e, ok := err.(*DropboxError); !ok || e.Err != c.err || e.Operation != "GroupsCreate" {
+			t.Errorf("Unexpected error: %v", err)
+		}
+	}
+
+	rateLimit := auth.RateLimitAPIError{
+		RateLimitError: &auth.RateLimitError{RetryAfter: 15},
+	}
+	if e := wrapError("MembersAdd", rateLimit).(*DropboxError); e.RetryAfter != 15*time.Second || !IsRetryable(e) {
+		t.Errorf("Unexpected retry after: %v", e.RetryAfter)
+	}
+	if ErrorKind(errors.New("plain")) != ERROR_KIND_OTHER {
+		t.Error("Unclassified error should be other")
+	}
+}
+
+func TestDropboxConnectorMock_MockErrors(t *testing.T) {
+	mock := DropboxConnectorMock{
+		MockErrors: map[string]error{
+			(&DropboxConnectorMock{}).CreateOperationLog("GroupsCreate", "G1", "g1@example.com"): NewDropboxError(ERROR_KIND_CONFLICT, "GroupsCreate", "group_name_already_used"),
+		},
+	}
+	if _, err := mock.GroupsCreate("G1", "g1@example.com", ""); !IsConflict(err) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if id, err := mock.GroupsCreate("G2", "g2@example.com", ""); err != nil || id != "mock-g2@example.com" {
+		t.Errorf("Unexpected result: id[%s] err[%v]", id, err)
+	}
+}
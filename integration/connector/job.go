@@ -0,0 +1,67 @@
+package connector
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/async"
+	"github.com/watermint/dcfg/cli"
+	"time"
+)
+
+const (
+	jobPollInterval = 1 * time.Second
+)
+
+var (
+	// Replaceable for tests
+	jobSleep = time.Sleep
+)
+
+// Poll the async job until poll returns done or error. Returns error if the job
+// does not finish in the timeout.
+func waitJob(operation, asyncJobId string, timeout time.Duration, poll func() (done bool, err error)) error {
+	seelog.Tracef("Waiting for async job: Operation[%s] AsyncJobId[%s]", operation, asyncJobId)
+	var waited time.Duration
+	for {
+		done, err := poll()
+		if err != nil {
+			seelog.Tracef("Async job failed: Operation[%s] AsyncJobId[%s] Err[%v]", operation, asyncJobId, err)
+			return err
+		}
+		if done {
+			seelog.Tracef("Async job completed: Operation[%s] AsyncJobId[%s] Waited[%s]", operation, asyncJobId, waited)
+			return nil
+		}
+		if waited >= timeout {
+			seelog.Warnf("Async job timed out: Operation[%s] AsyncJobId[%s] Waited[%s]", operation, asyncJobId, waited)
+			return NewDropboxError(ERROR_KIND_TRANSIENT, operation, "async_job_timeout")
+		}
+		jobSleep(jobPollInterval)
+		waited += jobPollInterval
+	}
+}
+
+func (dps *DropboxConnectorImpl) jobTimeout() time.Duration {
+	if dps.ExecutionContext.Options.JobTimeout > 0 {
+		return dps.ExecutionContext.Options.JobTimeout
+	}
+	return cli.DEFAULT_JOB_TIMEOUT
+}
+
+// Wait for the job which returns empty result on completion (e.g. groups/job_status/get).
+// Returns nil immediately if the job has already completed on launch (i.e. asyncJobId is empty).
+func (dps *DropboxConnectorImpl) waitEmptyJob(operation, asyncJobId string, status func(arg *async.PollArg) (*async.PollEmptyResult, error)) error {
+	if asyncJobId == "" {
+		return nil
+	}
+	return waitJob(operation, asyncJobId, dps.jobTimeout(), func() (bool, error) {
+		var r *async.PollEmptyResult
+		err := Call(dps.ExecutionContext.RetryPolicy(), operation, func() (err error) {
+			r, err = status(&async.PollArg{AsyncJobId: asyncJobId})
+			return
+		})
+		if err != nil {
+			return false, err
+		}
+		return r.Tag == "complete", nil
+	})
+}
@@ -0,0 +1,52 @@
+package connector
+
+import (
+	"github.com/watermint/dcfg/common/metrics"
+	"github.com/watermint/dcfg/integration/retry"
+	"time"
+)
+
+// Read only calls are retried on rate limit and transient errors.
+func classifyRetry(err error) (bool, time.Duration) {
+	if !IsRetryable(err) {
+		return false, 0
+	}
+	return true, retryAfter(err)
+}
+
+// Calls which update the team are retried only on rate limit, because the change
+// might be executed even if the call failed by transient errors (e.g. 5xx).
+func classifyRetryUpdate(err error) (bool, time.Duration) {
+	if !IsRateLimited(err) {
+		return false, 0
+	}
+	return true, retryAfter(err)
+}
+
+func retryAfter(err error) time.Duration {
+	if e, ok := err.(*DropboxError); ok {
+		return e.RetryAfter
+	}
+	return 0
+}
+
+// Wrap the call to record metrics of each attempt, and wrap the error into *DropboxError.
+func observed(operation string, f func() error) func() error {
+	attempt := 0
+	return func() error {
+		attempt++
+		err := wrapError(operation, f())
+		metrics.ObserveApiCall(metrics.PROVIDER_DROPBOX, operation, attempt, ErrorKind(err))
+		return err
+	}
+}
+
+// Call read only Dropbox API with retry. Returned error is wrapped into *DropboxError.
+func Call(policy retry.Policy, operation string, f func() error) error {
+	return policy.Do(operation, classifyRetry, observed(operation, f))
+}
+
+// Call Dropbox API which updates the team, with retry. Returned error is wrapped into *DropboxError.
+func CallUpdate(policy retry.Policy, operation string, f func() error) error {
+	return policy.Do(operation, classifyRetryUpdate, observed(operation, f))
+}
@@ -0,0 +1,94 @@
+package connector
+
+import (
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/auth"
+	"github.com/watermint/dcfg/common/metrics"
+	"github.com/watermint/dcfg/integration/context"
+	"github.com/watermint/dcfg/integration/retry"
+	"net/url"
+	"testing"
+)
+
+func TestCall(t *testing.T) {
+	policy := retry.Policy{
+		MaxAttempts: 3,
+	}
+	rateLimit := auth.RateLimitAPIError{APIError: dropbox.APIError{ErrorSummary: "too_many_requests/"}}
+	serverError := &url.Error{Op: "Post", URL: "https://api.dropboxapi.com/2/team/groups/list", Err: &context.DropboxServerError{StatusCode: 500, Status: "500 Internal Server Error"}}
+	conflict := endpointAPIError{dropbox.APIError{ErrorSummary: "group_name_already_used/.."}}
+
+	cases := []struct {
+		err            error
+		callAttempts   int
+		updateAttempts int
+	}{
+		{rateLimit, 3, 3},
+		{serverError, 3, 1},
+		{conflict, 1, 1},
+	}
+	for _, c := range cases {
+		calls := 0
+		err := Call(policy, "GroupsList", func() error {
+			calls++
+			return c.err
+		})
+		if calls != c.callAttempts {
+			t.Errorf("Invalid attempts of Call: err[%v] expected[%d] actual[%d]", c.err, c.callAttempts, calls)
+		}
+		if _, ok := err.(*DropboxError); !ok {
+			t.Errorf("Error should be wrapped: %v", err)
+		}
+
+		calls = 0
+		CallUpdate(policy, "GroupsCreate", func() error {
+			calls++
+			return c.err
+		})
+		if calls != c.updateAttempts {
+			t.Errorf("Invalid attempts of CallUpdate: err[%v] expected[%d] actual[%d]", c.err, c.updateAttempts, calls)
+		}
+	}
+
+	calls := 0
+	err := Call(policy, "GroupsList", func() error {
+		calls++
+		if calls < 2 {
+			return rateLimit
+		}
+		return nil
+	})
+	if err != nil || calls != 2 {
+		t.Errorf("Invalid result: err[%v] calls[%d]", err, calls)
+	}
+}
+
+func TestCall_Metrics(t *testing.T) {
+	metrics.Default.Reset()
+	defer metrics.Default.Reset()
+
+	policy := retry.Policy{
+		MaxAttempts: 3,
+	}
+	rateLimit := auth.RateLimitAPIError{APIError: dropbox.APIError{ErrorSummary: "too_many_requests/"}}
+	calls := 0
+	Call(policy, "GroupsList", func() error {
+		calls++
+		if calls < 2 {
+			return rateLimit
+		}
+		return nil
+	})
+
+	labels := metrics.Labels{"provider": metrics.PROVIDER_DROPBOX, "endpoint": "GroupsList"}
+	if v := metrics.Default.Get(metrics.API_CALLS, labels); v != 2 {
+		t.Errorf("Unexpected calls: %v", v)
+	}
+	if v := metrics.Default.Get(metrics.API_RETRIES, labels); v != 1 {
+		t.Errorf("Unexpected retries: %v", v)
+	}
+	labels["kind"] = ERROR_KIND_RATE_LIMITED
+	if v := metrics.Default.Get(metrics.API_ERRORS, labels); v != 1 {
+		t.Errorf("Unexpected errors: %v", v)
+	}
+}
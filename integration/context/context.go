@@ -2,16 +2,25 @@ package context
 
 import (
 	"errors"
+	"fmt"
 	"github.com/cihub/seelog"
 	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
 	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team_log"
 	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/common/audit"
 	"github.com/watermint/dcfg/common/file"
+	"github.com/watermint/dcfg/integration/cache"
+	"github.com/watermint/dcfg/integration/retry"
 	"golang.org/x/net/context"
 	"golang.org/x/oauth2"
 	"golang.org/x/oauth2/google"
 	"google.golang.org/api/admin/directory/v1"
+	reports "google.golang.org/api/admin/reports/v1"
 	"io/ioutil"
+	"net/http"
+	"os"
+	"os/user"
 	"path"
 	"runtime"
 )
@@ -24,14 +33,52 @@ type ExecutionContext struct {
 	DropboxClient team.Client
 	DropboxToken  DropboxToken
 
+	// Dropbox Client for team events. Nil if the token is not configured.
+	DropboxAuditClient team_log.Client
+
 	// Google Client
-	GoogleClient       *admin.Service
-	GoogleClientConfig *oauth2.Config
-	GoogleToken        *oauth2.Token
+	GoogleClient        *admin.Service
+	GoogleReportsClient *reports.Service
+	GoogleClientConfig  *oauth2.Config
+	GoogleToken         *oauth2.Token
+
+	// Closed when the run is requested to stop (e.g. SIGTERM on daemon mode).
+	// Nil if the run cannot be stopped.
+	Stop <-chan struct{}
+
+	// Limit group-provision to these groups of the white list (e.g. run
+	// triggered by API). Empty for all groups of the white list.
+	SyncGroups []string
+
+	// Trigger of the run, and the audit log of changes on Dropbox. The audit
+	// log is nil if changes are not executed (e.g. dryrun).
+	Trigger  RunTrigger
+	AuditLog *audit.Log
+}
+
+// Who or what triggered the run.
+type RunTrigger struct {
+	RunId   string
+	Trigger string
+	Actor   string
+}
+
+// Actor of runs not requested by others (e.g. cron). OS user and hostname.
+func DefaultActor() string {
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return name + "@" + host
 }
 
 type DropboxToken struct {
 	TeamManagementToken string `json:"token-team-management"`
+	TeamAuditingToken   string `json:"token-team-auditing,omitempty"`
 }
 
 func NewDropboxToken(mgmtToken string) DropboxToken {
@@ -40,6 +87,34 @@ func NewDropboxToken(mgmtToken string) DropboxToken {
 	}
 }
 
+// Retry policy of API calls, configured by options.
+func (e *ExecutionContext) RetryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:   e.Options.RetryMaxAttempts,
+		Wait:          e.Options.RetryWait,
+		MaxWait:       e.Options.RetryMaxWait,
+		JitterPercent: e.Options.RetryJitterPercent,
+	}
+}
+
+// On-disk cache of directories, configured by options. Returns nil if the cache
+// is disabled. The cache is enabled by default on daemon mode, to revalidate
+// Google directory by ETag on each run.
+func (e *ExecutionContext) Cache() *cache.Store {
+	ttl := e.Options.CacheTTL
+	if ttl <= 0 && e.Options.Daemon {
+		ttl = cli.DEFAULT_DAEMON_CACHE_TTL
+	}
+	if ttl <= 0 {
+		return nil
+	}
+	return &cache.Store{
+		Dir:          e.Options.PathCache(),
+		TTL:          ttl,
+		ForceRefresh: e.Options.CacheRefresh,
+	}
+}
+
 func (e *ExecutionContext) CreateGoogleClientByToken(token *oauth2.Token) (*admin.Service, error) {
 	context := context.Background()
 	client := e.GoogleClientConfig.Client(context, token)
@@ -56,6 +131,12 @@ func (e *ExecutionContext) loadGoogleClient() error {
 		return err
 	}
 	e.GoogleClient = client
+
+	reportsClient, err := reports.New(e.GoogleClientConfig.Client(context.Background(), e.GoogleToken))
+	if err != nil {
+		return err
+	}
+	e.GoogleReportsClient = reportsClient
 	return nil
 }
 
@@ -65,9 +146,15 @@ func (e *ExecutionContext) loadGoogleClientConfig() error {
 	if err != nil {
 		return err
 	}
-	config, err := google.ConfigFromJSON(json,
+	scopes := []string{
 		admin.AdminDirectoryUserReadonlyScope,
-		admin.AdminDirectoryGroupReadonlyScope)
+		admin.AdminDirectoryGroupReadonlyScope,
+	}
+	// Audit reports are required only for the incremental sync
+	if e.Options.Incremental {
+		scopes = append(scopes, reports.AdminReportsAuditReadonlyScope)
+	}
+	config, err := google.ConfigFromJSON(json, scopes...)
 	if err != nil {
 		return err
 	}
@@ -86,15 +173,63 @@ func (e *ExecutionContext) loadGoogleToken() error {
 	return nil
 }
 
+// Dropbox API responded with 5xx. Dropbox SDK does not expose the status code
+// of unexpected responses, thus the transport returns them as this error.
+type DropboxServerError struct {
+	StatusCode int
+	Status     string
+}
+
+func (e *DropboxServerError) Error() string {
+	return fmt.Sprintf("Dropbox API server error: %s", e.Status)
+}
+
+type dropboxTransport struct {
+	base http.RoundTripper
+}
+
+func (t *dropboxTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode >= http.StatusInternalServerError {
+		res.Body.Close()
+		return nil, &DropboxServerError{
+			StatusCode: res.StatusCode,
+			Status:     res.Status,
+		}
+	}
+	return res, nil
+}
+
+func newDropboxHttpClient() *http.Client {
+	return &http.Client{
+		Transport: &dropboxTransport{base: http.DefaultTransport},
+	}
+}
+
 func (e *ExecutionContext) CreateDropboxClientByToken(token string) team.Client {
 	config := dropbox.Config{
-		Token: token,
+		Token:  token,
+		Client: newDropboxHttpClient(),
 	}
 	return team.New(config)
 }
 
+func (e *ExecutionContext) CreateDropboxAuditClientByToken(token string) team_log.Client {
+	config := dropbox.Config{
+		Token:  token,
+		Client: newDropboxHttpClient(),
+	}
+	return team_log.New(config)
+}
+
 func (e *ExecutionContext) loadDropboxClient() error {
 	e.DropboxClient = e.CreateDropboxClientByToken(e.DropboxToken.TeamManagementToken)
+	if e.DropboxToken.TeamAuditingToken != "" {
+		e.DropboxAuditClient = e.CreateDropboxAuditClientByToken(e.DropboxToken.TeamAuditingToken)
+	}
 	return nil
 }
 
@@ -1,6 +1,9 @@
 package context
 
 import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"testing"
 )
 
@@ -21,3 +24,28 @@ func TestExecutionContext_InitGoogleClient(t *testing.T) {
 
 	ctx.loadGoogleClient()
 }
+
+func TestDropboxTransport(t *testing.T) {
+	status := http.StatusServiceUnavailable
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+	client := newDropboxHttpClient()
+
+	_, err := client.Get(server.URL)
+	if ue, ok := err.(*url.Error); !ok {
+		t.Errorf("Unexpected error: %v", err)
+	} else if se, ok := ue.Err.(*DropboxServerError); !ok || se.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Unexpected error: %v", ue.Err)
+	}
+
+	// Other responses are handled by Dropbox SDK
+	status = http.StatusBadRequest
+	res, err := client.Get(server.URL)
+	if err != nil || res.StatusCode != http.StatusBadRequest {
+		t.Errorf("Unexpected response: res[%v] err[%v]", res, err)
+	} else {
+		res.Body.Close()
+	}
+}
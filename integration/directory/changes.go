@@ -0,0 +1,95 @@
+package directory
+
+import (
+	"strings"
+	"time"
+)
+
+// Users and groups changed in a period. Emails are stored in lower case.
+type ChangeSet struct {
+	Users           map[string]bool `json:"users"`             // Email of Google user or Dropbox member
+	GoogleGroups    map[string]bool `json:"google_groups"`     // Email of Google group
+	DropboxGroupIds map[string]bool `json:"dropbox_group_ids"` // Group ID of Dropbox group
+}
+
+func NewChangeSet() *ChangeSet {
+	return &ChangeSet{
+		Users:           make(map[string]bool),
+		GoogleGroups:    make(map[string]bool),
+		DropboxGroupIds: make(map[string]bool),
+	}
+}
+
+func (c *ChangeSet) AddUser(email string) {
+	if email != "" {
+		c.Users[strings.ToLower(email)] = true
+	}
+}
+
+func (c *ChangeSet) AddGoogleGroup(email string) {
+	if email != "" {
+		c.GoogleGroups[strings.ToLower(email)] = true
+	}
+}
+
+func (c *ChangeSet) AddDropboxGroup(groupId string) {
+	if groupId != "" {
+		c.DropboxGroupIds[groupId] = true
+	}
+}
+
+func (c *ChangeSet) HasUser(email string) bool {
+	return c.Users[strings.ToLower(email)]
+}
+
+func (c *ChangeSet) HasGoogleGroup(email string) bool {
+	return c.GoogleGroups[strings.ToLower(email)]
+}
+
+func (c *ChangeSet) Merge(other *ChangeSet) {
+	if other == nil {
+		return
+	}
+	for x := range other.Users {
+		c.AddUser(x)
+	}
+	for x := range other.GoogleGroups {
+		c.AddGoogleGroup(x)
+	}
+	for x := range other.DropboxGroupIds {
+		c.AddDropboxGroup(x)
+	}
+}
+
+func (c *ChangeSet) IsEmpty() bool {
+	return len(c.Users) == 0 && len(c.GoogleGroups) == 0 && len(c.DropboxGroupIds) == 0
+}
+
+// Source of changes of users and groups.
+type ChangeFeed interface {
+	// Add users and groups changed in the period into the change set.
+	Collect(since, until time.Time, changes *ChangeSet) error
+}
+
+type ChangeFeedMock struct {
+	MockUsers           []string
+	MockGoogleGroups    []string
+	MockDropboxGroupIds []string
+	MockError           error
+}
+
+func (f *ChangeFeedMock) Collect(since, until time.Time, changes *ChangeSet) error {
+	if f.MockError != nil {
+		return f.MockError
+	}
+	for _, x := range f.MockUsers {
+		changes.AddUser(x)
+	}
+	for _, x := range f.MockGoogleGroups {
+		changes.AddGoogleGroup(x)
+	}
+	for _, x := range f.MockDropboxGroupIds {
+		changes.AddDropboxGroup(x)
+	}
+	return nil
+}
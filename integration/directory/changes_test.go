@@ -0,0 +1,86 @@
+package directory
+
+import (
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team_log"
+	reports "google.golang.org/api/admin/reports/v1"
+	"testing"
+)
+
+func TestCollectGoogleActivity(t *testing.T) {
+	changes := NewChangeSet()
+	collectGoogleActivity(&reports.Activity{
+		Events: []*reports.ActivityEvents{
+			{
+				Type: "GROUP_SETTINGS",
+				Name: "ADD_GROUP_MEMBER",
+				Parameters: []*reports.ActivityEventsParameters{
+					{Name: "USER_EMAIL", Value: "a@example.com"},
+					{Name: "GROUP_EMAIL", Value: "G1@example.com"},
+				},
+			},
+			{
+				// Activity of `groups` application
+				Type: "moderator_action",
+				Name: "add_user",
+				Parameters: []*reports.ActivityEventsParameters{
+					{Name: "user_email", Value: "a@example.com"},
+					{Name: "group_email", Value: "g2@example.com"},
+				},
+			},
+			{
+				Type: "USER_SETTINGS",
+				Name: "RENAME_USER",
+				Parameters: []*reports.ActivityEventsParameters{
+					{Name: "USER_EMAIL", Value: "b@example.com"},
+					{Name: "NEW_VALUE", Value: "b2@example.com"},
+				},
+			},
+			{
+				Type: "USER_SETTINGS",
+				Name: "CHANGE_LAST_NAME",
+				Parameters: []*reports.ActivityEventsParameters{
+					{Name: "USER_EMAIL", Value: "c@example.com"},
+					{Name: "NEW_VALUE", Value: "Smith"},
+				},
+			},
+		},
+	}, changes)
+
+	for _, x := range []string{"a@example.com", "b@example.com", "b2@example.com", "c@example.com"} {
+		if !changes.HasUser(x) {
+			t.Errorf("User not found: %s", x)
+		}
+	}
+	if len(changes.Users) != 4 || !changes.HasGoogleGroup("g1@example.com") || !changes.HasGoogleGroup("g2@example.com") {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+}
+
+func TestCollectDropboxEvents(t *testing.T) {
+	changes := NewChangeSet()
+	collectDropboxEvents([]*team_log.TeamEvent{
+		{
+			Context: &team_log.ContextLogInfo{
+				Tagged:     dropbox.Tagged{Tag: team_log.ContextLogInfoTeamMember},
+				TeamMember: &team_log.TeamMemberLogInfo{UserLogInfo: team_log.UserLogInfo{Email: "a@example.com"}},
+			},
+		},
+		{
+			Participants: []*team_log.ParticipantLogInfo{
+				{
+					Tagged: dropbox.Tagged{Tag: team_log.ParticipantLogInfoGroup},
+					Group:  &team_log.GroupLogInfo{GroupId: "g1"},
+				},
+				{
+					Tagged: dropbox.Tagged{Tag: team_log.ParticipantLogInfoUser},
+					User:   &team_log.TeamMemberLogInfo{UserLogInfo: team_log.UserLogInfo{Email: "b@example.com"}},
+				},
+			},
+		},
+	}, changes)
+
+	if !changes.HasUser("a@example.com") || !changes.HasUser("b@example.com") || !changes.DropboxGroupIds["g1"] {
+		t.Errorf("Unexpected changes: %v", changes)
+	}
+}
@@ -2,10 +2,13 @@ package directory
 
 import (
 	"github.com/cihub/seelog"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
 	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team"
 	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team_common"
-	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/integration/connector"
 	"github.com/watermint/dcfg/integration/context"
+	"strings"
+	"sync"
 )
 
 type DropboxDirectory struct {
@@ -23,17 +26,22 @@ type DropboxDirectory struct {
 
 const (
 	dropboxLoadChunkSize = 100
+
+	// Max number of groups in a selector of groups/get_info
+	dropboxGroupInfoBatchSize = 100
 )
 
-func NewDropboxDirectory(ctx context.ExecutionContext) *DropboxDirectory {
+func NewDropboxDirectory(ctx context.ExecutionContext) (*DropboxDirectory, error) {
 	dd := DropboxDirectory{
 		executionContext: ctx,
 	}
-	dd.load()
-	return &dd
+	if err := dd.load(); err != nil {
+		return nil, err
+	}
+	return &dd, nil
 }
 
-func (d *DropboxDirectory) loadMembers() {
+func (d *DropboxDirectory) loadMembers() error {
 	d.rawMembers = []*team.TeamMemberInfo{}
 	client := d.executionContext.DropboxClient
 
@@ -41,17 +49,21 @@ func (d *DropboxDirectory) loadMembers() {
 
 	sel := team.MembersListArg{}
 	sel.Limit = dropboxLoadChunkSize
-	ms, err := client.MembersList(&sel)
+	var ms *team.MembersListResult
+	err := connector.Call(d.executionContext.RetryPolicy(), "MembersList", func() (err error) {
+		ms, err = client.MembersList(&sel)
+		return
+	})
 	if err != nil {
 		seelog.Errorf("Unable to load Dropbox Team Member: err[%s]", err)
-		explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth dropbox`")
+		return err
 	}
 	for _, m := range ms.Members {
 		d.rawMembers = append(d.rawMembers, m)
 	}
 	seelog.Tracef("Dropbox Team Member Chunk loaded: %d member(s)", len(ms.Members))
 	if !ms.HasMore {
-		return
+		return nil
 	}
 
 	cursor := ms.Cursor
@@ -60,10 +72,14 @@ func (d *DropboxDirectory) loadMembers() {
 		sel.Cursor = cursor
 		seelog.Trace("Loading Dropbox Team Member Info (Continue)")
 
-		ms, err := client.MembersListContinue(&sel)
+		var ms *team.MembersListResult
+		err := connector.Call(d.executionContext.RetryPolicy(), "MembersListContinue", func() (err error) {
+			ms, err = client.MembersListContinue(&sel)
+			return
+		})
 		if err != nil {
 			seelog.Errorf("Unable to load Dropbox Team Member: err[%s]", err)
-			explorer.FatalShutdown("Please re-run `-auth dropbox`")
+			return err
 		}
 		for _, m := range ms.Members {
 			d.rawMembers = append(d.rawMembers, m)
@@ -74,35 +90,44 @@ func (d *DropboxDirectory) loadMembers() {
 		}
 		cursor = ms.Cursor
 	}
+	return nil
 }
 
-func (d *DropboxDirectory) loadGroupSummaries() {
+func (d *DropboxDirectory) loadGroupSummaries() error {
 	client := d.executionContext.DropboxClient
 
 	seelog.Trace("Loading Dropbox Group Summaries")
 
 	sel := team.GroupsListArg{}
 	sel.Limit = dropboxLoadChunkSize
-	gs, err := client.GroupsList(&sel)
+	var gs *team.GroupsListResult
+	err := connector.Call(d.executionContext.RetryPolicy(), "GroupsList", func() (err error) {
+		gs, err = client.GroupsList(&sel)
+		return
+	})
 	if err != nil {
 		seelog.Errorf("Unable to load Dropbox Group Summary: Err[%s]", err)
-		explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth dropbox`")
+		return err
 	}
 	for _, g := range gs.Groups {
 		d.rawGroupSummaries = append(d.rawGroupSummaries, g)
 	}
 	seelog.Tracef("Dropbox Group Summary Chunk loaded: %d group(s)", len(gs.Groups))
 	if !gs.HasMore {
-		return
+		return nil
 	}
 	cursor := gs.Cursor
 	for {
 		sel := team.GroupsListContinueArg{}
 		sel.Cursor = cursor
-		gs, err := client.GroupsListContinue(&sel)
+		var gs *team.GroupsListResult
+		err := connector.Call(d.executionContext.RetryPolicy(), "GroupsListContinue", func() (err error) {
+			gs, err = client.GroupsListContinue(&sel)
+			return
+		})
 		if err != nil {
 			seelog.Errorf("Unable to load Dropbox Group Summary: Err[%s]", err)
-			explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth dropbox`")
+			return err
 		}
 		seelog.Tracef("Dropbox Group Summary (Continue) Chunk loaded: %d group(s)", len(gs.Groups))
 		for _, g := range gs.Groups {
@@ -113,38 +138,173 @@ func (d *DropboxDirectory) loadGroupSummaries() {
 		}
 		cursor = gs.Cursor
 	}
+	return nil
 }
 
-func (d *DropboxDirectory) loadGroups() {
+// Load group full info in batches. Batches are loaded in parallel by workers
+// up to `-dropbox-concurrency`. Group members are not cached, because Dropbox
+// does not provide a validator of group members.
+func (d *DropboxDirectory) loadGroups() error {
 	groups := make(map[string]*team.GroupFullInfo)
+	pending := make([]string, 0, len(d.rawGroupSummaries))
+	for _, gs := range d.rawGroupSummaries {
+		pending = append(pending, gs.GroupId)
+	}
+
+	batches := make([][]string, 0, len(pending)/dropboxGroupInfoBatchSize+1)
+	for i := 0; i < len(pending); i += dropboxGroupInfoBatchSize {
+		end := i + dropboxGroupInfoBatchSize
+		if end > len(pending) {
+			end = len(pending)
+		}
+		batches = append(batches, pending[i:end])
+	}
+
+	concurrency := d.executionContext.Options.DropboxConcurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	seelog.Tracef("Loading Dropbox Group Full Info: %d group(s) in %d batch(es), concurrency[%d]", len(pending), len(batches), concurrency)
+
+	var loadErr error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan []string)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for groupIds := range queue {
+				mutex.Lock()
+				failed := loadErr != nil
+				mutex.Unlock()
+				if failed {
+					continue
+				}
+
+				infos, err := d.loadGroupInfoBatch(groupIds)
+
+				mutex.Lock()
+				if err != nil && loadErr == nil {
+					loadErr = err
+				}
+				for _, g := range infos {
+					groups[g.GroupId] = g
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, x := range batches {
+		queue <- x
+	}
+	close(queue)
+	wg.Wait()
+
+	if loadErr != nil {
+		return loadErr
+	}
+	d.rawGroupFullInfo = groups
+	return nil
+}
+
+func (d *DropboxDirectory) loadGroupInfoBatch(groupIds []string) ([]*team.GroupFullInfo, error) {
 	client := d.executionContext.DropboxClient
 
-	for i, gs := range d.rawGroupSummaries {
-		sel := team.GroupsSelector{}
-		sel.Tag = "group_ids"
-		sel.GroupIds = []string{gs.GroupId}
-		seelog.Tracef("Loading Dropbox Group Full Info [%d of %d]: Group ID[%s] Group Name[%s]", i, len(d.rawGroupSummaries), gs.GroupId, gs.GroupName)
-		results, err := client.GroupsGetInfo(&sel)
+	sel := team.GroupsSelector{}
+	sel.Tag = "group_ids"
+	sel.GroupIds = groupIds
+	seelog.Tracef("Loading Dropbox Group Full Info: GroupIds[%s]", strings.Join(groupIds, ","))
 
-		if err != nil {
-			seelog.Errorf("Failed to load Dropbox Group: GroupId[%s] GroupName[%s] Err[%v]", gs.GroupId, gs.GroupName, err)
-			explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth dropbox`")
+	var results []*team.GroupsGetInfoItem
+	err := connector.Call(d.executionContext.RetryPolicy(), "GroupsGetInfo", func() (err error) {
+		results, err = client.GroupsGetInfo(&sel)
+		return
+	})
+	if err != nil {
+		seelog.Errorf("Failed to load Dropbox Group: GroupIds[%s] Err[%v]", strings.Join(groupIds, ","), err)
+		return nil, err
+	}
+
+	infos := make([]*team.GroupFullInfo, 0, len(results))
+	for _, gr := range results {
+		if gr.GroupInfo == nil {
+			// The group might be deleted after listing groups
+			seelog.Warnf("Dropbox Group not found: Tag[%s] GroupId[%s]", gr.Tag, gr.IdNotFound)
+			continue
 		}
+		g := gr.GroupInfo
+		if uint32(len(g.Members)) < g.MemberCount {
+			seelog.Tracef("Members of Dropbox Group are not fully included: GroupId[%s] GroupName[%s] Included[%d] MemberCount[%d]", g.GroupId, g.GroupName, len(g.Members), g.MemberCount)
+			members, err := d.loadGroupMembers(g.GroupId)
+			if err != nil {
+				return nil, err
+			}
+			g.Members = members
+		}
+		infos = append(infos, g)
+	}
+	return infos, nil
+}
+
+// Load all members of the group through groups/members/list.
+func (d *DropboxDirectory) loadGroupMembers(groupId string) ([]*team.GroupMemberInfo, error) {
+	client := d.executionContext.DropboxClient
+	members := make([]*team.GroupMemberInfo, 0, dropboxLoadChunkSize)
+
+	seelog.Tracef("Loading Dropbox Group Members: GroupId[%s]", groupId)
+	arg := team.GroupsMembersListArg{
+		Group: &team.GroupSelector{
+			Tagged:  dropbox.Tagged{Tag: "group_id"},
+			GroupId: groupId,
+		},
+		Limit: dropboxLoadChunkSize,
+	}
+	var r *team.GroupsMembersListResult
+	err := connector.Call(d.executionContext.RetryPolicy(), "GroupsMembersList", func() (err error) {
+		r, err = client.GroupsMembersList(&arg)
+		return
+	})
+	if err != nil {
+		seelog.Errorf("Unable to load Dropbox Group Members: GroupId[%s] Err[%v]", groupId, err)
+		return nil, err
+	}
+	members = append(members, r.Members...)
+	seelog.Tracef("Dropbox Group Members Chunk loaded: GroupId[%s] %d member(s), has more: %t", groupId, len(r.Members), r.HasMore)
 
-		for _, gr := range results {
-			groups[gr.GroupInfo.GroupId] = gr.GroupInfo
+	for r.HasMore {
+		arg := team.GroupsMembersListContinueArg{
+			Cursor: r.Cursor,
+		}
+		err := connector.Call(d.executionContext.RetryPolicy(), "GroupsMembersListContinue", func() (err error) {
+			r, err = client.GroupsMembersListContinue(&arg)
+			return
+		})
+		if err != nil {
+			seelog.Errorf("Unable to load Dropbox Group Members: GroupId[%s] Err[%v]", groupId, err)
+			return nil, err
 		}
+		members = append(members, r.Members...)
+		seelog.Tracef("Dropbox Group Members Chunk (Continue) loaded: GroupId[%s] %d member(s), has more: %t", groupId, len(r.Members), r.HasMore)
 	}
-	d.rawGroupFullInfo = groups
+	return members, nil
 }
 
-func (d *DropboxDirectory) load() {
-	d.loadMembers()
-	d.loadGroupSummaries()
-	d.loadGroups()
+func (d *DropboxDirectory) load() error {
+	if err := d.loadMembers(); err != nil {
+		return err
+	}
+	if err := d.loadGroupSummaries(); err != nil {
+		return err
+	}
+	if err := d.loadGroups(); err != nil {
+		return err
+	}
 
 	d.groups = d.createGroups()
 	d.accounts = d.createAccounts()
+	return nil
 }
 
 func (d *DropboxDirectory) createAccounts() (members map[string]Account) {
@@ -154,11 +314,30 @@ func (d *DropboxDirectory) createAccounts() (members map[string]Account) {
 			Email:     m.Profile.Email,
 			GivenName: m.Profile.Name.GivenName,
 			Surname:   m.Profile.Name.Surname,
+			Status:    dropboxAccountStatus(m.Profile.Status),
+
+			CorrelationId: m.Profile.ExternalId,
 		}
 	}
 	return
 }
 
+func dropboxAccountStatus(status *team.TeamMemberStatus) string {
+	if status == nil {
+		return ACCOUNT_STATUS_ACTIVE
+	}
+	switch status.Tag {
+	case team.TeamMemberStatusSuspended:
+		return ACCOUNT_STATUS_SUSPENDED
+	case team.TeamMemberStatusInvited:
+		return ACCOUNT_STATUS_INVITED
+	case team.TeamMemberStatusRemoved:
+		return ACCOUNT_STATUS_REMOVED
+	default:
+		return ACCOUNT_STATUS_ACTIVE
+	}
+}
+
 func (d *DropboxDirectory) createGroups() (groups map[string]Group) {
 	groups = make(map[string]Group)
 	for gid, g := range d.rawGroupFullInfo {
@@ -168,6 +347,9 @@ func (d *DropboxDirectory) createGroups() (groups map[string]Group) {
 				Email:     m.Profile.Email,
 				GivenName: m.Profile.Name.GivenName,
 				Surname:   m.Profile.Name.Surname,
+				Status:    dropboxAccountStatus(m.Profile.Status),
+
+				CorrelationId: m.Profile.ExternalId,
 			}
 		}
 		group := Group{
@@ -1,8 +1,19 @@
 package directory
 
 import (
+	"errors"
+	"fmt"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team_common"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/users"
+	"github.com/watermint/dcfg/cli"
 	"github.com/watermint/dcfg/integration/context"
+	"io/ioutil"
+	"os"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestDropboxDirectory(t *testing.T) {
@@ -22,3 +33,172 @@ func TestDropboxDirectory(t *testing.T) {
 		t.Error("No accounts loaded from Dropbox")
 	}
 }
+
+// Implements group related API of team.Client. Other methods are not implemented.
+type dropboxGroupClientMock struct {
+	team.Client
+
+	groups       map[string]*team.GroupFullInfo
+	members      map[string][]*team.GroupMemberInfo // Pages by cursor. Key "" for the first page
+	getInfoCalls int
+	mutex        sync.Mutex
+}
+
+func (c *dropboxGroupClientMock) GroupsGetInfo(arg *team.GroupsSelector) ([]*team.GroupsGetInfoItem, error) {
+	c.mutex.Lock()
+	c.getInfoCalls++
+	c.mutex.Unlock()
+
+	if len(arg.GroupIds) > dropboxGroupInfoBatchSize {
+		return nil, errors.New("too_many_groups")
+	}
+	results := make([]*team.GroupsGetInfoItem, 0, len(arg.GroupIds))
+	for _, x := range arg.GroupIds {
+		if g, e := c.groups[x]; e {
+			results = append(results, &team.GroupsGetInfoItem{
+				Tagged:    dropbox.Tagged{Tag: "group_info"},
+				GroupInfo: g,
+			})
+		} else {
+			results = append(results, &team.GroupsGetInfoItem{
+				Tagged:     dropbox.Tagged{Tag: "id_not_found"},
+				IdNotFound: x,
+			})
+		}
+	}
+	return results, nil
+}
+
+func (c *dropboxGroupClientMock) groupMembersPage(cursor string) (*team.GroupsMembersListResult, error) {
+	m, e := c.members[cursor]
+	if !e {
+		return nil, errors.New("invalid_cursor")
+	}
+	next := fmt.Sprintf("%s+", cursor)
+	_, hasMore := c.members[next]
+	return &team.GroupsMembersListResult{
+		Members: m,
+		Cursor:  next,
+		HasMore: hasMore,
+	}, nil
+}
+
+func (c *dropboxGroupClientMock) GroupsMembersList(arg *team.GroupsMembersListArg) (*team.GroupsMembersListResult, error) {
+	return c.groupMembersPage("")
+}
+
+func (c *dropboxGroupClientMock) GroupsMembersListContinue(arg *team.GroupsMembersListContinueArg) (*team.GroupsMembersListResult, error) {
+	return c.groupMembersPage(arg.Cursor)
+}
+
+func dropboxGroupMember(email string) *team.GroupMemberInfo {
+	return &team.GroupMemberInfo{
+		Profile: &team.MemberProfile{
+			Email: email,
+			Name:  &users.Name{},
+		},
+	}
+}
+
+func TestDropboxDirectory_LoadGroups(t *testing.T) {
+	numGroups := dropboxGroupInfoBatchSize*2 + 1
+	client := &dropboxGroupClientMock{
+		groups: make(map[string]*team.GroupFullInfo),
+		members: map[string][]*team.GroupMemberInfo{
+			"":  {dropboxGroupMember("a@example.com")},
+			"+": {dropboxGroupMember("b@example.com"), dropboxGroupMember("c@example.com")},
+		},
+	}
+	summaries := make([]*team_common.GroupSummary, 0, numGroups+1)
+	for i := 0; i < numGroups; i++ {
+		groupId := fmt.Sprintf("g%d", i)
+		client.groups[groupId] = &team.GroupFullInfo{
+			GroupId:     groupId,
+			GroupName:   groupId,
+			MemberCount: 1,
+			Members:     []*team.GroupMemberInfo{dropboxGroupMember("a@example.com")},
+		}
+		summaries = append(summaries, &team_common.GroupSummary{GroupId: groupId})
+	}
+
+	// Large group, members are not included in groups/get_info
+	client.groups["g0"].MemberCount = 3
+	client.groups["g0"].Members = nil
+
+	// Deleted after groups/list
+	summaries = append(summaries, &team_common.GroupSummary{GroupId: "deleted"})
+
+	ctx := context.ExecutionContext{
+		DropboxClient: client,
+		Options: cli.Options{
+			DropboxConcurrency: 3,
+		},
+	}
+	dd := DropboxDirectory{
+		executionContext:  ctx,
+		rawGroupSummaries: summaries,
+	}
+	if err := dd.loadGroups(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if client.getInfoCalls != 3 {
+		t.Errorf("Group info should be loaded in batches: calls[%d]", client.getInfoCalls)
+	}
+	if len(dd.rawGroupFullInfo) != numGroups {
+		t.Errorf("Invalid number of groups: %d", len(dd.rawGroupFullInfo))
+	}
+	groups := dd.createGroups()
+	if len(groups["g0"].Members) != 3 {
+		t.Errorf("Members of large group should be loaded by groups/members/list: %v", groups["g0"].Members)
+	}
+	if len(groups["g1"].Members) != 1 {
+		t.Errorf("Invalid members: %v", groups["g1"].Members)
+	}
+}
+
+func TestDropboxDirectory_LoadGroupsNotCached(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	client := &dropboxGroupClientMock{
+		groups: map[string]*team.GroupFullInfo{
+			"g1": {GroupId: "g1", GroupName: "g1", MemberCount: 1, Members: []*team.GroupMemberInfo{dropboxGroupMember("a@example.com")}},
+		},
+	}
+	summaries := []*team_common.GroupSummary{
+		{GroupId: "g1", GroupName: "g1", MemberCount: 1},
+	}
+	ctx := context.ExecutionContext{
+		DropboxClient: client,
+		Options: cli.Options{
+			BasePath:           dir,
+			DropboxConcurrency: 1,
+			CacheTTL:           10 * time.Minute,
+		},
+	}
+	load := func() map[string]Group {
+		dd := DropboxDirectory{
+			executionContext:  ctx,
+			rawGroupSummaries: summaries,
+		}
+		if err := dd.loadGroups(); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		return dd.createGroups()
+	}
+
+	load()
+
+	// Member swapped without changing the number of members
+	client.groups["g1"].Members = []*team.GroupMemberInfo{dropboxGroupMember("b@example.com")}
+	groups := load()
+	if client.getInfoCalls != 2 {
+		t.Errorf("Groups should be loaded from Dropbox on each load: calls[%d]", client.getInfoCalls)
+	}
+	if _, e := groups["g1"].Members["b@example.com"]; !e || len(groups["g1"].Members) != 1 {
+		t.Errorf("Swapped member should be loaded: %v", groups["g1"].Members)
+	}
+}
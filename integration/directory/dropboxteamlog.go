@@ -0,0 +1,95 @@
+package directory
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team_common"
+	"github.com/dropbox/dropbox-sdk-go-unofficial/dropbox/team_log"
+	"github.com/watermint/dcfg/integration/connector"
+	"github.com/watermint/dcfg/integration/context"
+	"time"
+)
+
+// Changes of members and groups by team events. Requires the client of the
+// Team auditing token.
+type DropboxTeamLogFeed struct {
+	ExecutionContext context.ExecutionContext
+}
+
+var dropboxTeamLogCategories = []string{
+	team_log.EventCategoryMembers,
+	team_log.EventCategoryGroups,
+}
+
+func (f *DropboxTeamLogFeed) Collect(since, until time.Time, changes *ChangeSet) error {
+	client := f.ExecutionContext.DropboxAuditClient
+	policy := f.ExecutionContext.RetryPolicy()
+
+	for _, category := range dropboxTeamLogCategories {
+		seelog.Tracef("Loading Dropbox team events: Category[%s] Since[%s] Until[%s]", category, since, until)
+		arg := team_log.NewGetTeamEventsArg()
+		arg.Time = &team_common.TimeRange{
+			StartTime: &since,
+			EndTime:   &until,
+		}
+		arg.Category = &team_log.EventCategory{
+			Tagged: dropbox.Tagged{Tag: category},
+		}
+		var r *team_log.GetTeamEventsResult
+		err := connector.Call(policy, "TeamLogGetEvents", func() (err error) {
+			r, err = client.GetEvents(arg)
+			return
+		})
+		if err != nil {
+			seelog.Errorf("Unable to load Dropbox team events: Category[%s] Err[%v]", category, err)
+			return err
+		}
+		collectDropboxEvents(r.Events, changes)
+
+		for r.HasMore {
+			arg := team_log.NewGetTeamEventsContinueArg(r.Cursor)
+			err := connector.Call(policy, "TeamLogGetEventsContinue", func() (err error) {
+				r, err = client.GetEventsContinue(arg)
+				return
+			})
+			if err != nil {
+				seelog.Errorf("Unable to load Dropbox team events: Category[%s] Err[%v]", category, err)
+				return err
+			}
+			collectDropboxEvents(r.Events, changes)
+		}
+	}
+	return nil
+}
+
+func collectDropboxEvents(events []*team_log.TeamEvent, changes *ChangeSet) {
+	for _, e := range events {
+		if e.Context != nil && e.Context.Tag == team_log.ContextLogInfoTeamMember && e.Context.TeamMember != nil {
+			changes.AddUser(e.Context.TeamMember.Email)
+		}
+		for _, p := range e.Participants {
+			switch p.Tag {
+			case team_log.ParticipantLogInfoUser:
+				changes.AddUser(dropboxUserLogInfoEmail(p.User))
+			case team_log.ParticipantLogInfoGroup:
+				if p.Group != nil {
+					changes.AddDropboxGroup(p.Group.GroupId)
+				}
+			}
+		}
+	}
+	seelog.Tracef("Dropbox team events loaded (chunk): %d event(s)", len(events))
+}
+
+func dropboxUserLogInfoEmail(user team_log.IsUserLogInfo) string {
+	switch u := user.(type) {
+	case *team_log.TeamMemberLogInfo:
+		return u.Email
+	case *team_log.NonTeamMemberLogInfo:
+		return u.Email
+	case *team_log.UserLogInfo:
+		return u.Email
+	default:
+		return ""
+	}
+}
@@ -3,18 +3,31 @@ package directory
 import (
 	"fmt"
 	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/common/util"
 	"github.com/watermint/dcfg/integration/context"
 	"google.golang.org/api/admin/directory/v1"
+	"strings"
+	"sync"
 )
 
 type GoogleDirectory struct {
 	googleApps GoogleApps
 
+	// Expansion of nested groups
+	maxDepth    int
+	concurrency int
+
 	// All emails
 	emailTypes map[string]int
 
 	// Abstract data structure
 	accounts map[string]Account
+
+	// Group email -> nested groups found on the last expansion
+	nestedGroups      map[string][]string
+	nestedGroupsMutex sync.Mutex
 }
 
 const (
@@ -23,40 +36,54 @@ const (
 	GOOGLE_EMAIL_TYPE_ALIAS
 )
 
-func NewGoogleDirectory(executionContext context.ExecutionContext) *GoogleDirectory {
-	gd := GoogleDirectory{
-		googleApps: NewGoogleApps(executionContext),
-	}
-	gd.load()
-	return &gd
+func NewGoogleDirectory(executionContext context.ExecutionContext) (*GoogleDirectory, error) {
+	o := executionContext.Options
+	return newGoogleDirectory(NewGoogleApps(executionContext), o.GoogleGroupMaxDepth, o.GoogleConcurrency)
 }
 
-func NewGoogleDirectoryForTest(ga GoogleApps) *GoogleDirectory {
+func NewGoogleDirectoryForTest(ga GoogleApps) (*GoogleDirectory, error) {
+	return newGoogleDirectory(ga, cli.DEFAULT_GOOGLE_GROUP_MAX_DEPTH, cli.DEFAULT_GOOGLE_CONCURRENCY)
+}
+
+func newGoogleDirectory(ga GoogleApps, maxDepth, concurrency int) (*GoogleDirectory, error) {
 	gd := GoogleDirectory{
-		googleApps: ga,
+		googleApps:   ga,
+		maxDepth:     maxDepth,
+		concurrency:  concurrency,
+		nestedGroups: make(map[string][]string),
+	}
+	if err := gd.load(); err != nil {
+		return nil, err
 	}
-	gd.load()
-	return &gd
+	return &gd, nil
 }
 
-func (g *GoogleDirectory) Group(groupKey string) (Group, bool) {
+func (g *GoogleDirectory) Group(groupKey string) (Group, bool, error) {
 	seelog.Tracef("Loading Google Group: GroupId[%s]", groupKey)
-	group, exist := FindGroup(g.googleApps, groupKey)
-	if !exist {
-		return Group{}, false
+	group, exist, err := FindGroup(g.googleApps, groupKey)
+	if err != nil || !exist {
+		return Group{}, false, err
 	}
-
-	return g.createGroup(group), true
+	g2, err := g.createGroup(group)
+	if err != nil {
+		return Group{}, false, err
+	}
+	return g2, true, nil
 }
 
-func (g *GoogleDirectory) createGroup(rawGroup *admin.Group) Group {
-	rawMembers := g.googleApps.GroupMembers(rawGroup.Email)
+// GroupId of Google Group is the primary email of the group (see createGroup).
+func (g *GoogleDirectory) GroupId(groupKey string) (string, bool, error) {
+	group, exist, err := g.googleApps.Group(groupKey)
+	if err != nil || !exist {
+		return "", false, err
+	}
+	return group.Email, true, nil
+}
 
-	members := map[string]Account{}
-	for _, x := range rawMembers {
-		for _, y := range g.extractMember(x, rawGroup.Email, 0) {
-			members[y.Email] = y
-		}
+func (g *GoogleDirectory) createGroup(rawGroup *admin.Group) (Group, error) {
+	members, err := g.expandMembers(rawGroup.Email)
+	if err != nil {
+		return Group{}, err
 	}
 	group := Group{
 		GroupId:    rawGroup.Email,
@@ -65,10 +92,129 @@ func (g *GoogleDirectory) createGroup(rawGroup *admin.Group) Group {
 		Members:    members,
 	}
 
-	return group
+	return group, nil
+}
+
+// Expand members of the group including members of nested groups. Nested groups
+// are expanded level by level, and members of groups in the same level are
+// loaded in parallel. Each group is expanded only once, and cycles are reported.
+func (g *GoogleDirectory) expandMembers(groupEmail string) (map[string]Account, error) {
+	members := make(map[string]Account)
+	nested := make([]string, 0)
+
+	// Group email -> path of groups from the root group
+	ancestors := map[string][]string{
+		groupEmail: {},
+	}
+	level := []string{groupEmail}
+	for nest := 0; len(level) > 0; nest++ {
+		loaded, err := g.loadGroupMembers(level)
+		if err != nil {
+			return nil, err
+		}
+		next := make([]string, 0)
+		for _, parent := range level {
+			path := append(append([]string{}, ancestors[parent]...), parent)
+			for _, member := range loaded[parent] {
+				if member.Type == "CUSTOMER" && !util.ContainsString(nested, NESTED_GROUP_CUSTOMER) {
+					nested = append(nested, NESTED_GROUP_CUSTOMER)
+				}
+				if member.Type != "GROUP" {
+					extracted, err := g.extractMember(member, parent, nest)
+					if err != nil {
+						return nil, err
+					}
+					for _, x := range extracted {
+						members[x.Email] = x
+					}
+					continue
+				}
+
+				child := member.Email
+				if _, visited := ancestors[child]; visited {
+					if util.ContainsString(path, child) {
+						seelog.Warnf("Google Group: Cycle of nested groups detected, ignored: Path[%s -> %s]", strings.Join(path, " -> "), child)
+					} else {
+						seelog.Tracef("Google Group: Already expanded: Nest[%d] Parent[%s] ChildGroupEmail[%s]", nest, parent, child)
+					}
+					continue
+				}
+				if nest+1 > g.maxDepth {
+					seelog.Warnf("Google Group: Nested group exceeds max depth, ignored: MaxDepth[%d] Path[%s -> %s]", g.maxDepth, strings.Join(path, " -> "), child)
+					explorer.ReportFailure("Members of nested Google Group ignored: %s (reason: exceeds max depth %d in Google Group %s)", child, g.maxDepth, groupEmail)
+					continue
+				}
+				seelog.Tracef("Google Group: Loading Group: Nest[%d] Parent[%s], ChildGroupEmail[%s]", nest, parent, child)
+				ancestors[child] = path
+				next = append(next, child)
+				nested = append(nested, child)
+			}
+		}
+		level = next
+	}
+
+	g.nestedGroupsMutex.Lock()
+	g.nestedGroups[groupEmail] = nested
+	g.nestedGroupsMutex.Unlock()
+	return members, nil
+}
+
+func (g *GoogleDirectory) NestedGroups(groupEmail string) ([]string, bool) {
+	g.nestedGroupsMutex.Lock()
+	defer g.nestedGroupsMutex.Unlock()
+	nested, e := g.nestedGroups[groupEmail]
+	return nested, e
 }
 
-func (g *GoogleDirectory) extractMember(member *admin.Member, parentGroupKey string, nest int) (members map[string]Account) {
+// Load members of groups in parallel, up to the concurrency.
+func (g *GoogleDirectory) loadGroupMembers(groupEmails []string) (map[string][]*admin.Member, error) {
+	concurrency := g.concurrency
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	loaded := make(map[string][]*admin.Member)
+	var loadErr error
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	queue := make(chan string)
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for groupEmail := range queue {
+				mutex.Lock()
+				failed := loadErr != nil
+				mutex.Unlock()
+				if failed {
+					continue
+				}
+
+				members, err := g.googleApps.GroupMembers(groupEmail)
+
+				mutex.Lock()
+				if err != nil && loadErr == nil {
+					loadErr = err
+				}
+				loaded[groupEmail] = members
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, x := range groupEmails {
+		queue <- x
+	}
+	close(queue)
+	wg.Wait()
+
+	if loadErr != nil {
+		return nil, loadErr
+	}
+	return loaded, nil
+}
+
+// Extract users of the member. Nested groups are expanded by expandMembers.
+func (g *GoogleDirectory) extractMember(member *admin.Member, parentGroupKey string, nest int) (members map[string]Account, err error) {
 	members = make(map[string]Account)
 	switch member.Type {
 	case "USER":
@@ -78,18 +224,13 @@ func (g *GoogleDirectory) extractMember(member *admin.Member, parentGroupKey str
 		members[member.Email] = Account{
 			Email: member.Email,
 		}
-	case "GROUP":
-		seelog.Tracef("Google Group: Loading Group: Nest[%d] Parent[%s], ChildGroupEmail[%s]", nest, parentGroupKey, member.Email)
-		childMembers := g.googleApps.GroupMembers(member.Email)
-		for _, x := range childMembers {
-			y := g.extractMember(x, member.Email, nest+1)
-			for _, z := range y {
-				members[z.Email] = z
-			}
-		}
 	case "CUSTOMER":
 		seelog.Tracef("Google Group: Loading Customer: Nest[%d] Parent[%s] Customer[%s]", nest, parentGroupKey, member.Id)
-		for _, user := range g.googleApps.CustomerUsers(member.Id) {
+		users, err := g.googleApps.CustomerUsers(member.Id)
+		if err != nil {
+			return nil, err
+		}
+		for _, user := range users {
 			_, emails := UserEmails(user)
 
 			for _, e := range emails {
@@ -105,16 +246,24 @@ func (g *GoogleDirectory) extractMember(member *admin.Member, parentGroupKey str
 	return
 }
 
-func (g *GoogleDirectory) preloadEmails() {
+func (g *GoogleDirectory) preloadEmails() error {
 	g.emailTypes = make(map[string]int)
 
 	// Group emails
-	for _, group := range g.googleApps.Groups() {
+	groups, err := g.googleApps.Groups()
+	if err != nil {
+		return err
+	}
+	for _, group := range groups {
 		g.emailTypes[group.Email] = GOOGLE_EMAIL_TYPE_GROUP
 	}
 
 	// User emails
-	for _, user := range g.googleApps.Users() {
+	users, err := g.googleApps.Users()
+	if err != nil {
+		return err
+	}
+	for _, user := range users {
 		primary, emails := UserEmails(user)
 
 		for _, e := range emails {
@@ -128,20 +277,39 @@ func (g *GoogleDirectory) preloadEmails() {
 		// overwrite primary email
 		g.emailTypes[primary] = GOOGLE_EMAIL_TYPE_USER
 	}
+	return nil
 }
 
-func (g *GoogleDirectory) load() {
-	g.preloadEmails()
-	g.accounts = g.createAccounts()
+func (g *GoogleDirectory) load() error {
+	if err := g.preloadEmails(); err != nil {
+		return err
+	}
+	accounts, err := g.createAccounts()
+	if err != nil {
+		return err
+	}
+	g.accounts = accounts
+	return nil
 }
 
-func (g *GoogleDirectory) createAccounts() (accounts map[string]Account) {
+func (g *GoogleDirectory) createAccounts() (accounts map[string]Account, err error) {
+	users, err := g.googleApps.Users()
+	if err != nil {
+		return nil, err
+	}
 	accounts = make(map[string]Account)
-	for _, u := range g.googleApps.Users() {
+	for _, u := range users {
+		status := ACCOUNT_STATUS_ACTIVE
+		if u.Suspended {
+			status = ACCOUNT_STATUS_SUSPENDED
+		}
 		accounts[u.PrimaryEmail] = Account{
 			Email:     u.PrimaryEmail,
 			GivenName: u.Name.GivenName,
 			Surname:   u.Name.FamilyName,
+			Status:    status,
+
+			CorrelationId: u.Id,
 		}
 	}
 	return
@@ -260,5 +428,7 @@ func CreateGoogleDirectoryForIntegrationTest() *GoogleDirectory {
 		MockGroups:  groups,
 	}
 
-	return NewGoogleDirectoryForTest(&ga)
+	// Mock never fails without MockErrors
+	gd, _ := NewGoogleDirectoryForTest(&ga)
+	return gd
 }
@@ -1,6 +1,9 @@
 package directory
 
 import (
+	"errors"
+	"fmt"
+	"github.com/watermint/dcfg/cli"
 	"github.com/watermint/dcfg/integration/context"
 	"google.golang.org/api/admin/directory/v1"
 	"testing"
@@ -13,7 +16,10 @@ func TestGoogleDirectory_Load(t *testing.T) {
 	}
 	ctx.InitGoogleClient()
 
-	gd := NewGoogleDirectory(ctx)
+	gd, err := NewGoogleDirectory(ctx)
+	if err != nil {
+		t.Fatalf("Unable to load Google directory: %v", err)
+	}
 	accounts := gd.Accounts()
 	if len(accounts) < 1 {
 		t.Error("No accounts loaded from Google")
@@ -30,22 +36,58 @@ func TestGoogleDirectory_GroupSimple(t *testing.T) {
 			},
 		},
 	}
-	gd := NewGoogleDirectoryForTest(&ga)
+	gd, err := NewGoogleDirectoryForTest(&ga)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
 
-	g1, e1 := gd.Group("id-g1")
+	g1, e1, _ := gd.Group("id-g1")
 	if !e1 || g1.GroupId != "g1@example.com" || g1.GroupEmail != "g1@example.com" || g1.GroupName != "g1" {
 		t.Errorf("Invalid result: %v", g1)
 	}
-	g2, e2 := gd.Group("g1@example.com")
+	g2, e2, _ := gd.Group("g1@example.com")
 	if !e2 || g2.GroupId != "g1@example.com" || g2.GroupEmail != "g1@example.com" || g2.GroupName != "g1" {
 		t.Errorf("Invalid result: %v", g2)
 	}
-	_, e3 := gd.Group("noexistent")
+	_, e3, _ := gd.Group("noexistent")
 	if e3 {
 		t.Errorf("Invalid state")
 	}
 }
 
+func TestGoogleDirectory_LoadError(t *testing.T) {
+	ga := GoogleAppsMock{
+		MockErrors: map[string]error{
+			"users": errors.New("backend error"),
+		},
+	}
+	if _, err := NewGoogleDirectoryForTest(&ga); err == nil {
+		t.Error("Error should be returned if users cannot be loaded")
+	}
+}
+
+func TestGoogleDirectory_GroupMembersError(t *testing.T) {
+	ga := GoogleAppsMock{
+		MockGroups: []*admin.Group{
+			&admin.Group{
+				Id:    "id-g1",
+				Name:  "g1",
+				Email: "g1@example.com",
+			},
+		},
+		MockErrors: map[string]error{
+			"g1@example.com": errors.New("backend error"),
+		},
+	}
+	gd, err := NewGoogleDirectoryForTest(&ga)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, _, err := gd.Group("g1@example.com"); err == nil {
+		t.Error("Error should be returned if group members cannot be loaded")
+	}
+}
+
 func TestGoogleDirectory_GroupComplex(t *testing.T) {
 	gd := CreateGoogleDirectoryForIntegrationTest()
 
@@ -71,3 +113,125 @@ func TestGoogleDirectory_GroupComplex(t *testing.T) {
 		}
 	}
 }
+
+func googleAppsWithCacheForTest(ga GoogleApps) GoogleApps {
+	cache := &GoogleAppsWithCache{
+		Resolver: ga,
+	}
+	cache.Preload()
+	return cache
+}
+
+func googleGroupMember(memberType, email string) *admin.Member {
+	return &admin.Member{
+		Type:  memberType,
+		Email: email,
+	}
+}
+
+func TestGoogleDirectory_GroupCycle(t *testing.T) {
+	ga := GoogleAppsMock{
+		MockGroups: []*admin.Group{
+			{Id: "id-g1", Name: "g1", Email: "g1@example.com"},
+		},
+		MockMembers: map[string][]*admin.Member{
+			"g1@example.com": {
+				googleGroupMember("USER", "a@example.com"),
+				googleGroupMember("GROUP", "g2@example.com"),
+				googleGroupMember("GROUP", "g3@example.com"),
+			},
+			"g2@example.com": {
+				googleGroupMember("USER", "b@example.com"),
+				googleGroupMember("GROUP", "g1@example.com"),
+				googleGroupMember("GROUP", "g4@example.com"),
+			},
+			"g3@example.com": {
+				googleGroupMember("USER", "c@example.com"),
+				googleGroupMember("GROUP", "g4@example.com"),
+			},
+			"g4@example.com": {
+				googleGroupMember("USER", "d@example.com"),
+				googleGroupMember("GROUP", "g2@example.com"),
+			},
+		},
+	}
+	gd, err := NewGoogleDirectoryForTest(googleAppsWithCacheForTest(&ga))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	g1, e1, err := gd.Group("g1@example.com")
+	if err != nil || !e1 {
+		t.Fatalf("Unexpected result: exists[%t] err[%v]", e1, err)
+	}
+	for _, x := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com"} {
+		if _, e := g1.Members[x]; !e {
+			t.Errorf("Member not found: %s", x)
+		}
+	}
+	if len(g1.Members) != 4 {
+		t.Errorf("Unexpected members: %v", g1.Members)
+	}
+	if nested, e := gd.NestedGroups("g1@example.com"); !e || fmt.Sprint(nested) != "[g2@example.com g3@example.com g4@example.com]" {
+		t.Errorf("Unexpected nested groups: %v", nested)
+	}
+}
+
+func TestGoogleDirectory_GroupMaxDepth(t *testing.T) {
+	ga := GoogleAppsMock{
+		MockGroups: []*admin.Group{
+			{Id: "id-g0", Name: "g0", Email: "g0@example.com"},
+		},
+		MockMembers: make(map[string][]*admin.Member),
+	}
+	for i := 0; i < 4; i++ {
+		ga.MockMembers[fmt.Sprintf("g%d@example.com", i)] = []*admin.Member{
+			googleGroupMember("USER", fmt.Sprintf("u%d@example.com", i)),
+			googleGroupMember("GROUP", fmt.Sprintf("g%d@example.com", i+1)),
+		}
+	}
+	gd, err := newGoogleDirectory(&ga, 2, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	g0, _, err := gd.Group("g0@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, x := range []string{"u0@example.com", "u1@example.com", "u2@example.com"} {
+		if _, e := g0.Members[x]; !e {
+			t.Errorf("Member not found: %s", x)
+		}
+	}
+	if len(g0.Members) != 3 {
+		t.Errorf("Members of groups deeper than max depth should be ignored: %v", g0.Members)
+	}
+}
+
+func TestGoogleDirectory_GroupConcurrent(t *testing.T) {
+	ga := GoogleAppsMock{
+		MockGroups: []*admin.Group{
+			{Id: "id-root", Name: "root", Email: "root@example.com"},
+		},
+		MockMembers: make(map[string][]*admin.Member),
+	}
+	numGroups := 50
+	for i := 0; i < numGroups; i++ {
+		child := fmt.Sprintf("g%d@example.com", i)
+		ga.MockMembers["root@example.com"] = append(ga.MockMembers["root@example.com"], googleGroupMember("GROUP", child))
+		ga.MockMembers[child] = []*admin.Member{
+			googleGroupMember("USER", fmt.Sprintf("u%d@example.com", i)),
+			googleGroupMember("GROUP", fmt.Sprintf("g%d@example.com", (i+1)%numGroups)),
+		}
+	}
+	gd, err := newGoogleDirectory(googleAppsWithCacheForTest(&ga), cli.DEFAULT_GOOGLE_GROUP_MAX_DEPTH, 8)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	root, _, err := gd.Group("root@example.com")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(root.Members) != numGroups {
+		t.Errorf("Unexpected number of members: %d", len(root.Members))
+	}
+}
@@ -2,20 +2,34 @@ package directory
 
 import (
 	"github.com/cihub/seelog"
-	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/common/metrics"
 	"github.com/watermint/dcfg/integration/auth"
+	"github.com/watermint/dcfg/integration/connector"
 	"github.com/watermint/dcfg/integration/context"
+	"golang.org/x/oauth2"
 	"google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+	"net"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
 type GoogleApps interface {
 	Preload()
 
-	Users() []*admin.User
-	Groups() []*admin.Group
-	GroupMembers(groupEmail string) []*admin.Member
-	CustomerUsers(customerId string) []*admin.User
+	Users() ([]*admin.User, error)
+	Groups() ([]*admin.Group, error)
+	GroupMembers(groupEmail string) ([]*admin.Member, error)
+	CustomerUsers(customerId string) ([]*admin.User, error)
+
+	// Load the group by group key (email, alias or id) without members.
+	// Returns false if Google API confirmed the group does not exist.
+	Group(groupKey string) (*admin.Group, bool, error)
 }
 
 func NewGoogleApps(ctx context.ExecutionContext) GoogleApps {
@@ -30,13 +44,17 @@ func NewGoogleApps(ctx context.ExecutionContext) GoogleApps {
 	return cache
 }
 
-func FindGroup(googleApps GoogleApps, groupKey string) (*admin.Group, bool) {
-	for _, x := range googleApps.Groups() {
+func FindGroup(googleApps GoogleApps, groupKey string) (*admin.Group, bool, error) {
+	groups, err := googleApps.Groups()
+	if err != nil {
+		return nil, false, err
+	}
+	for _, x := range groups {
 		if x.Id == groupKey || x.Email == groupKey {
-			return x, true
+			return x, true, nil
 		}
 	}
-	return nil, false
+	return nil, false, nil
 }
 
 func UserEmails(user *admin.User) (primary string, emails []string) {
@@ -69,7 +87,11 @@ func UserEmails(user *admin.User) (primary string, emails []string) {
 	return user.PrimaryEmail, emails
 }
 
+// Cache of GoogleApps. Safe for concurrent use, but concurrent calls for the same
+// key might load the data more than once.
 type GoogleAppsWithCache struct {
+	mutex sync.Mutex
+
 	// flags for lazy loading
 	lazyUsers         bool
 	lazyGroups        bool
@@ -87,59 +109,98 @@ type GoogleAppsWithCache struct {
 }
 
 func (g *GoogleAppsWithCache) Preload() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
 	g.lazyGroupMembers = make(map[string]bool)
 	g.lazyCustomerUsers = make(map[string]bool)
 	g.cacheGroupMembers = make(map[string][]*admin.Member)
 	g.cacheCustomerUsers = make(map[string][]*admin.User)
 }
 
-func (g *GoogleAppsWithCache) Users() []*admin.User {
-	if !g.lazyUsers {
-		g.cacheUsers = g.Resolver.Users()
-		g.lazyUsers = true
+func (g *GoogleAppsWithCache) Users() ([]*admin.User, error) {
+	g.mutex.Lock()
+	if g.lazyUsers {
+		defer g.mutex.Unlock()
+		return g.cacheUsers, nil
 	}
-	return g.cacheUsers
-}
+	g.mutex.Unlock()
 
-func (g *GoogleAppsWithCache) Groups() []*admin.Group {
-	if !g.lazyGroups {
-		g.cacheGroups = g.Resolver.Groups()
-		g.lazyGroups = true
+	users, err := g.Resolver.Users()
+	if err != nil {
+		return nil, err
 	}
-	return g.cacheGroups
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.cacheUsers = users
+	g.lazyUsers = true
+	return users, nil
 }
 
-func (g *GoogleAppsWithCache) GroupMembers(groupEmail string) []*admin.Member {
-	if v, e := g.lazyGroupMembers[groupEmail]; !v || !e {
-		g.cacheGroupMembers[groupEmail] = g.Resolver.GroupMembers(groupEmail)
-		g.lazyGroupMembers[groupEmail] = true
+func (g *GoogleAppsWithCache) Groups() ([]*admin.Group, error) {
+	g.mutex.Lock()
+	if g.lazyGroups {
+		defer g.mutex.Unlock()
+		return g.cacheGroups, nil
 	}
-	m, e := g.cacheGroupMembers[groupEmail]
-	// Should not happen on runtime
-	if !e {
-		seelog.Errorf("Inconsistent cache state: groupEmail[%s]", groupEmail)
-		explorer.FatalShutdown("Please file issue on project page")
+	g.mutex.Unlock()
+
+	groups, err := g.Resolver.Groups()
+	if err != nil {
+		return nil, err
 	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.cacheGroups = groups
+	g.lazyGroups = true
+	return groups, nil
+}
 
-	return m
+// Not cached, the group is loaded only for the group key.
+func (g *GoogleAppsWithCache) Group(groupKey string) (*admin.Group, bool, error) {
+	return g.Resolver.Group(groupKey)
 }
 
-func (g *GoogleAppsWithCache) CustomerUsers(customerId string) []*admin.User {
-	if v, e := g.lazyCustomerUsers[customerId]; !v || !e {
-		g.cacheCustomerUsers[customerId] = g.Resolver.CustomerUsers(customerId)
-		g.lazyCustomerUsers[customerId] = true
+func (g *GoogleAppsWithCache) GroupMembers(groupEmail string) ([]*admin.Member, error) {
+	g.mutex.Lock()
+	if g.lazyGroupMembers[groupEmail] {
+		defer g.mutex.Unlock()
+		return g.cacheGroupMembers[groupEmail], nil
 	}
-	u, e := g.cacheCustomerUsers[customerId]
-	// Should not happen on runtime
-	if !e {
-		seelog.Errorf("Inconsistent cache state: customerId[%s]", customerId)
-		explorer.FatalShutdown("Please file issue on project page")
+	g.mutex.Unlock()
+
+	members, err := g.Resolver.GroupMembers(groupEmail)
+	if err != nil {
+		return nil, err
 	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.cacheGroupMembers[groupEmail] = members
+	g.lazyGroupMembers[groupEmail] = true
+	return members, nil
+}
 
-	return u
+func (g *GoogleAppsWithCache) CustomerUsers(customerId string) ([]*admin.User, error) {
+	g.mutex.Lock()
+	if g.lazyCustomerUsers[customerId] {
+		defer g.mutex.Unlock()
+		return g.cacheCustomerUsers[customerId], nil
+	}
+	g.mutex.Unlock()
+
+	users, err := g.Resolver.CustomerUsers(customerId)
+	if err != nil {
+		return nil, err
+	}
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.cacheCustomerUsers[customerId] = users
+	g.lazyCustomerUsers[customerId] = true
+	return users, nil
 }
 
 const (
+	CACHE_API_GOOGLE = "google"
+
 	googleLoadChunkSize = 200
 )
 
@@ -150,29 +211,33 @@ type GoogleAppsImpl struct {
 func (g *GoogleAppsImpl) Preload() {
 }
 
-func (g *GoogleAppsImpl) Users() []*admin.User {
-	rawUsers := make([]*admin.User, 0, googleLoadChunkSize)
-	client := g.ExecutionContext.GoogleClient
+// Load through the on-disk cache. The ETag is used only if the result fits in
+// one page, because the ETag of the first page does not cover following pages.
+// `load` returns the fetched data, and the data is stored into `data` only if it
+// was actually fetched. On 304 Not Modified, `data` keeps the cached data.
+func (g *GoogleAppsImpl) loadWithCache(request string, data interface{}, load func(etag string) (interface{}, string, error)) error {
+	return g.ExecutionContext.Cache().Load(CACHE_API_GOOGLE, request, data, func(etag string) (string, bool, error) {
+		loaded, newEtag, err := load(etag)
+		if googleapi.IsNotModified(err) {
+			return etag, true, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		reflect.ValueOf(data).Elem().Set(reflect.ValueOf(loaded))
+		return newEtag, false, nil
+	})
+}
 
+func (g *GoogleAppsImpl) Users() ([]*admin.User, error) {
+	var rawUsers []*admin.User
 	seelog.Tracef("Loading Google Users")
-	users, err := client.Users.List().MaxResults(googleLoadChunkSize).Customer(auth.GOOGLE_CUSTOMER_ID).Do()
+	err := g.loadWithCache("users", &rawUsers, func(etag string) (interface{}, string, error) {
+		return g.loadUsers(auth.GOOGLE_CUSTOMER_ID, etag)
+	})
 	if err != nil {
 		seelog.Errorf("Unable to load Google Users: Err[%v]", err)
-		explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google`")
-	}
-	seelog.Tracef("Google User loaded (chunk): %d user(s)", len(users.Users))
-	rawUsers = append(rawUsers, users.Users...)
-	token := users.NextPageToken
-	for token != "" {
-		seelog.Trace("Loading Google Users (with token)")
-		users, err := client.Users.List().MaxResults(googleLoadChunkSize).PageToken(token).Customer(auth.GOOGLE_CUSTOMER_ID).Do()
-		if err != nil {
-			seelog.Errorf("Unable to load Google Users: Err[%v]", err)
-			explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google`")
-		}
-		seelog.Tracef("Google User loaded (chunk): %d user(s), token[%s]", len(users.Users), token)
-		rawUsers = append(rawUsers, users.Users...)
-		token = users.NextPageToken
+		return nil, err
 	}
 	seelog.Tracef("Google users loaded: %d user(s)", len(rawUsers))
 
@@ -182,32 +247,55 @@ func (g *GoogleAppsImpl) Users() []*admin.User {
 	}
 	seelog.Tracef("Loaded Google users: [%s]", strings.Join(traceUsers, ","))
 
-	return rawUsers
+	return rawUsers, nil
 }
 
-func (g *GoogleAppsImpl) Groups() []*admin.Group {
-	rawGroups := make([]*admin.Group, 0, googleLoadChunkSize)
+func (g *GoogleAppsImpl) loadUsers(customerId, etag string) ([]*admin.User, string, error) {
+	rawUsers := make([]*admin.User, 0, googleLoadChunkSize)
 	client := g.ExecutionContext.GoogleClient
 
-	seelog.Tracef("Loading Google Groups")
-	groups, err := client.Groups.List().MaxResults(googleLoadChunkSize).Customer(auth.GOOGLE_CUSTOMER_ID).Do()
+	var r *admin.Users
+	err := callGoogle(g.ExecutionContext, "Users.List", func() (err error) {
+		r, err = client.Users.List().Customer(customerId).MaxResults(googleLoadChunkSize).IfNoneMatch(etag).Do()
+		return
+	})
 	if err != nil {
-		seelog.Errorf("Unable to load Google Groups: Err[%v]", err)
-		explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google`")
+		return nil, "", err
 	}
-	seelog.Tracef("Google Group loaded (chunk): %d group(s)", len(groups.Groups))
-	rawGroups = append(rawGroups, groups.Groups...)
-	token := groups.NextPageToken
+	seelog.Tracef("Google User loaded (chunk): CustomerId[%s] %d user(s)", customerId, len(r.Users))
+	rawUsers = append(rawUsers, r.Users...)
+	token := r.NextPageToken
+	if token != "" {
+		etag = ""
+	} else {
+		etag = r.Etag
+	}
+
 	for token != "" {
-		seelog.Trace("Loading Google Groups (with token)")
-		groups, err := client.Groups.List().MaxResults(googleLoadChunkSize).PageToken(token).Customer(auth.GOOGLE_CUSTOMER_ID).Do()
+		var r *admin.Users
+		err := callGoogle(g.ExecutionContext, "Users.List", func() (err error) {
+			r, err = client.Users.List().Customer(customerId).MaxResults(googleLoadChunkSize).PageToken(token).Do()
+			return
+		})
 		if err != nil {
-			seelog.Errorf("Unable to load Google Groups: Err[%v]", err)
-			explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google`")
+			return nil, "", err
 		}
-		seelog.Tracef("Google Groups loaded (chunk): %d groups(s), token[%s]", len(groups.Groups), token)
-		rawGroups = append(rawGroups, groups.Groups...)
-		token = groups.NextPageToken
+		seelog.Tracef("Google User loaded (chunk): CustomerId[%s] %d user(s), token[%s]", customerId, len(r.Users), token)
+		rawUsers = append(rawUsers, r.Users...)
+		token = r.NextPageToken
+	}
+	return rawUsers, etag, nil
+}
+
+func (g *GoogleAppsImpl) Groups() ([]*admin.Group, error) {
+	var rawGroups []*admin.Group
+	seelog.Tracef("Loading Google Groups")
+	err := g.loadWithCache("groups", &rawGroups, func(etag string) (interface{}, string, error) {
+		return g.loadGroups(etag)
+	})
+	if err != nil {
+		seelog.Errorf("Unable to load Google Groups: Err[%v]", err)
+		return nil, err
 	}
 	seelog.Tracef("Google group(s) loaded: %d group(s)", len(rawGroups))
 
@@ -217,31 +305,77 @@ func (g *GoogleAppsImpl) Groups() []*admin.Group {
 	}
 	seelog.Tracef("Loaded Google groups: [%s]", strings.Join(traceGroups, ","))
 
-	return rawGroups
+	return rawGroups, nil
 }
 
-func (g *GoogleAppsImpl) GroupMembers(groupEmail string) []*admin.Member {
-	rawMember := make([]*admin.Member, 0, googleLoadChunkSize)
-	seelog.Tracef("Loading members of Google Group: GroupKey[%s]", groupEmail)
+func (g *GoogleAppsImpl) loadGroups(etag string) ([]*admin.Group, string, error) {
+	rawGroups := make([]*admin.Group, 0, googleLoadChunkSize)
 	client := g.ExecutionContext.GoogleClient
 
-	m, err := client.Members.List(groupEmail).MaxResults(googleLoadChunkSize).Do()
+	var groups *admin.Groups
+	err := callGoogle(g.ExecutionContext, "Groups.List", func() (err error) {
+		groups, err = client.Groups.List().MaxResults(googleLoadChunkSize).Customer(auth.GOOGLE_CUSTOMER_ID).IfNoneMatch(etag).Do()
+		return
+	})
 	if err != nil {
-		seelog.Errorf("Unable to load Google Group Member: err[%s]", err)
-		explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google`")
+		return nil, "", err
 	}
-	seelog.Tracef("Google Members of Group loaded: GroupKey[%s]: %d member(s)", groupEmail, len(m.Members))
-	rawMember = append(rawMember, m.Members...)
-	token := m.NextPageToken
+	seelog.Tracef("Google Group loaded (chunk): %d group(s)", len(groups.Groups))
+	rawGroups = append(rawGroups, groups.Groups...)
+	token := groups.NextPageToken
+	if token != "" {
+		etag = ""
+	} else {
+		etag = groups.Etag
+	}
+
 	for token != "" {
-		m, err := client.Members.List(groupEmail).MaxResults(googleLoadChunkSize).PageToken(token).Do()
+		seelog.Trace("Loading Google Groups (with token)")
+		var groups *admin.Groups
+		err := callGoogle(g.ExecutionContext, "Groups.List", func() (err error) {
+			groups, err = client.Groups.List().MaxResults(googleLoadChunkSize).PageToken(token).Customer(auth.GOOGLE_CUSTOMER_ID).Do()
+			return
+		})
 		if err != nil {
-			seelog.Errorf("Unable to load Google Group member (with token): Err[%s]", err)
-			explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google`")
+			return nil, "", err
 		}
-		seelog.Tracef("Google Members of Group loaded: GroupKey[%s]: %d member(s)", groupEmail, len(m.Members))
-		rawMember = append(rawMember, m.Members...)
-		token = m.NextPageToken
+		seelog.Tracef("Google Groups loaded (chunk): %d groups(s), token[%s]", len(groups.Groups), token)
+		rawGroups = append(rawGroups, groups.Groups...)
+		token = groups.NextPageToken
+	}
+	return rawGroups, etag, nil
+}
+
+func (g *GoogleAppsImpl) Group(groupKey string) (*admin.Group, bool, error) {
+	client := g.ExecutionContext.GoogleClient
+
+	seelog.Tracef("Loading Google Group: GroupKey[%s]", groupKey)
+	var group *admin.Group
+	err := callGoogle(g.ExecutionContext, "Groups.Get", func() (err error) {
+		group, err = client.Groups.Get(groupKey).Do()
+		return
+	})
+	if err == nil {
+		seelog.Tracef("Google Group loaded: GroupKey[%s] Email[%s] Id[%s]", groupKey, group.Email, group.Id)
+		return group, true, nil
+	}
+	if IsGoogleErrorNotFound(err) {
+		seelog.Tracef("Google Group not found: GroupKey[%s]", groupKey)
+		return nil, false, nil
+	}
+	seelog.Errorf("Unable to load Google Group: GroupKey[%s] Err[%v]", groupKey, err)
+	return nil, false, err
+}
+
+func (g *GoogleAppsImpl) GroupMembers(groupEmail string) ([]*admin.Member, error) {
+	var rawMember []*admin.Member
+	seelog.Tracef("Loading members of Google Group: GroupKey[%s]", groupEmail)
+	err := g.loadWithCache("members:"+groupEmail, &rawMember, func(etag string) (interface{}, string, error) {
+		return g.loadGroupMembers(groupEmail, etag)
+	})
+	if err != nil {
+		seelog.Errorf("Unable to load Google Group Member: GroupKey[%s] Err[%s]", groupEmail, err)
+		return nil, err
 	}
 	seelog.Tracef("Google member(s) loaded: %d member(s) for groupKey[%s]", len(rawMember), groupEmail)
 	traceMembers := make([]string, len(rawMember))
@@ -250,32 +384,55 @@ func (g *GoogleAppsImpl) GroupMembers(groupEmail string) []*admin.Member {
 	}
 	seelog.Tracef("Loaded Google member for groupKey[%s]: [%s]", groupEmail, strings.Join(traceMembers, ","))
 
-	return rawMember
+	return rawMember, nil
 }
 
-func (g *GoogleAppsImpl) CustomerUsers(customerId string) []*admin.User {
-	rawUsers := make([]*admin.User, 0, googleLoadChunkSize)
+func (g *GoogleAppsImpl) loadGroupMembers(groupEmail, etag string) ([]*admin.Member, string, error) {
+	rawMember := make([]*admin.Member, 0, googleLoadChunkSize)
 	client := g.ExecutionContext.GoogleClient
-	seelog.Tracef("Loading Google Customer Members: CustomerId[%s]", customerId)
 
-	r, err := client.Users.List().Customer(customerId).MaxResults(googleLoadChunkSize).Do()
+	var m *admin.Members
+	err := callGoogle(g.ExecutionContext, "Members.List", func() (err error) {
+		m, err = client.Members.List(groupEmail).MaxResults(googleLoadChunkSize).IfNoneMatch(etag).Do()
+		return
+	})
 	if err != nil {
-		seelog.Errorf("Unable to load Google member in Customer: CustomerId[%s]", customerId)
-		explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google`")
+		return nil, "", err
+	}
+	seelog.Tracef("Google Members of Group loaded: GroupKey[%s]: %d member(s)", groupEmail, len(m.Members))
+	rawMember = append(rawMember, m.Members...)
+	token := m.NextPageToken
+	if token != "" {
+		etag = ""
+	} else {
+		etag = m.Etag
 	}
-	seelog.Tracef("Google Customer Member loaded (chunk): %d", len(r.Users))
-	rawUsers = append(rawUsers, r.Users...)
-	token := r.NextPageToken
 
 	for token != "" {
-		r, err := client.Users.List().Customer(customerId).MaxResults(googleLoadChunkSize).PageToken(token).Do()
+		var m *admin.Members
+		err := callGoogle(g.ExecutionContext, "Members.List", func() (err error) {
+			m, err = client.Members.List(groupEmail).MaxResults(googleLoadChunkSize).PageToken(token).Do()
+			return
+		})
 		if err != nil {
-			seelog.Errorf("Unable to load Google member in Customer: CustomerId[%s]", customerId)
-			explorer.FatalShutdown("Please re-run `-sync` if it's network issue. If it looks like auth issue please re-run `-auth google`")
+			return nil, "", err
 		}
-		seelog.Tracef("Google Customer Member loaded (chunk): %d", len(r.Users))
-		rawUsers = append(rawUsers, r.Users...)
-		token = r.NextPageToken
+		seelog.Tracef("Google Members of Group loaded: GroupKey[%s]: %d member(s)", groupEmail, len(m.Members))
+		rawMember = append(rawMember, m.Members...)
+		token = m.NextPageToken
+	}
+	return rawMember, etag, nil
+}
+
+func (g *GoogleAppsImpl) CustomerUsers(customerId string) ([]*admin.User, error) {
+	var rawUsers []*admin.User
+	seelog.Tracef("Loading Google Customer Members: CustomerId[%s]", customerId)
+	err := g.loadWithCache("customer-users:"+customerId, &rawUsers, func(etag string) (interface{}, string, error) {
+		return g.loadUsers(customerId, etag)
+	})
+	if err != nil {
+		seelog.Errorf("Unable to load Google member in Customer: CustomerId[%s] Err[%v]", customerId, err)
+		return nil, err
 	}
 	seelog.Tracef("Google Customer Member loaded: %d user(s)", len(rawUsers))
 
@@ -285,7 +442,7 @@ func (g *GoogleAppsImpl) CustomerUsers(customerId string) []*admin.User {
 	}
 	seelog.Tracef("Loaded Google users: [%s]", strings.Join(traceUsers, ","))
 
-	return rawUsers
+	return rawUsers, nil
 }
 
 type GoogleAppsMock struct {
@@ -293,62 +450,211 @@ type GoogleAppsMock struct {
 	MockGroups    []*admin.Group
 	MockMembers   map[string][]*admin.Member
 	MockCustomers map[string][]*admin.User
+
+	// "users", "groups", group email or customer id -> error
+	MockErrors map[string]error
 }
 
 func (g *GoogleAppsMock) Preload() {
 }
 
-func (g *GoogleAppsMock) Users() []*admin.User {
-	return g.MockUsers
+func (g *GoogleAppsMock) Users() ([]*admin.User, error) {
+	return g.MockUsers, g.MockErrors["users"]
 }
 
-func (g *GoogleAppsMock) Groups() []*admin.Group {
-	return g.MockGroups
+func (g *GoogleAppsMock) Groups() ([]*admin.Group, error) {
+	return g.MockGroups, g.MockErrors["groups"]
 }
 
-func (g *GoogleAppsMock) GroupMembers(groupEmail string) []*admin.Member {
+func (g *GoogleAppsMock) Group(groupKey string) (*admin.Group, bool, error) {
+	if err, e := g.MockErrors[groupKey]; e {
+		if IsGoogleErrorNotFound(err) {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	for _, x := range g.MockGroups {
+		if x.Id == groupKey || x.Email == groupKey {
+			return x, true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+func (g *GoogleAppsMock) GroupMembers(groupEmail string) ([]*admin.Member, error) {
+	if err, e := g.MockErrors[groupEmail]; e {
+		return nil, err
+	}
 	m, e := g.MockMembers[groupEmail]
 	if e {
-		return m
+		return m, nil
 	} else {
-		return []*admin.Member{}
+		return []*admin.Member{}, nil
 	}
 }
 
-func (g *GoogleAppsMock) CustomerUsers(customerId string) []*admin.User {
+func (g *GoogleAppsMock) CustomerUsers(customerId string) ([]*admin.User, error) {
+	if err, e := g.MockErrors[customerId]; e {
+		return nil, err
+	}
 	m, e := g.MockCustomers[customerId]
 	if e {
-		return m
+		return m, nil
 	} else {
-		return []*admin.User{}
+		return []*admin.User{}, nil
 	}
 }
 
-
 func NewGoogleEmailResolver(ctx context.ExecutionContext) EmailResolver {
 	return &GoogleEmailResolverImpl{
 		ExecutionContext: ctx,
 	}
 }
 
+// True if the error is a genuine "not found" response from Google API.
+func IsGoogleErrorNotFound(err error) bool {
+	if e, ok := err.(*googleapi.Error); ok {
+		return e.Code == http.StatusNotFound
+	}
+	return false
+}
+
+// True if the token is not approved for the scope of the API.
+func IsGoogleErrorInsufficientScope(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok || e.Code != http.StatusForbidden {
+		return false
+	}
+	for _, x := range e.Errors {
+		if x.Reason == "insufficientPermissions" {
+			return true
+		}
+	}
+	return strings.Contains(e.Message, "insufficient authentication scopes")
+}
+
+// True if the error may be resolved by retrying the request later. Errors other
+// than Google API response are transient only if the error is a network error
+// (e.g. timeout). Errors of OAuth2 token refresh are not transient.
+func IsGoogleErrorTransient(err error) bool {
+	e, ok := err.(*googleapi.Error)
+	if !ok {
+		return isNetworkErrorTransient(err)
+	}
+	switch {
+	case e.Code == http.StatusTooManyRequests, e.Code >= http.StatusInternalServerError:
+		return true
+	case e.Code == http.StatusForbidden:
+		for _, x := range e.Errors {
+			switch x.Reason {
+			case "rateLimitExceeded", "userRateLimitExceeded", "quotaExceeded":
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isNetworkErrorTransient(err error) bool {
+	if ue, ok := err.(*url.Error); ok {
+		if ue.Timeout() || ue.Temporary() {
+			return true
+		}
+		err = ue.Err
+	}
+	switch e := err.(type) {
+	case *net.OpError, *net.DNSError:
+		return true
+	case net.Error:
+		return e.Timeout() || e.Temporary()
+	}
+	return false
+}
+
+// True if the token could not be retrieved or refreshed.
+func isOAuth2Error(err error) bool {
+	if ue, ok := err.(*url.Error); ok {
+		err = ue.Err
+	}
+	_, ok := err.(*oauth2.RetrieveError)
+	return ok
+}
+
+// Retry on transient errors. Honour `Retry-After` header if Google API specified.
+func classifyGoogleRetry(err error) (bool, time.Duration) {
+	if !IsGoogleErrorTransient(err) {
+		return false, 0
+	}
+	if e, ok := err.(*googleapi.Error); ok && e.Header != nil {
+		if sec, perr := strconv.Atoi(e.Header.Get("Retry-After")); perr == nil && sec > 0 {
+			return true, time.Duration(sec) * time.Second
+		}
+	}
+	return true, 0
+}
+
+// Kind of the error for metrics, in ERROR_KIND_* of the connector. Returns empty
+// string if err is nil or not modified response.
+func googleErrorKind(err error) string {
+	if err == nil || googleapi.IsNotModified(err) {
+		return ""
+	}
+	e, ok := err.(*googleapi.Error)
+	switch {
+	case !ok && isOAuth2Error(err):
+		return connector.ERROR_KIND_AUTH
+	case !ok && isNetworkErrorTransient(err):
+		return connector.ERROR_KIND_TRANSIENT
+	case !ok:
+		return connector.ERROR_KIND_OTHER
+	case e.Code == http.StatusNotFound:
+		return connector.ERROR_KIND_NOT_FOUND
+	case e.Code == http.StatusUnauthorized:
+		return connector.ERROR_KIND_AUTH
+	case e.Code == http.StatusTooManyRequests || (e.Code == http.StatusForbidden && IsGoogleErrorTransient(err)):
+		return connector.ERROR_KIND_RATE_LIMITED
+	case e.Code >= http.StatusInternalServerError:
+		return connector.ERROR_KIND_TRANSIENT
+	}
+	return connector.ERROR_KIND_OTHER
+}
+
+// Call Google API with the retry policy of the context.
+func callGoogle(ctx context.ExecutionContext, operation string, f func() error) error {
+	attempt := 0
+	return ctx.RetryPolicy().Do(operation, classifyGoogleRetry, func() error {
+		attempt++
+		err := f()
+		metrics.ObserveApiCall(metrics.PROVIDER_GOOGLE, operation, attempt, googleErrorKind(err))
+		return err
+	})
+}
+
 type GoogleEmailResolverImpl struct {
 	ExecutionContext context.ExecutionContext
 }
 
+// Returns true if the user exists, false if Google API confirmed the user does not exist.
+// Returns error if the existence cannot be proven either way.
 func (g *GoogleEmailResolverImpl) EmailExist(email string) (bool, error) {
 	client := g.ExecutionContext.GoogleClient
 
 	seelog.Tracef("Loading Google User for email[%s]", email)
-	u, err := client.Users.Get(email).Do()
-	if err != nil {
-		seelog.Tracef("Unable to load an user email[%s]: error[%s]", email, err)
+	var u *admin.User
+	err := callGoogle(g.ExecutionContext, "Users.Get", func() (err error) {
+		u, err = client.Users.Get(email).Do()
+		return
+	})
+	if err == nil {
+		seelog.Tracef("Loaded user[%s]: Id[%s]", email, u.Id)
+		seelog.Tracef("Loaded user[%s]: Name[%s]", email, u.Name)
+		seelog.Tracef("Loaded user[%s]: CustomerId[%s]", email, u.CustomerId)
+		return true, nil
+	}
+	if IsGoogleErrorNotFound(err) {
+		seelog.Tracef("User not found: email[%s]: error[%s]", email, err)
 		return false, nil
 	}
-	seelog.Tracef("Loaded user[%s]: Id[%s]", email, u.Id)
-	seelog.Tracef("Loaded user[%s]: Name[%s]", email, u.Name)
-	seelog.Tracef("Loaded user[%s]: CustomerId[%s]", email, u.CustomerId)
-
-	client.Users.List().ShowDeleted("true")
-
-	return true, nil
-}
\ No newline at end of file
+	seelog.Warnf("Unable to load an user email[%s]: error[%s]", email, err)
+	return false, err
+}
@@ -1,9 +1,20 @@
 package directory
 
 import (
+	"errors"
 	"fmt"
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/integration/context"
+	"golang.org/x/oauth2"
 	"google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
 	"testing"
+	"time"
 )
 
 func TestGoogleAppsWithCache_Users(t *testing.T) {
@@ -43,7 +54,11 @@ func TestGoogleAppsWithCache_Users(t *testing.T) {
 		mock.Preload()
 		cache.Preload()
 
-		validate(expectedUsers, cache.Users())
+		if results, err := cache.Users(); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else {
+			validate(expectedUsers, results)
+		}
 	}
 }
 
@@ -84,7 +99,11 @@ func TestGoogleAppsMock_Groups(t *testing.T) {
 		mock.Preload()
 		cache.Preload()
 
-		validate(expectedGroups, cache.Groups())
+		if results, err := cache.Groups(); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else {
+			validate(expectedGroups, results)
+		}
 	}
 }
 
@@ -127,9 +146,21 @@ func TestGoogleAppsMock_CustomerUsers(t *testing.T) {
 		mock.Preload()
 		cache.Preload()
 
-		validate([]*admin.User{}, cache.CustomerUsers("empty"))
-		validate([]*admin.User{}, cache.CustomerUsers("no_existent"))
-		validate(expectedUsers, cache.CustomerUsers("mock_customer"))
+		if results, err := cache.CustomerUsers("empty"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else {
+			validate([]*admin.User{}, results)
+		}
+		if results, err := cache.CustomerUsers("no_existent"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else {
+			validate([]*admin.User{}, results)
+		}
+		if results, err := cache.CustomerUsers("mock_customer"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else {
+			validate(expectedUsers, results)
+		}
 	}
 }
 
@@ -173,8 +204,159 @@ func TestGoogleAppsWithCache_GroupMembers(t *testing.T) {
 		mock.Preload()
 		cache.Preload()
 
-		validate([]*admin.Member{}, cache.GroupMembers("no_existent"))
-		validate([]*admin.Member{}, cache.GroupMembers("empty_group"))
-		validate(expectedMembers, cache.GroupMembers("mock_group"))
+		if results, err := cache.GroupMembers("no_existent"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else {
+			validate([]*admin.Member{}, results)
+		}
+		if results, err := cache.GroupMembers("empty_group"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else {
+			validate([]*admin.Member{}, results)
+		}
+		if results, err := cache.GroupMembers("mock_group"); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else {
+			validate(expectedMembers, results)
+		}
+	}
+}
+
+func TestGoogleAppsWithCache_Error(t *testing.T) {
+	mock := GoogleAppsMock{
+		MockErrors: map[string]error{
+			"users": errors.New("backend error"),
+		},
+	}
+	cache := GoogleAppsWithCache{
+		Resolver: &mock,
+	}
+	if _, err := cache.Users(); err == nil {
+		t.Error("Error should be returned")
+	}
+
+	// Error should not be cached
+	delete(mock.MockErrors, "users")
+	mock.MockUsers = []*admin.User{{PrimaryEmail: "a@example.com"}}
+	if users, err := cache.Users(); err != nil || len(users) != 1 {
+		t.Errorf("Invalid result: users[%v] err[%v]", users, err)
+	}
+}
+
+func TestGoogleAppsImpl_LoadWithCacheNotModified(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-cache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	g := GoogleAppsImpl{
+		ExecutionContext: context.ExecutionContext{
+			Options: cli.Options{
+				BasePath: dir,
+				CacheTTL: time.Nanosecond,
+			},
+		},
+	}
+	load := func(loaded []*admin.User, loadErr error) ([]*admin.User, error) {
+		var users []*admin.User
+		err := g.loadWithCache("users", &users, func(etag string) (interface{}, string, error) {
+			if loadErr != nil {
+				return nil, "", loadErr
+			}
+			return loaded, "etag1", nil
+		})
+		return users, err
+	}
+
+	if users, err := load([]*admin.User{{PrimaryEmail: "a@example.com"}}, nil); err != nil || len(users) != 1 {
+		t.Fatalf("Invalid result: users[%v] err[%v]", users, err)
+	}
+	time.Sleep(time.Millisecond)
+
+	// Cached data should be kept on 304 Not Modified
+	users, err := load(nil, &googleapi.Error{Code: http.StatusNotModified})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(users) != 1 || users[0].PrimaryEmail != "a@example.com" {
+		t.Errorf("Cached users should be returned: %v", users)
+	}
+
+	if _, err := load(nil, &googleapi.Error{Code: 500}); err == nil {
+		t.Error("Error should be returned")
+	}
+}
+
+func TestIsGoogleErrorNotFound(t *testing.T) {
+	if !IsGoogleErrorNotFound(&googleapi.Error{Code: 404}) {
+		t.Error("404 should be not found")
+	}
+	if IsGoogleErrorNotFound(&googleapi.Error{Code: 500}) {
+		t.Error("500 should not be not found")
+	}
+	if IsGoogleErrorNotFound(errors.New("network error")) {
+		t.Error("Network error should not be not found")
+	}
+}
+
+func TestIsGoogleErrorInsufficientScope(t *testing.T) {
+	if !IsGoogleErrorInsufficientScope(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "insufficientPermissions"}}}) {
+		t.Error("insufficientPermissions should be insufficient scope")
+	}
+	if !IsGoogleErrorInsufficientScope(&googleapi.Error{Code: 403, Message: "Request had insufficient authentication scopes."}) {
+		t.Error("Message of insufficient scopes should be insufficient scope")
+	}
+	if IsGoogleErrorInsufficientScope(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}}) {
+		t.Error("Rate limit should not be insufficient scope")
+	}
+	if IsGoogleErrorInsufficientScope(errors.New("network error")) {
+		t.Error("Network error should not be insufficient scope")
+	}
+}
+
+func TestIsGoogleErrorTransient(t *testing.T) {
+	transient := []error{
+		&googleapi.Error{Code: 500},
+		&googleapi.Error{Code: 503},
+		&googleapi.Error{Code: 429},
+		&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}},
+		&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "quotaExceeded"}}},
+		&url.Error{Op: "Get", URL: "https://www.googleapis.com/", Err: &net.OpError{Op: "dial", Err: errors.New("connection refused")}},
+		&url.Error{Op: "Get", URL: "https://www.googleapis.com/", Err: &net.DNSError{Err: "no such host", Name: "www.googleapis.com"}},
+	}
+	for _, x := range transient {
+		if !IsGoogleErrorTransient(x) {
+			t.Errorf("Should be transient: %v", x)
+		}
+	}
+	permanent := []error{
+		&googleapi.Error{Code: 401},
+		&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "forbidden"}}},
+		&googleapi.Error{Code: 404},
+		&oauth2.RetrieveError{Body: []byte(`{"error":"invalid_grant"}`)},
+		&url.Error{Op: "Get", URL: "https://www.googleapis.com/", Err: &oauth2.RetrieveError{Body: []byte(`{"error":"invalid_grant"}`)}},
+		errors.New("unexpected error"),
+	}
+	for _, x := range permanent {
+		if IsGoogleErrorTransient(x) {
+			t.Errorf("Should not be transient: %v", x)
+		}
+	}
+}
+
+func TestClassifyGoogleRetry(t *testing.T) {
+	header := http.Header{}
+	header.Set("Retry-After", "30")
+	retryable, wait := classifyGoogleRetry(&googleapi.Error{Code: 429, Header: header})
+	if !retryable || wait != 30*time.Second {
+		t.Errorf("Retry-After should be respected: retryable[%t] wait[%s]", retryable, wait)
+	}
+	retryable, wait = classifyGoogleRetry(&googleapi.Error{Code: 403, Errors: []googleapi.ErrorItem{{Reason: "rateLimitExceeded"}}})
+	if !retryable || wait != 0 {
+		t.Errorf("Rate limit should be retryable: retryable[%t] wait[%s]", retryable, wait)
+	}
+	if retryable, _ := classifyGoogleRetry(&googleapi.Error{Code: 404}); retryable {
+		t.Error("Not found should not be retryable")
 	}
 }
@@ -0,0 +1,95 @@
+package directory
+
+import (
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli"
+	"github.com/watermint/dcfg/integration/context"
+	reports "google.golang.org/api/admin/reports/v1"
+	"strings"
+	"time"
+)
+
+const (
+	googleReportsAllUsers  = "all"
+	googleReportsChunkSize = 1000
+
+	googleReportsParamUserEmail  = "USER_EMAIL"
+	googleReportsParamGroupEmail = "GROUP_EMAIL"
+	googleReportsParamNewValue   = "NEW_VALUE"
+	googleReportsEventRenameUser = "RENAME_USER"
+)
+
+var (
+	// Applications of audit reports. Changes by the Admin console are in `admin`,
+	// and changes by group owners or managers (e.g. on Google Groups) are in `groups`.
+	googleReportsApplications = []string{"admin", "groups"}
+)
+
+// Changes of users and groups by audit reports of the Admin console and Google Groups.
+type GoogleReportsFeed struct {
+	ExecutionContext context.ExecutionContext
+}
+
+func (f *GoogleReportsFeed) Collect(since, until time.Time, changes *ChangeSet) error {
+	for _, x := range googleReportsApplications {
+		if err := f.collectApplication(x, since, until, changes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f *GoogleReportsFeed) collectApplication(application string, since, until time.Time, changes *ChangeSet) error {
+	client := f.ExecutionContext.GoogleReportsClient
+	seelog.Tracef("Loading Google activities: Application[%s] Since[%s] Until[%s]", application, since, until)
+
+	token := ""
+	for {
+		var r *reports.Activities
+		err := callGoogle(f.ExecutionContext, "Activities.List", func() (err error) {
+			call := client.Activities.List(googleReportsAllUsers, application).
+				StartTime(since.Format(time.RFC3339)).
+				EndTime(until.Format(time.RFC3339)).
+				MaxResults(googleReportsChunkSize)
+			if token != "" {
+				call = call.PageToken(token)
+			}
+			r, err = call.Do()
+			return
+		})
+		if err != nil {
+			seelog.Errorf("Unable to load Google activities: Application[%s] Err[%v]", application, err)
+			if IsGoogleErrorInsufficientScope(err) {
+				seelog.Warnf("Google token is not approved for audit reports. Please re-run `-auth %s` with `-incremental`", cli.MODE_AUTH_GOOGLE)
+			}
+			return err
+		}
+		seelog.Tracef("Google activities loaded (chunk): Application[%s] %d activities", application, len(r.Items))
+		for _, a := range r.Items {
+			collectGoogleActivity(a, changes)
+		}
+		token = r.NextPageToken
+		if token == "" {
+			return nil
+		}
+	}
+}
+
+// Parameter names are in upper case for `admin`, and in lower case for `groups`.
+func collectGoogleActivity(activity *reports.Activity, changes *ChangeSet) {
+	for _, e := range activity.Events {
+		for _, p := range e.Parameters {
+			switch strings.ToUpper(p.Name) {
+			case googleReportsParamUserEmail:
+				changes.AddUser(p.Value)
+			case googleReportsParamGroupEmail:
+				changes.AddGoogleGroup(p.Value)
+			case googleReportsParamNewValue:
+				if e.Name == googleReportsEventRenameUser {
+					changes.AddUser(p.Value)
+				}
+			}
+		}
+		seelog.Tracef("Google activity: Type[%s] Name[%s]", e.Type, e.Name)
+	}
+}
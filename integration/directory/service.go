@@ -4,10 +4,30 @@ type AccountDirectory interface {
 	Accounts() map[string]Account // email -> Account
 }
 
+const (
+	ACCOUNT_STATUS_ACTIVE    = "active"
+	ACCOUNT_STATUS_SUSPENDED = "suspended"
+	ACCOUNT_STATUS_INVITED   = "invited"
+	ACCOUNT_STATUS_REMOVED   = "removed"
+)
+
 type Account struct {
 	Email     string
 	GivenName string
 	Surname   string
+	Status    string // One of ACCOUNT_STATUS_*. Empty status is treated as active.
+
+	// Stable identifier of the user which does not change on email rename.
+	// Google user ID for Google, and external ID (= Google user ID) for Dropbox.
+	CorrelationId string
+}
+
+func (a Account) IsActive() bool {
+	return a.Status == "" || a.Status == ACCOUNT_STATUS_ACTIVE
+}
+
+func (a Account) IsSuspended() bool {
+	return a.Status == ACCOUNT_STATUS_SUSPENDED
 }
 
 type Group struct {
@@ -24,11 +44,31 @@ type GroupDirectory interface {
 
 type GroupResolver interface {
 	// Find by group key. groupKey matches both GroupId and GroupEmail.
-	Group(groupKey string) (Group, bool)
+	// Returns error if the group cannot be loaded.
+	Group(groupKey string) (Group, bool, error)
+}
+
+type GroupIdResolver interface {
+	// Find GroupId by group key without loading members of the group.
+	// Returns error if the group cannot be loaded.
+	GroupId(groupKey string) (string, bool, error)
+}
+
+const (
+	// Pseudo group which indicates the group has all users of the customer.
+	NESTED_GROUP_CUSTOMER = "customer:*"
+)
+
+type NestedGroupResolver interface {
+	// Emails of groups nested in the group, found on the last load of the group
+	// by GroupResolver. Includes NESTED_GROUP_CUSTOMER if the group has customer
+	// members. Returns false if the group is not loaded yet.
+	NestedGroups(groupEmail string) ([]string, bool)
 }
 
 type EmailResolver interface {
-	// Ensure email exist in the directory.
+	// Ensure email exist in the directory. Returns error if the existence cannot be
+	// determined, callers must not treat the email as non-existent in that case.
 	EmailExist(email string) (bool, error)
 }
 
@@ -56,20 +96,29 @@ func (gdm *GroupDirectoryMock) Groups() map[string]Group {
 	return groups
 }
 
-func (gdm *GroupDirectoryMock) Group(groupId string) (Group, bool) {
+func (gdm *GroupDirectoryMock) Group(groupId string) (Group, bool, error) {
 	for _, x := range gdm.MockData {
 		if x.GroupId == groupId || x.GroupEmail == groupId {
-			return x, true
+			return x, true, nil
 		}
 	}
-	return Group{}, false
+	return Group{}, false, nil
+}
+
+func (gdm *GroupDirectoryMock) GroupId(groupKey string) (string, bool, error) {
+	g, exist, err := gdm.Group(groupKey)
+	return g.GroupId, exist, err
 }
 
 type EmailResolverMock struct {
-	MockData []string
+	MockData   []string
+	MockErrors map[string]error
 }
 
 func (erm *EmailResolverMock) EmailExist(email string) (bool, error) {
+	if err, e := erm.MockErrors[email]; e {
+		return false, err
+	}
 	for _, x := range erm.MockData {
 		if x == email {
 			return true, nil
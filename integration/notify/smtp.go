@@ -0,0 +1,121 @@
+package notify
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"github.com/cihub/seelog"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DEFAULT_SMTP_TIMEOUT = 30 * time.Second
+)
+
+// SMTP server and addresses of notification mails.
+type SmtpMailer struct {
+	Host     string
+	Port     int
+	StartTLS bool
+
+	// Authenticates by PLAIN if Username is not empty
+	Username string
+	Password string
+
+	From string
+	To   []string
+
+	Timeout time.Duration
+
+	// TLS configuration for STARTTLS. ServerName is the Host if nil.
+	TLSConfig *tls.Config
+}
+
+// Build the message with headers. Body is plain text in UTF-8.
+func (m *SmtpMailer) message(subject, body string, date time.Time) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", m.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(m.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	for _, line := range strings.Split(body, "\n") {
+		// Lines starting with dot are escaped by the DATA writer
+		buf.WriteString(strings.TrimRight(line, "\r"))
+		buf.WriteString("\r\n")
+	}
+	return buf.Bytes()
+}
+
+// Send the mail to recipients.
+func (m *SmtpMailer) Send(subject, body string) error {
+	if m.Host == "" || m.From == "" || len(m.To) < 1 {
+		return errors.New("SMTP host, sender and recipients required")
+	}
+	timeout := m.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_SMTP_TIMEOUT
+	}
+	address := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	seelog.Tracef("SMTP: Connecting to [%s]", address)
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(timeout))
+
+	c, err := smtp.NewClient(conn, m.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if m.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errors.New("SMTP server does not support STARTTLS")
+		}
+		config := m.TLSConfig
+		if config == nil {
+			config = &tls.Config{ServerName: m.Host}
+		}
+		if err := c.StartTLS(config); err != nil {
+			return err
+		}
+	}
+	if m.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", m.Username, m.Password, m.Host)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(m.From); err != nil {
+		return err
+	}
+	for _, x := range m.To {
+		if err := c.Rcpt(x); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(m.message(subject, body, time.Now())); err != nil {
+		w.Close()
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	seelog.Tracef("SMTP: Mail sent: Subject[%s] To[%s]", subject, strings.Join(m.To, ", "))
+	return c.Quit()
+}
@@ -0,0 +1,158 @@
+package notify
+
+import (
+	"bufio"
+	"encoding/base64"
+	"net"
+	"net/textproto"
+	"strings"
+	"testing"
+	"time"
+)
+
+type smtpMessage struct {
+	Auth string
+	From string
+	To   []string
+	Data string
+}
+
+// Minimal SMTP server which accepts any mail, for testing.
+type smtpStandIn struct {
+	listener net.Listener
+	messages chan smtpMessage
+}
+
+func startSmtpStandIn(t *testing.T) *smtpStandIn {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{
+		listener: listener,
+		messages: make(chan smtpMessage, 10),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	tp := textproto.NewConn(conn)
+	msg := smtpMessage{}
+	tp.PrintfLine("220 localhost ESMTP stand-in")
+	for {
+		line, err := tp.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO", "HELO":
+			tp.PrintfLine("250-localhost")
+			tp.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			fields := strings.Fields(line)
+			if len(fields) == 3 {
+				if b, err := base64.StdEncoding.DecodeString(fields[2]); err == nil {
+					msg.Auth = string(b)
+				}
+			}
+			tp.PrintfLine("235 Authenticated")
+		case "MAIL":
+			msg.From = strings.Trim(strings.TrimPrefix(line[4:], " FROM:"), "<>")
+			tp.PrintfLine("250 OK")
+		case "RCPT":
+			msg.To = append(msg.To, strings.Trim(strings.TrimPrefix(line[4:], " TO:"), "<>"))
+			tp.PrintfLine("250 OK")
+		case "DATA":
+			tp.PrintfLine("354 Go ahead")
+			lines, err := tp.ReadDotLines()
+			if err != nil {
+				return
+			}
+			msg.Data = strings.Join(lines, "\n")
+			tp.PrintfLine("250 OK")
+			s.messages <- msg
+			msg = smtpMessage{}
+		case "QUIT":
+			tp.PrintfLine("221 Bye")
+			return
+		default:
+			tp.PrintfLine("502 Not implemented")
+		}
+	}
+}
+
+func (s *smtpStandIn) receive(t *testing.T) smtpMessage {
+	select {
+	case m := <-s.messages:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("Mail not received")
+	}
+	return smtpMessage{}
+}
+
+func TestSmtpMailer_Send(t *testing.T) {
+	s := startSmtpStandIn(t)
+	defer s.listener.Close()
+
+	m := SmtpMailer{
+		Host:     "127.0.0.1",
+		Port:     s.port(),
+		Username: "dcfg",
+		Password: "secret",
+		From:     "dcfg@example.com",
+		To:       []string{"admin@example.com", "helpdesk@example.com"},
+	}
+	if err := m.Send("Sync failed", "Failure: [1] Unable to add\n.dot line"); err != nil {
+		t.Fatal(err)
+	}
+	msg := s.receive(t)
+	if msg.From != "dcfg@example.com" || len(msg.To) != 2 || msg.To[1] != "helpdesk@example.com" {
+		t.Errorf("Unexpected envelope: %v", msg)
+	}
+	if msg.Auth != "\x00dcfg\x00secret" {
+		t.Errorf("Unexpected auth: %q", msg.Auth)
+	}
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(msg.Data + "\n")))
+	header, err := r.ReadMIMEHeader()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if header.Get("Subject") != "Sync failed" || header.Get("To") != "admin@example.com, helpdesk@example.com" {
+		t.Errorf("Unexpected header: %v", header)
+	}
+	if !strings.Contains(msg.Data, "Failure: [1] Unable to add\n.dot line") {
+		t.Errorf("Unexpected body: %s", msg.Data)
+	}
+}
+
+func TestSmtpMailer_StartTLSNotSupported(t *testing.T) {
+	s := startSmtpStandIn(t)
+	defer s.listener.Close()
+
+	m := SmtpMailer{
+		Host:     "127.0.0.1",
+		Port:     s.port(),
+		StartTLS: true,
+		From:     "dcfg@example.com",
+		To:       []string{"admin@example.com"},
+	}
+	if err := m.Send("Sync failed", "body"); err == nil {
+		t.Error("Should fail without STARTTLS")
+	}
+}
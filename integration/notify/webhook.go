@@ -0,0 +1,86 @@
+package notify
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cihub/seelog"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	DEFAULT_WEBHOOK_TIMEOUT = 30 * time.Second
+
+	SLACK_COLOR_GOOD   = "good"
+	SLACK_COLOR_DANGER = "danger"
+)
+
+// Payload of Slack incoming webhooks.
+type SlackMessage struct {
+	Text        string            `json:"text"`
+	Attachments []SlackAttachment `json:"attachments,omitempty"`
+}
+
+type SlackAttachment struct {
+	Color    string       `json:"color,omitempty"`
+	Title    string       `json:"title,omitempty"`
+	Text     string       `json:"text,omitempty"`
+	Fields   []SlackField `json:"fields,omitempty"`
+	Fallback string       `json:"fallback,omitempty"`
+}
+
+type SlackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+// Webhook which receives the payload in JSON.
+type Webhook struct {
+	Url     string
+	Timeout time.Duration
+}
+
+// Scheme and host of the URL for logs. Webhook URLs contain secrets in the
+// path (e.g. Slack incoming webhooks), and must not be logged.
+func RedactUrl(rawUrl string) string {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return "(invalid url)"
+	}
+	return u.Scheme + "://" + u.Host
+}
+
+// Post the payload in JSON. Returns error unless the response status is 2xx.
+// Errors do not contain the URL.
+func (w *Webhook) Post(payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	timeout := w.Timeout
+	if timeout <= 0 {
+		timeout = DEFAULT_WEBHOOK_TIMEOUT
+	}
+	client := &http.Client{Timeout: timeout}
+
+	seelog.Tracef("Webhook: Posting to [%s]", RedactUrl(w.Url))
+	resp, err := client.Post(w.Url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		if ue, ok := err.(*url.Error); ok {
+			return errors.New(fmt.Sprintf("Webhook request failed: %s %s: %v", ue.Op, RedactUrl(w.Url), ue.Err))
+		}
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return errors.New(fmt.Sprintf("Webhook responded status %d: %s", resp.StatusCode, respBody))
+	}
+	return nil
+}
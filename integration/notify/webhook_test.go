@@ -0,0 +1,79 @@
+package notify
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestWebhook_Post(t *testing.T) {
+	received := make(chan SlackMessage, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		m := SlackMessage{}
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		received <- m
+		w.Write([]byte("ok"))
+	}))
+	defer server.Close()
+
+	w := Webhook{Url: server.URL}
+	err := w.Post(SlackMessage{
+		Text: "Sync failed",
+		Attachments: []SlackAttachment{
+			{Color: SLACK_COLOR_DANGER, Text: "Failure: [1] Unable to add"},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := <-received
+	if m.Text != "Sync failed" || len(m.Attachments) != 1 || m.Attachments[0].Color != SLACK_COLOR_DANGER {
+		t.Errorf("Unexpected message: %v", m)
+	}
+}
+
+func TestWebhook_PostError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte("no_service"))
+	}))
+	defer server.Close()
+
+	w := Webhook{Url: server.URL}
+	if err := w.Post(SlackMessage{Text: "test"}); err == nil {
+		t.Error("Should fail on 404")
+	}
+}
+
+func TestWebhook_PostErrorRedacted(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	secretUrl := server.URL + "/services/T000/B000/SECRET"
+	server.Close()
+
+	w := Webhook{Url: secretUrl}
+	err := w.Post(SlackMessage{Text: "test"})
+	if err == nil {
+		t.Fatal("Should fail on closed server")
+	}
+	if strings.Contains(err.Error(), "SECRET") {
+		t.Errorf("Error should not contain the URL: %v", err)
+	}
+}
+
+func TestRedactUrl(t *testing.T) {
+	if u := RedactUrl("https://hooks.slack.com/services/T000/B000/SECRET"); u != "https://hooks.slack.com" {
+		t.Errorf("Unexpected URL: %s", u)
+	}
+	if u := RedactUrl("not a url"); u != "(invalid url)" {
+		t.Errorf("Unexpected URL: %s", u)
+	}
+}
@@ -0,0 +1,81 @@
+package retry
+
+import (
+	"github.com/cihub/seelog"
+	"math/rand"
+	"time"
+)
+
+// Retry policy of API calls. Wait is doubled for each retry (exponential backoff),
+// up to MaxWait. Then the wait is randomised by up to JitterPercent to avoid
+// retrying at the same time.
+type Policy struct {
+	MaxAttempts   int           // Total attempts including the first call
+	Wait          time.Duration // Wait before the first retry
+	MaxWait       time.Duration // Upper limit of the wait, unless the server requests longer
+	JitterPercent int
+}
+
+// Returns true if the call may succeed by retrying, and the wait requested by
+// the server (e.g. `retry_after` or `Retry-After` header). Zero if not requested.
+type Classifier func(err error) (retryable bool, retryAfter time.Duration)
+
+var (
+	// Replaceable for tests
+	sleep = time.Sleep
+)
+
+// Wait before n-th retry (starts from 1), without jitter.
+func (p Policy) Backoff(retry int) time.Duration {
+	wait := p.Wait
+	for i := 1; i < retry; i++ {
+		wait *= 2
+		if p.MaxWait > 0 && wait >= p.MaxWait {
+			break
+		}
+	}
+	if p.MaxWait > 0 && wait > p.MaxWait {
+		wait = p.MaxWait
+	}
+	return wait
+}
+
+func (p Policy) jitter(wait time.Duration) time.Duration {
+	if p.JitterPercent <= 0 || wait <= 0 {
+		return wait
+	}
+	return wait + time.Duration(rand.Int63n(int64(wait)*int64(p.JitterPercent)/100+1))
+}
+
+// Call f until f succeeds, f returns non retryable error, or attempts exceed MaxAttempts.
+// Returns the last error of f.
+func (p Policy) Do(operation string, classify Classifier, f func() error) error {
+	maxAttempts := p.MaxAttempts
+	if maxAttempts < 1 {
+		maxAttempts = 1
+	}
+	for attempt := 1; ; attempt++ {
+		err := f()
+		if err == nil {
+			if attempt > 1 {
+				seelog.Tracef("Retry succeeded: Operation[%s] Attempt[%d]", operation, attempt)
+			}
+			return nil
+		}
+		retryable, retryAfter := classify(err)
+		if !retryable {
+			return err
+		}
+		if attempt >= maxAttempts {
+			seelog.Tracef("Retry gave up: Operation[%s] Attempt[%d of %d] Err[%v]", operation, attempt, maxAttempts, err)
+			return err
+		}
+		wait := p.jitter(p.Backoff(attempt))
+		if retryAfter > 0 {
+			// Respect the server. No jitter, since the server has already scheduled the call.
+			wait = retryAfter
+		}
+		seelog.Tracef("Retry: Operation[%s] Attempt[%d of %d] Wait[%s] Err[%v]", operation, attempt, maxAttempts, wait, err)
+		sleep(wait)
+	}
+}
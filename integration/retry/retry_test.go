@@ -0,0 +1,135 @@
+package retry
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errRetryable = errors.New("retryable")
+	errPermanent = errors.New("permanent")
+)
+
+func classifyTest(err error) (bool, time.Duration) {
+	return err == errRetryable, 0
+}
+
+func recordSleep() *[]time.Duration {
+	waits := make([]time.Duration, 0)
+	sleep = func(d time.Duration) {
+		waits = append(waits, d)
+	}
+	return &waits
+}
+
+func TestPolicy_Backoff(t *testing.T) {
+	p := Policy{
+		Wait:    1 * time.Second,
+		MaxWait: 5 * time.Second,
+	}
+	expected := []time.Duration{1 * time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, x := range expected {
+		if w := p.Backoff(i + 1); w != x {
+			t.Errorf("Invalid backoff: retry[%d] expected[%s] actual[%s]", i+1, x, w)
+		}
+	}
+}
+
+func TestPolicy_DoSuccessAfterRetry(t *testing.T) {
+	waits := recordSleep()
+	defer func() { sleep = time.Sleep }()
+
+	p := Policy{
+		MaxAttempts: 5,
+		Wait:        1 * time.Second,
+		MaxWait:     10 * time.Second,
+	}
+	calls := 0
+	err := p.Do("test", classifyTest, func() error {
+		calls++
+		if calls < 3 {
+			return errRetryable
+		}
+		return nil
+	})
+	if err != nil || calls != 3 {
+		t.Errorf("Invalid result: err[%v] calls[%d]", err, calls)
+	}
+	if len(*waits) != 2 || (*waits)[0] != 1*time.Second || (*waits)[1] != 2*time.Second {
+		t.Errorf("Invalid waits: %v", *waits)
+	}
+}
+
+func TestPolicy_DoGiveUp(t *testing.T) {
+	waits := recordSleep()
+	defer func() { sleep = time.Sleep }()
+
+	p := Policy{
+		MaxAttempts: 3,
+		Wait:        1 * time.Second,
+	}
+	calls := 0
+	err := p.Do("test", classifyTest, func() error {
+		calls++
+		return errRetryable
+	})
+	if err != errRetryable || calls != 3 || len(*waits) != 2 {
+		t.Errorf("Invalid result: err[%v] calls[%d] waits[%v]", err, calls, *waits)
+	}
+}
+
+func TestPolicy_DoPermanentError(t *testing.T) {
+	waits := recordSleep()
+	defer func() { sleep = time.Sleep }()
+
+	p := Policy{
+		MaxAttempts: 5,
+		Wait:        1 * time.Second,
+	}
+	calls := 0
+	err := p.Do("test", classifyTest, func() error {
+		calls++
+		return errPermanent
+	})
+	if err != errPermanent || calls != 1 || len(*waits) != 0 {
+		t.Errorf("Invalid result: err[%v] calls[%d] waits[%v]", err, calls, *waits)
+	}
+}
+
+func TestPolicy_DoRetryAfter(t *testing.T) {
+	waits := recordSleep()
+	defer func() { sleep = time.Sleep }()
+
+	p := Policy{
+		MaxAttempts:   2,
+		Wait:          1 * time.Second,
+		MaxWait:       2 * time.Second,
+		JitterPercent: 50,
+	}
+	calls := 0
+	p.Do("test", func(err error) (bool, time.Duration) {
+		return true, 30 * time.Second
+	}, func() error {
+		calls++
+		if calls < 2 {
+			return errRetryable
+		}
+		return nil
+	})
+	if len(*waits) != 1 || (*waits)[0] != 30*time.Second {
+		t.Errorf("Retry-After should be respected over MaxWait: %v", *waits)
+	}
+}
+
+func TestPolicy_Jitter(t *testing.T) {
+	p := Policy{
+		JitterPercent: 20,
+	}
+	for i := 0; i < 100; i++ {
+		w := p.jitter(10 * time.Second)
+		if w < 10*time.Second || w > 12*time.Second {
+			t.Errorf("Jitter out of range: %s", w)
+		}
+	}
+}
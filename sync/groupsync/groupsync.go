@@ -1,6 +1,7 @@
 package groupsync
 
 import (
+	"fmt"
 	"github.com/cihub/seelog"
 	"github.com/watermint/dcfg/cli/explorer"
 	"github.com/watermint/dcfg/common/text"
@@ -14,11 +15,18 @@ type GroupSync struct {
 	DropboxAccountDirectory directory.AccountDirectory
 	DropboxGroupDirectory   directory.GroupDirectory
 	GoogleDirectory         directory.GroupResolver
+	GoogleGroupIds          directory.GroupIdResolver
 }
 
-func NewGroupSync(context context.ExecutionContext) GroupSync {
-	gd := directory.NewGoogleDirectory(context)
-	dd := directory.NewDropboxDirectory(context)
+func NewGroupSync(context context.ExecutionContext) (GroupSync, error) {
+	gd, err := directory.NewGoogleDirectory(context)
+	if err != nil {
+		return GroupSync{}, err
+	}
+	dd, err := directory.NewDropboxDirectory(context)
+	if err != nil {
+		return GroupSync{}, err
+	}
 	dp := connector.CreateConnector(context)
 
 	return GroupSync{
@@ -26,17 +34,28 @@ func NewGroupSync(context context.ExecutionContext) GroupSync {
 		DropboxAccountDirectory: dd,
 		DropboxGroupDirectory:   dd,
 		GoogleDirectory:         gd,
-	}
+		GoogleGroupIds:          gd,
+	}, nil
+}
+
+// Evidence of group operations for the audit log.
+func groupEvidence(googleGroup directory.Group) string {
+	return fmt.Sprintf("Google Group: Email[%s] GroupId[%s] GroupName[%s]", googleGroup.GroupEmail, googleGroup.GroupId, googleGroup.GroupName)
+}
+
+func groupMemberEvidence(googleGroup directory.Group, email string) string {
+	return fmt.Sprintf("Member of Google Group: Group[%s] Email[%s]", googleGroup.GroupEmail, email)
 }
 
 func (g *GroupSync) onDropboxGroupNotFound(googleGroup directory.Group) {
-	g.DropboxConnector.GroupsCreate(googleGroup.GroupName, googleGroup.GroupId)
+	g.DropboxConnector.GroupsCreate(googleGroup.GroupName, googleGroup.GroupId, groupEvidence(googleGroup))
 }
 
 func (g *GroupSync) filterGoogleGroupMemberByAccountExistence(googleGroup directory.Group) (member map[string]directory.Account) {
 	member = make(map[string]directory.Account)
+	dropboxAccounts := g.DropboxAccountDirectory.Accounts()
 	for _, x := range googleGroup.Members {
-		if _, exist := g.DropboxAccountDirectory.Accounts()[x.Email]; exist {
+		if _, exist := dropboxAccounts[x.Email]; exist {
 			member[x.Email] = x
 		}
 	}
@@ -53,29 +72,43 @@ func (g *GroupSync) membersNotInGroup(members map[string]directory.Account, grou
 }
 
 func (g *GroupSync) syncNewGroup(googleGroup directory.Group) {
-	newGroup := g.DropboxConnector.GroupsCreate(googleGroup.GroupName, googleGroup.GroupId)
-	if newGroup != "" {
-		for _, x := range g.filterGoogleGroupMemberByAccountExistence(googleGroup) {
-			g.DropboxConnector.GroupsMembersAdd(newGroup, x.Email)
-		}
+	// Conflict with existing Dropbox Group is detected on apply (see plan.ApplyUntil)
+	newGroup, err := g.DropboxConnector.GroupsCreate(googleGroup.GroupName, googleGroup.GroupId, groupEvidence(googleGroup))
+	if err != nil {
+		return
+	}
+	for _, x := range g.filterGoogleGroupMemberByAccountExistence(googleGroup) {
+		g.DropboxConnector.GroupsMembersAdd(newGroup, x.Email, groupMemberEvidence(googleGroup, x.Email))
 	}
 }
 
 func (g *GroupSync) updateExistingGroup(googleGroup directory.Group, dropboxGroup directory.Group) {
 	if googleGroup.GroupName != dropboxGroup.GroupName {
-		g.DropboxConnector.GroupsUpdate(dropboxGroup.GroupId, googleGroup.GroupName)
+		g.DropboxConnector.GroupsUpdate(dropboxGroup.GroupId, googleGroup.GroupName, groupEvidence(googleGroup))
 	}
 
 	googleMembers := g.filterGoogleGroupMemberByAccountExistence(googleGroup)
 
 	notInDropboxGroup := g.membersNotInGroup(googleMembers, dropboxGroup)
 	for _, x := range notInDropboxGroup {
-		g.DropboxConnector.GroupsMembersAdd(dropboxGroup.GroupId, x.Email)
+		g.DropboxConnector.GroupsMembersAdd(dropboxGroup.GroupId, x.Email, groupMemberEvidence(googleGroup, x.Email))
 	}
 
 	notInGoogleGroup := g.membersNotInGroup(dropboxGroup.Members, googleGroup)
 	for _, x := range notInGoogleGroup {
-		g.DropboxConnector.GroupsMembersRemove(dropboxGroup.GroupId, x.Email)
+		g.DropboxConnector.GroupsMembersRemove(dropboxGroup.GroupId, x.Email, fmt.Sprintf("Not a member of Google Group: Group[%s] Email[%s]", googleGroup.GroupEmail, x.Email))
+	}
+
+	if len(notInDropboxGroup) > 0 || len(notInGoogleGroup) > 0 {
+		before := make([]string, 0, len(dropboxGroup.Members))
+		for email := range dropboxGroup.Members {
+			before = append(before, email)
+		}
+		after := make([]string, 0, len(googleMembers))
+		for email := range googleMembers {
+			after = append(after, email)
+		}
+		explorer.ReportGroupMembership(dropboxGroup.GroupId, googleGroup.GroupName, before, after)
 	}
 }
 
@@ -88,13 +121,17 @@ func findByCorrelationId(gd directory.GroupDirectory, correlationId string) (dir
 	return directory.Group{}, false
 }
 
-func (g *GroupSync) Sync(targetGroup string) {
+func (g *GroupSync) Sync(targetGroup string) error {
 	seelog.Tracef("Group Sync from Google Group: Email[%s]", targetGroup)
-	googleGroup, exist := g.GoogleDirectory.Group(targetGroup)
+	googleGroup, exist, err := g.GoogleDirectory.Group(targetGroup)
+	if err != nil {
+		seelog.Errorf("Unable to load Google Group: Email[%s] Err[%v]", targetGroup, err)
+		return err
+	}
 	if !exist {
 		explorer.ReportFailure("Sync skipped for Google Group: %s (reason: Google Group not found)", targetGroup)
 		seelog.Warnf("Google Group not found for sync: Email[%s]", targetGroup)
-		return
+		return nil
 	}
 
 	dropboxGroup, exist := findByCorrelationId(g.DropboxGroupDirectory, googleGroup.GroupId)
@@ -103,16 +140,75 @@ func (g *GroupSync) Sync(targetGroup string) {
 	} else {
 		g.updateExistingGroup(googleGroup, dropboxGroup)
 	}
+	return nil
 }
 
-func (g *GroupSync) SyncFromList(context context.ExecutionContext) {
+// Delete Dropbox groups which managed by DCFG (i.e. group external id is set),
+// but corresponding Google group is not found in the white list.
+func (g *GroupSync) SyncDeprovisionFromWhiteList(whiteList []string) error {
+	if len(whiteList) < 1 {
+		seelog.Warnf("Google Group white list is empty. Skip group deprovisioning")
+		explorer.ReportFailure("Group deprovision skipped (reason: Google Group white list is empty)")
+		return nil
+	}
+	whiteListedGroups := make(map[string]bool)
+	for _, x := range whiteList {
+		// Members are not required to identify groups
+		groupId, exist, err := g.GoogleGroupIds.GroupId(x)
+		if err != nil {
+			// Deleting groups based on incomplete white list is not safe
+			seelog.Errorf("Unable to load Google Group: Email[%s] Err[%v]", x, err)
+			return err
+		}
+		if !exist {
+			seelog.Warnf("Google Group in the white list not found: Key[%s]", x)
+			continue
+		}
+		whiteListedGroups[groupId] = true
+	}
+	if len(whiteListedGroups) < 1 {
+		// Likely misconfiguration (e.g. wrong domain), rather than deletion of all groups
+		seelog.Warnf("No Google Group in the white list found. Skip group deprovisioning")
+		explorer.ReportFailure("Group deprovision skipped (reason: no Google Group in the white list found)")
+		return nil
+	}
+	for _, x := range g.DropboxGroupDirectory.Groups() {
+		if x.CorrelationId == "" {
+			seelog.Tracef("Skip Dropbox Group not managed by DCFG: GroupId[%s] GroupName[%s]", x.GroupId, x.GroupName)
+			continue
+		}
+		if whiteListedGroups[x.CorrelationId] {
+			continue
+		}
+		seelog.Tracef("Deleting Dropbox Group: GroupId[%s] GroupName[%s] ExternalId[%s]", x.GroupId, x.GroupName, x.CorrelationId)
+		g.DropboxConnector.GroupsDelete(x.GroupId, fmt.Sprintf("Google Group not in the white list: GroupId[%s]", x.CorrelationId))
+	}
+	return nil
+}
+
+func LoadWhiteList(context context.ExecutionContext) ([]string, error) {
 	path := context.Options.GroupWhiteList
 	whiteList, err := text.ReadLinesIgnoreWhitespace(path)
 	if err != nil {
-		seelog.Errorf("Unable to load Google Group white list: file[%s]", path)
-		explorer.FatalShutdown("Ensure file exist and readable: file[%s]", path)
+		seelog.Errorf("Unable to load Google Group white list: file[%s] Err[%v]", path, err)
+		return nil, err
 	}
+	return whiteList, nil
+}
+
+func (g *GroupSync) SyncFromList(context context.ExecutionContext) error {
+	whiteList, err := LoadWhiteList(context)
+	if err != nil {
+		return err
+	}
+	return g.SyncFromWhiteList(whiteList)
+}
+
+func (g *GroupSync) SyncFromWhiteList(whiteList []string) error {
 	for _, x := range whiteList {
-		g.Sync(x)
+		if err := g.Sync(x); err != nil {
+			return err
+		}
 	}
+	return nil
 }
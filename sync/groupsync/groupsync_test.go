@@ -1,8 +1,11 @@
 package groupsync
 
 import (
+	"github.com/watermint/dcfg/cli/explorer"
 	"github.com/watermint/dcfg/integration/connector"
 	"github.com/watermint/dcfg/integration/directory"
+	"google.golang.org/api/admin/directory/v1"
+	"google.golang.org/api/googleapi"
 	"testing"
 )
 
@@ -115,6 +118,8 @@ func TestGroupSync2(t *testing.T) {
 		GoogleDirectory:         &googleGroups,
 	}
 
+	explorer.ResetReport(true)
+	defer explorer.ResetReport(false)
 	groupSync.Sync("g1@example.com")
 	unexpected, missing, success := provision.AssertLogs([]string{
 		provision.CreateOperationLog("GroupsMembersRemove", "g1", "b@example.com"),
@@ -122,6 +127,10 @@ func TestGroupSync2(t *testing.T) {
 	if !success {
 		t.Error("Sync failed", unexpected, missing, success)
 	}
+	groups := explorer.ReportGroups()
+	if len(groups) != 1 || groups[0].GroupId != "g1" || len(groups[0].Before) != 2 || len(groups[0].After) != 1 || groups[0].After[0] != "a@example.com" {
+		t.Errorf("Unexpected membership: %v", groups)
+	}
 }
 
 func TestGroupSync3(t *testing.T) {
@@ -458,3 +467,204 @@ func TestGroupSync8(t *testing.T) {
 		t.Error("Sync failed", unexpected, missing, success)
 	}
 }
+
+func TestGroupSync_SyncDeprovisionFromWhiteList(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	googleGroups := directory.GroupDirectoryMock{
+		MockData: []directory.Group{
+			directory.Group{
+				GroupId:    "g1@example.com",
+				GroupEmail: "g1@example.com",
+				GroupName:  "G1",
+			},
+			directory.Group{
+				GroupId:    "g2@example.com",
+				GroupEmail: "g2@example.com",
+				GroupName:  "G2",
+			},
+		},
+	}
+	dropboxGroups := directory.GroupDirectoryMock{
+		MockData: []directory.Group{
+			directory.Group{
+				GroupId:       "g1",
+				GroupName:     "G1",
+				CorrelationId: "g1@example.com",
+			},
+			directory.Group{
+				GroupId:       "g2",
+				GroupName:     "G2",
+				CorrelationId: "g2@example.com",
+			},
+			directory.Group{
+				GroupId:       "g3",
+				GroupName:     "G3",
+				CorrelationId: "g3@example.com",
+			},
+			directory.Group{
+				GroupId:   "g4",
+				GroupName: "Unmanaged",
+			},
+		},
+	}
+	groupSync := GroupSync{
+		DropboxConnector:        &provision,
+		DropboxAccountDirectory: &directory.AccountDirectoryMock{},
+		DropboxGroupDirectory:   &dropboxGroups,
+		GoogleGroupIds:          &googleGroups,
+	}
+
+	groupSync.SyncDeprovisionFromWhiteList([]string{"g1@example.com", "g3@example.com"})
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("GroupsDelete", "g2"),
+		provision.CreateOperationLog("GroupsDelete", "g3"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+
+	// Empty white list should not delete any group
+	provision.ClearOperationHistory()
+	groupSync.SyncDeprovisionFromWhiteList([]string{})
+	unexpected, missing, success = provision.AssertLogs([]string{})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+
+	// White list without any existing group should not delete any group
+	provision.ClearOperationHistory()
+	if err := groupSync.SyncDeprovisionFromWhiteList([]string{"g3@example.com", "g5@example.com"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	unexpected, missing, success = provision.AssertLogs([]string{})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
+
+func TestGroupSync_CreateConflict(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	provision.MockErrors = map[string]error{
+		provision.CreateOperationLog("GroupsCreate", "G1", "g1@example.com"): connector.NewDropboxError(connector.ERROR_KIND_CONFLICT, "GroupsCreate", "group_name_already_used"),
+	}
+	googleGroups := directory.GroupDirectoryMock{
+		MockData: []directory.Group{
+			directory.Group{
+				GroupId:   "g1@example.com",
+				GroupName: "G1",
+				Members: map[string]directory.Account{
+					"c@example.com": directory.Account{
+						Email: "c@example.com",
+					},
+				},
+			},
+		},
+	}
+	dropboxGroups := directory.GroupDirectoryMock{
+		MockData: []directory.Group{},
+	}
+	dropboxAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			directory.Account{
+				Email: "a@example.com",
+			},
+			directory.Account{
+				Email: "b@example.com",
+			},
+			directory.Account{
+				Email: "c@example.com",
+			},
+		},
+	}
+
+	groupSync := GroupSync{
+		DropboxConnector:        &provision,
+		DropboxAccountDirectory: &dropboxAccounts,
+		DropboxGroupDirectory:   &dropboxGroups,
+		GoogleDirectory:         &googleGroups,
+	}
+
+	groupSync.Sync("g1@example.com")
+
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("GroupsCreate", "G1", "g1@example.com"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
+
+func TestGroupSync_DeprovisionGoogleError(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	ga := directory.GoogleAppsMock{
+		MockGroups: []*admin.Group{
+			&admin.Group{
+				Id:    "id-g1",
+				Name:  "G1",
+				Email: "g1@example.com",
+			},
+			&admin.Group{
+				Id:    "id-g2",
+				Name:  "G2",
+				Email: "g2@example.com",
+			},
+		},
+		MockErrors: map[string]error{
+			"g1@example.com": &googleapi.Error{Code: 500},
+			"g3@example.com": &googleapi.Error{Code: 404},
+		},
+	}
+	googleDirectory, err := directory.NewGoogleDirectoryForTest(&ga)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	dropboxGroups := directory.GroupDirectoryMock{
+		MockData: []directory.Group{
+			directory.Group{
+				GroupId:       "g1",
+				GroupName:     "G1",
+				CorrelationId: "g1@example.com",
+			},
+			directory.Group{
+				GroupId:       "g2",
+				GroupName:     "G2",
+				CorrelationId: "g2@example.com",
+			},
+			directory.Group{
+				GroupId:       "g3",
+				GroupName:     "G3",
+				CorrelationId: "g3@example.com",
+			},
+		},
+	}
+
+	groupSync := GroupSync{
+		DropboxConnector:        &provision,
+		DropboxAccountDirectory: &directory.AccountDirectoryMock{},
+		DropboxGroupDirectory:   &dropboxGroups,
+		GoogleGroupIds:          googleDirectory,
+	}
+
+	if err := groupSync.SyncDeprovisionFromWhiteList([]string{"g1@example.com", "g2@example.com"}); err == nil {
+		t.Error("Error should be returned")
+	}
+
+	// No group should be deleted with incomplete white list
+	unexpected, missing, success := provision.AssertLogs([]string{})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+
+	// Group deleted on Google Apps (not found) should be deprovisioned
+	provision.ClearOperationHistory()
+	if err := groupSync.SyncDeprovisionFromWhiteList([]string{"g2@example.com", "g3@example.com"}); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	unexpected, missing, success = provision.AssertLogs([]string{
+		provision.CreateOperationLog("GroupsDelete", "g1"),
+		provision.CreateOperationLog("GroupsDelete", "g3"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
@@ -0,0 +1,100 @@
+package incremental
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/watermint/dcfg/common/file"
+	"github.com/watermint/dcfg/integration/directory"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Checkpoint of the incremental sync, which persisted between runs.
+type Checkpoint struct {
+	// Start time of the last successful sync
+	LastSync     time.Time `json:"last_sync"`
+	LastFullSync time.Time `json:"last_full_sync"`
+
+	// Configuration of the last sync. Full sync is required if changed.
+	Modes         []string `json:"modes"`
+	WhiteListHash string   `json:"white_list_hash"`
+
+	// Google group email -> emails of nested groups
+	NestedGroups map[string][]string `json:"nested_groups"`
+
+	// Users and groups of failed operations, which will be synced again on the next run
+	Pending *directory.ChangeSet `json:"pending"`
+}
+
+func NewCheckpoint() *Checkpoint {
+	return &Checkpoint{
+		NestedGroups: make(map[string][]string),
+		Pending:      directory.NewChangeSet(),
+	}
+}
+
+// Load checkpoint from the file. Returns empty checkpoint if the file not found.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	c := NewCheckpoint()
+	if !file.FileExist(path) {
+		return c, nil
+	}
+	if _, err := file.LoadJSON(path, c); err != nil {
+		return nil, err
+	}
+	if c.NestedGroups == nil {
+		c.NestedGroups = make(map[string][]string)
+	}
+	if c.Pending == nil {
+		c.Pending = directory.NewChangeSet()
+	}
+	return c, nil
+}
+
+func (c *Checkpoint) Save(path string) error {
+	return file.SaveJSON(path, c)
+}
+
+// Returns the reason if the full sync is required, or empty string if the
+// incremental sync is available.
+func (c *Checkpoint) FullSyncReason(now time.Time, interval time.Duration, modes []string, whiteListHash string) string {
+	switch {
+	case c.LastSync.IsZero():
+		return "no checkpoint"
+	case now.Sub(c.LastFullSync) >= interval:
+		return fmt.Sprintf("last full sync at %s", c.LastFullSync.Format(time.RFC3339))
+	case strings.Join(c.Modes, ",") != strings.Join(modes, ","):
+		return "sync modes changed"
+	case c.WhiteListHash != whiteListHash:
+		return "group white list changed"
+	default:
+		return ""
+	}
+}
+
+// Update the checkpoint after successful sync started at `startedAt`.
+func (c *Checkpoint) Update(startedAt time.Time, full bool, modes []string, whiteListHash string, scope *Scope, failed *directory.ChangeSet) {
+	c.LastSync = startedAt
+	if full {
+		c.LastFullSync = startedAt
+		c.NestedGroups = make(map[string][]string)
+	}
+	for g, nested := range scope.NestedGroups {
+		c.NestedGroups[g] = nested
+	}
+	c.Modes = modes
+	c.WhiteListHash = whiteListHash
+	c.Pending = failed
+}
+
+func WhiteListHash(whiteList []string) string {
+	sorted := make([]string, 0, len(whiteList))
+	for _, x := range whiteList {
+		sorted = append(sorted, strings.ToLower(x))
+	}
+	sort.Strings(sorted)
+	h := sha256.Sum256([]byte(strings.Join(sorted, "\n")))
+	return hex.EncodeToString(h[:])
+}
@@ -0,0 +1,181 @@
+package incremental
+
+import (
+	"fmt"
+	"github.com/watermint/dcfg/integration/directory"
+	"github.com/watermint/dcfg/sync/plan"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestCheckpoint_FullSyncReason(t *testing.T) {
+	now := time.Now()
+	modes := []string{"user-provision", "group-provision"}
+	hash := WhiteListHash([]string{"g1@example.com"})
+
+	c := NewCheckpoint()
+	if c.FullSyncReason(now, 24*time.Hour, modes, hash) == "" {
+		t.Error("Full sync should be required without checkpoint")
+	}
+	c.Update(now.Add(-1*time.Hour), true, modes, hash, NewFullScope(), directory.NewChangeSet())
+	if r := c.FullSyncReason(now, 24*time.Hour, modes, hash); r != "" {
+		t.Errorf("Incremental sync should be available: %s", r)
+	}
+	if c.FullSyncReason(now, 1*time.Hour, modes, hash) == "" {
+		t.Error("Full sync should be required after the interval")
+	}
+	if c.FullSyncReason(now, 24*time.Hour, []string{"user-provision"}, hash) == "" {
+		t.Error("Full sync should be required if modes changed")
+	}
+	if c.FullSyncReason(now, 24*time.Hour, modes, WhiteListHash([]string{"g2@example.com"})) == "" {
+		t.Error("Full sync should be required if white list changed")
+	}
+	if WhiteListHash([]string{"a@example.com", "B@example.com"}) != WhiteListHash([]string{"b@example.com", "a@example.com"}) {
+		t.Error("Hash should not depend on order and case")
+	}
+}
+
+func TestCheckpoint_SaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-checkpoint")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	checkpointPath := path.Join(dir, "checkpoint.json")
+	if c, err := LoadCheckpoint(checkpointPath); err != nil || !c.LastSync.IsZero() {
+		t.Errorf("Unexpected checkpoint: %v %v", c, err)
+	}
+
+	scope := NewFullScope()
+	scope.NestedGroups["g1@example.com"] = []string{"g2@example.com"}
+	failed := directory.NewChangeSet()
+	failed.AddUser("a@example.com")
+
+	c := NewCheckpoint()
+	c.Update(time.Now(), true, []string{"group-provision"}, "hash", scope, failed)
+	if err := c.Save(checkpointPath); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadCheckpoint(checkpointPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.NestedGroups["g1@example.com"]) != 1 || !loaded.Pending.HasUser("a@example.com") || loaded.LastFullSync.IsZero() {
+		t.Errorf("Unexpected checkpoint: %v", loaded)
+	}
+}
+
+func newTestScope() *Scope {
+	checkpoint := NewCheckpoint()
+	checkpoint.NestedGroups = map[string][]string{
+		"g1@example.com": {},
+		"g2@example.com": {"g2-child@example.com"},
+		"g3@example.com": {directory.NESTED_GROUP_CUSTOMER},
+		"g4@example.com": {},
+	}
+	changes := directory.NewChangeSet()
+	changes.AddUser("A@example.com")
+	changes.AddGoogleGroup("g2-child@example.com")
+	changes.AddDropboxGroup("dbx-g4")
+	return NewScope(changes, checkpoint)
+}
+
+func TestScope_WhiteList(t *testing.T) {
+	scope := newTestScope()
+	dropboxGroups := &directory.GroupDirectoryMock{
+		MockData: []directory.Group{
+			{GroupId: "dbx-g1", CorrelationId: "g1@example.com"},
+			{GroupId: "dbx-g4", CorrelationId: "g4@example.com"},
+		},
+	}
+	whiteList := []string{"g1@example.com", "g2@example.com", "g3@example.com", "g4@example.com", "g5@example.com"}
+	filtered := scope.WhiteList(whiteList, dropboxGroups)
+	expected := []string{"g2@example.com", "g3@example.com", "g4@example.com", "g5@example.com"}
+	if fmt.Sprint(filtered) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected white list: %v", filtered)
+	}
+
+	groups := scope.GroupDirectory(dropboxGroups).Groups()
+	if _, e := groups["dbx-g4"]; !e || len(groups) != 1 {
+		t.Errorf("Unexpected groups: %v", groups)
+	}
+
+	full := NewFullScope()
+	if len(full.WhiteList(whiteList, dropboxGroups)) != len(whiteList) || len(full.GroupDirectory(dropboxGroups).Groups()) != 2 {
+		t.Error("Full scope should not filter groups")
+	}
+}
+
+func TestScope_AccountDirectory(t *testing.T) {
+	scope := newTestScope()
+	accounts := &directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com"},
+			{Email: "b@example.com"},
+		},
+	}
+	filtered := scope.AccountDirectory(accounts).Accounts()
+	if _, e := filtered["a@example.com"]; !e || len(filtered) != 1 {
+		t.Errorf("Unexpected accounts: %v", filtered)
+	}
+	if scope.IsEmpty() || !NewScope(directory.NewChangeSet(), NewCheckpoint()).IsEmpty() || NewFullScope().IsEmpty() {
+		t.Error("Unexpected state")
+	}
+}
+
+type nestedGroupResolverMock struct {
+	directory.GroupDirectoryMock
+	nested map[string][]string
+}
+
+func (r *nestedGroupResolverMock) NestedGroups(groupEmail string) ([]string, bool) {
+	n, e := r.nested[groupEmail]
+	return n, e
+}
+
+func TestScope_GroupResolver(t *testing.T) {
+	scope := NewFullScope()
+	resolver := &nestedGroupResolverMock{
+		GroupDirectoryMock: directory.GroupDirectoryMock{
+			MockData: []directory.Group{
+				{GroupId: "g1@example.com", GroupEmail: "g1@example.com"},
+			},
+		},
+		nested: map[string][]string{
+			"g1@example.com": {"g2@example.com"},
+		},
+	}
+	if _, e, _ := scope.GroupResolver(resolver).Group("g1@example.com"); !e {
+		t.Error("Group not found")
+	}
+	if fmt.Sprint(scope.NestedGroups["g1@example.com"]) != "[g2@example.com]" {
+		t.Errorf("Nested groups should be tracked: %v", scope.NestedGroups)
+	}
+}
+
+func TestChangesOfOperations(t *testing.T) {
+	p := plan.NewPlan([]string{}, []string{})
+	recorder := plan.NewRecorder(p)
+	newGroup, _ := recorder.GroupsCreate("G1", "g1@example.com", "")
+	recorder.GroupsMembersAdd(newGroup, "a@example.com", "")
+	recorder.GroupsMembersRemove("dbx-g2", "b@example.com", "")
+	recorder.MembersSetEmail("c@example.com", "c2@example.com", "")
+
+	changes := ChangesOfOperations(p.Operations)
+	users := make([]string, 0)
+	for x := range changes.Users {
+		users = append(users, x)
+	}
+	sort.Strings(users)
+	if fmt.Sprint(users) != "[a@example.com b@example.com c2@example.com c@example.com]" {
+		t.Errorf("Unexpected users: %v", users)
+	}
+	if !changes.HasGoogleGroup("g1@example.com") || !changes.DropboxGroupIds["dbx-g2"] || len(changes.DropboxGroupIds) != 1 {
+		t.Errorf("Unexpected groups: %v", changes)
+	}
+}
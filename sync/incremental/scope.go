@@ -0,0 +1,174 @@
+package incremental
+
+import (
+	"github.com/watermint/dcfg/integration/directory"
+	"github.com/watermint/dcfg/sync/plan"
+	"strings"
+)
+
+// Scope of the sync. Scope without changes (i.e. full sync) does not filter
+// directories, but tracks nested groups for later incremental sync.
+type Scope struct {
+	// Nil for the full sync
+	Changes *directory.ChangeSet
+
+	// Google group email -> emails of nested groups, loaded in this sync
+	NestedGroups map[string][]string
+
+	// Nested groups of the last sync
+	lastNestedGroups map[string][]string
+}
+
+func NewFullScope() *Scope {
+	return &Scope{
+		NestedGroups:     make(map[string][]string),
+		lastNestedGroups: make(map[string][]string),
+	}
+}
+
+func NewScope(changes *directory.ChangeSet, checkpoint *Checkpoint) *Scope {
+	return &Scope{
+		Changes:          changes,
+		NestedGroups:     make(map[string][]string),
+		lastNestedGroups: checkpoint.NestedGroups,
+	}
+}
+
+func (s *Scope) IsFull() bool {
+	return s.Changes == nil
+}
+
+func (s *Scope) IsEmpty() bool {
+	return !s.IsFull() && s.Changes.IsEmpty()
+}
+
+// True if the Google group or one of nested groups is changed. Groups never
+// loaded are treated as changed.
+func (s *Scope) isGoogleGroupChanged(groupEmail string) bool {
+	if s.Changes.HasGoogleGroup(groupEmail) {
+		return true
+	}
+	nested, known := s.lastNestedGroups[strings.ToLower(groupEmail)]
+	if !known {
+		return true
+	}
+	for _, x := range nested {
+		if x == directory.NESTED_GROUP_CUSTOMER && len(s.Changes.Users) > 0 {
+			return true
+		}
+		if s.Changes.HasGoogleGroup(x) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Scope) isDropboxGroupChanged(group directory.Group) bool {
+	if s.Changes.DropboxGroupIds[group.GroupId] {
+		return true
+	}
+	return group.CorrelationId != "" && s.isGoogleGroupChanged(group.CorrelationId)
+}
+
+// Filter white list to groups changed on Google or Dropbox.
+func (s *Scope) WhiteList(whiteList []string, dropboxGroups directory.GroupDirectory) []string {
+	if s.IsFull() {
+		return whiteList
+	}
+	changedOnDropbox := make(map[string]bool)
+	for id, g := range dropboxGroups.Groups() {
+		if s.Changes.DropboxGroupIds[id] && g.CorrelationId != "" {
+			changedOnDropbox[strings.ToLower(g.CorrelationId)] = true
+		}
+	}
+	filtered := make([]string, 0)
+	for _, x := range whiteList {
+		if changedOnDropbox[strings.ToLower(x)] || s.isGoogleGroupChanged(x) {
+			filtered = append(filtered, x)
+		}
+	}
+	return filtered
+}
+
+func (s *Scope) AccountDirectory(ad directory.AccountDirectory) directory.AccountDirectory {
+	if s.IsFull() {
+		return ad
+	}
+	return &scopedAccountDirectory{scope: s, accounts: ad}
+}
+
+func (s *Scope) GroupDirectory(gd directory.GroupDirectory) directory.GroupDirectory {
+	if s.IsFull() {
+		return gd
+	}
+	return &scopedGroupDirectory{scope: s, groups: gd}
+}
+
+// Track nested groups of groups loaded by the resolver.
+func (s *Scope) GroupResolver(gr directory.GroupResolver) directory.GroupResolver {
+	return &trackingGroupResolver{scope: s, resolver: gr}
+}
+
+type scopedAccountDirectory struct {
+	scope    *Scope
+	accounts directory.AccountDirectory
+}
+
+func (d *scopedAccountDirectory) Accounts() map[string]directory.Account {
+	accounts := make(map[string]directory.Account)
+	for email, x := range d.accounts.Accounts() {
+		if d.scope.Changes.HasUser(email) {
+			accounts[email] = x
+		}
+	}
+	return accounts
+}
+
+type scopedGroupDirectory struct {
+	scope  *Scope
+	groups directory.GroupDirectory
+}
+
+func (d *scopedGroupDirectory) Groups() map[string]directory.Group {
+	groups := make(map[string]directory.Group)
+	for id, x := range d.groups.Groups() {
+		if d.scope.isDropboxGroupChanged(x) {
+			groups[id] = x
+		}
+	}
+	return groups
+}
+
+type trackingGroupResolver struct {
+	scope    *Scope
+	resolver directory.GroupResolver
+}
+
+func (r *trackingGroupResolver) Group(groupKey string) (directory.Group, bool, error) {
+	group, exist, err := r.resolver.Group(groupKey)
+	if err != nil || !exist {
+		return group, exist, err
+	}
+	if nr, ok := r.resolver.(directory.NestedGroupResolver); ok {
+		if nested, e := nr.NestedGroups(group.GroupEmail); e {
+			r.scope.NestedGroups[strings.ToLower(group.GroupEmail)] = nested
+		}
+	}
+	return group, exist, err
+}
+
+// Users and groups of operations, to sync them again on the next run.
+func ChangesOfOperations(ops []plan.Operation) *directory.ChangeSet {
+	changes := directory.NewChangeSet()
+	for _, x := range ops {
+		changes.AddUser(x.Email)
+		changes.AddUser(x.NewEmail)
+		changes.AddGoogleGroup(x.GroupExternalId)
+		if plan.IsPlaceholderGroupId(x.GroupId) {
+			changes.AddGoogleGroup(plan.PlaceholderGroupExternalId(x.GroupId))
+		} else {
+			changes.AddDropboxGroup(x.GroupId)
+		}
+	}
+	return changes
+}
@@ -0,0 +1,60 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/watermint/dcfg/common/util"
+)
+
+// Upper bound of the number of operations of the types in one run.
+// Zero means no limit for both MaxCount and MaxPercent.
+type Limit struct {
+	Name           string
+	OperationTypes []string
+	MaxCount       int
+	MaxPercent     int // Percentage of the Dropbox team members
+}
+
+type LimitViolation struct {
+	Limit    Limit
+	Count    int
+	TeamSize int
+}
+
+func (v LimitViolation) String() string {
+	return fmt.Sprintf("%s: %d operation(s) planned, limit: %d operation(s) / %d%% of %d team member(s)",
+		v.Limit.Name, v.Count, v.Limit.MaxCount, v.Limit.MaxPercent, v.TeamSize)
+}
+
+func (p *Plan) CountOperations(operationTypes ...string) (count int) {
+	for _, x := range p.Operations {
+		if util.ContainsString(operationTypes, x.Type) {
+			count++
+		}
+	}
+	return
+}
+
+func (l Limit) exceeded(count, teamSize int) bool {
+	if l.MaxCount > 0 && count > l.MaxCount {
+		return true
+	}
+	if l.MaxPercent > 0 && count*100 > l.MaxPercent*teamSize {
+		return true
+	}
+	return false
+}
+
+// Verify the plan against limits. Returns all exceeded limits.
+func (p *Plan) CheckLimits(limits []Limit, teamSize int) (violations []LimitViolation) {
+	for _, l := range limits {
+		count := p.CountOperations(l.OperationTypes...)
+		if l.exceeded(count, teamSize) {
+			violations = append(violations, LimitViolation{
+				Limit:    l,
+				Count:    count,
+				TeamSize: teamSize,
+			})
+		}
+	}
+	return
+}
@@ -0,0 +1,43 @@
+package plan
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPlan_CheckLimits(t *testing.T) {
+	p := NewPlan([]string{}, []string{})
+	recorder := NewRecorder(p)
+	for i := 0; i < 10; i++ {
+		recorder.MembersRemove(fmt.Sprintf("r%d@example.com", i), false, "", "", "")
+	}
+	recorder.MembersAdd("a@example.com", "gn-a", "sn-a", "", "")
+	recorder.GroupsDelete("g1", "")
+	recorder.GroupsDelete("g2", "")
+
+	if v := p.CheckLimits([]Limit{{Name: "user-remove", OperationTypes: []string{OPERATION_MEMBERS_REMOVE}}}, 100); len(v) > 0 {
+		t.Errorf("Zero should mean no limit: %v", v)
+	}
+	if v := p.CheckLimits([]Limit{{Name: "user-remove", OperationTypes: []string{OPERATION_MEMBERS_REMOVE}, MaxCount: 10}}, 100); len(v) > 0 {
+		t.Errorf("Should be within the limit: %v", v)
+	}
+	if v := p.CheckLimits([]Limit{{Name: "user-remove", OperationTypes: []string{OPERATION_MEMBERS_REMOVE}, MaxCount: 9}}, 100); len(v) != 1 || v[0].Count != 10 {
+		t.Errorf("Should exceed the limit: %v", v)
+	}
+	if v := p.CheckLimits([]Limit{{Name: "user-remove", OperationTypes: []string{OPERATION_MEMBERS_REMOVE}, MaxPercent: 10}}, 100); len(v) > 0 {
+		t.Errorf("Should be within the limit: %v", v)
+	}
+	if v := p.CheckLimits([]Limit{{Name: "user-remove", OperationTypes: []string{OPERATION_MEMBERS_REMOVE}, MaxPercent: 10}}, 99); len(v) != 1 {
+		t.Errorf("Should exceed the limit: %v", v)
+	}
+
+	limits := []Limit{
+		{Name: "user-remove", OperationTypes: []string{OPERATION_MEMBERS_REMOVE}, MaxCount: 5},
+		{Name: "user-add", OperationTypes: []string{OPERATION_MEMBERS_ADD}, MaxCount: 5},
+		{Name: "group-member-remove", OperationTypes: []string{OPERATION_GROUPS_MEMBERS_REMOVE}, MaxCount: 5},
+		{Name: "group-delete", OperationTypes: []string{OPERATION_GROUPS_DELETE}, MaxCount: 1},
+	}
+	if v := p.CheckLimits(limits, 100); len(v) != 2 || v[0].Limit.Name != "user-remove" || v[1].Limit.Name != "group-delete" || v[1].Count != 2 {
+		t.Errorf("Unexpected violations: %v", v)
+	}
+}
@@ -0,0 +1,131 @@
+package plan
+
+import (
+	"github.com/watermint/dcfg/integration/directory"
+)
+
+// Dropbox directory as it will be after the planned operations are applied.
+// Sync modes planned later in the same run refer this overlay, so that the
+// plan reflects accounts invited or removed by earlier modes.
+type DirectoryOverlay struct {
+	Plan         *Plan
+	BaseAccounts directory.AccountDirectory
+	BaseGroups   directory.GroupDirectory
+}
+
+func NewDirectoryOverlay(p *Plan, accounts directory.AccountDirectory, groups directory.GroupDirectory) *DirectoryOverlay {
+	return &DirectoryOverlay{
+		Plan:         p,
+		BaseAccounts: accounts,
+		BaseGroups:   groups,
+	}
+}
+
+func (d *DirectoryOverlay) removedEmails() map[string]bool {
+	removed := make(map[string]bool)
+	for _, x := range d.Plan.Operations {
+		if x.Type == OPERATION_MEMBERS_REMOVE {
+			removed[x.Email] = true
+		}
+	}
+	return removed
+}
+
+// Old email -> new email
+func (d *DirectoryOverlay) renamedEmails() map[string]string {
+	renamed := make(map[string]string)
+	for _, x := range d.Plan.Operations {
+		if x.Type == OPERATION_MEMBERS_SET_EMAIL {
+			renamed[x.Email] = x.NewEmail
+		}
+	}
+	return renamed
+}
+
+// Implements directory.AccountDirectory
+type accountOverlay struct {
+	overlay *DirectoryOverlay
+}
+
+func (a *accountOverlay) Accounts() map[string]directory.Account {
+	accounts := make(map[string]directory.Account)
+	for email, x := range a.overlay.BaseAccounts.Accounts() {
+		accounts[email] = x
+	}
+	for _, x := range a.overlay.Plan.Operations {
+		switch x.Type {
+		case OPERATION_MEMBERS_ADD:
+			accounts[x.Email] = directory.Account{
+				Email:     x.Email,
+				GivenName: x.GivenName,
+				Surname:   x.Surname,
+				Status:    directory.ACCOUNT_STATUS_INVITED,
+
+				CorrelationId: x.ExternalId,
+			}
+		case OPERATION_MEMBERS_REMOVE:
+			delete(accounts, x.Email)
+		case OPERATION_MEMBERS_SET_EMAIL:
+			if a, e := accounts[x.Email]; e {
+				delete(accounts, x.Email)
+				a.Email = x.NewEmail
+				accounts[x.NewEmail] = a
+			}
+		case OPERATION_MEMBERS_SET_EXT_ID:
+			if a, e := accounts[x.Email]; e {
+				a.CorrelationId = x.ExternalId
+				accounts[x.Email] = a
+			}
+		case OPERATION_MEMBERS_SET_PROFILE:
+			if a, e := accounts[x.Email]; e {
+				a.GivenName = x.GivenName
+				a.Surname = x.Surname
+				accounts[x.Email] = a
+			}
+		case OPERATION_MEMBERS_SUSPEND, OPERATION_MEMBERS_UNSUSPEND:
+			if a, e := accounts[x.Email]; e {
+				a.Status = directory.ACCOUNT_STATUS_SUSPENDED
+				if x.Type == OPERATION_MEMBERS_UNSUSPEND {
+					a.Status = directory.ACCOUNT_STATUS_ACTIVE
+				}
+				accounts[x.Email] = a
+			}
+		}
+	}
+	return accounts
+}
+
+// Implements directory.GroupDirectory
+type groupOverlay struct {
+	overlay *DirectoryOverlay
+}
+
+func (g *groupOverlay) Groups() map[string]directory.Group {
+	removed := g.overlay.removedEmails()
+	renamed := g.overlay.renamedEmails()
+	groups := make(map[string]directory.Group)
+	for groupId, x := range g.overlay.BaseGroups.Groups() {
+		members := make(map[string]directory.Account)
+		for email, m := range x.Members {
+			if removed[email] {
+				continue
+			}
+			if newEmail, e := renamed[email]; e {
+				m.Email = newEmail
+				email = newEmail
+			}
+			members[email] = m
+		}
+		x.Members = members
+		groups[groupId] = x
+	}
+	return groups
+}
+
+func (d *DirectoryOverlay) AccountDirectory() directory.AccountDirectory {
+	return &accountOverlay{overlay: d}
+}
+
+func (d *DirectoryOverlay) GroupDirectory() directory.GroupDirectory {
+	return &groupOverlay{overlay: d}
+}
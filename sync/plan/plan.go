@@ -0,0 +1,382 @@
+package plan
+
+import (
+	"errors"
+	"fmt"
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli/explorer"
+	"github.com/watermint/dcfg/common/file"
+	"github.com/watermint/dcfg/integration/connector"
+	"strings"
+	"time"
+)
+
+const (
+	OPERATION_GROUPS_CREATE         = "GroupsCreate"
+	OPERATION_GROUPS_UPDATE         = "GroupsUpdate"
+	OPERATION_GROUPS_DELETE         = "GroupsDelete"
+	OPERATION_GROUPS_MEMBERS_ADD    = "GroupsMembersAdd"
+	OPERATION_GROUPS_MEMBERS_REMOVE = "GroupsMembersRemove"
+	OPERATION_MEMBERS_ADD           = "MembersAdd"
+	OPERATION_MEMBERS_REMOVE        = "MembersRemove"
+	OPERATION_MEMBERS_SUSPEND       = "MembersSuspend"
+	OPERATION_MEMBERS_UNSUSPEND     = "MembersUnsuspend"
+	OPERATION_MEMBERS_SET_PROFILE   = "MembersSetProfile"
+	OPERATION_MEMBERS_SET_EMAIL     = "MembersSetEmail"
+	OPERATION_MEMBERS_SET_EXT_ID    = "MembersSetExternalId"
+
+	PLAN_FORMAT_VERSION = 1
+
+	// Error class of report records for operations not executed.
+	REPORT_ERROR_CLASS_SKIPPED     = "skipped"
+	REPORT_ERROR_CLASS_INTERRUPTED = "interrupted"
+
+	// Prefix of group id for groups which will be created on apply.
+	placeholderGroupIdPrefix = "plan:"
+)
+
+var (
+	ErrInterrupted = errors.New("Apply interrupted")
+)
+
+// Single Dropbox operation. Only fields relevant to the operation type are filled.
+type Operation struct {
+	Type            string `json:"type"`
+	Mode            string `json:"mode,omitempty"`
+	Email           string `json:"email,omitempty"`
+	GivenName       string `json:"given_name,omitempty"`
+	Surname         string `json:"surname,omitempty"`
+	GroupId         string `json:"group_id,omitempty"`
+	GroupName       string `json:"group_name,omitempty"`
+	GroupExternalId string `json:"group_external_id,omitempty"`
+	ExternalId      string `json:"external_id,omitempty"`
+	NewEmail        string `json:"new_email,omitempty"`
+
+	// Options for MembersRemove
+	WipeData           bool   `json:"wipe_data,omitempty"`
+	TransferDestEmail  string `json:"transfer_dest_email,omitempty"`
+	TransferAdminEmail string `json:"transfer_admin_email,omitempty"`
+
+	// Google directory state which requires the operation. Written to the audit log.
+	Evidence string `json:"evidence,omitempty"`
+}
+
+func (o Operation) String() string {
+	switch o.Type {
+	case OPERATION_GROUPS_CREATE:
+		return fmt.Sprintf("%s: GroupName[%s] ExternalId[%s]", o.Type, o.GroupName, o.GroupExternalId)
+	case OPERATION_GROUPS_UPDATE:
+		return fmt.Sprintf("%s: GroupId[%s] NewGroupName[%s]", o.Type, o.GroupId, o.GroupName)
+	case OPERATION_GROUPS_DELETE:
+		return fmt.Sprintf("%s: GroupId[%s]", o.Type, o.GroupId)
+	case OPERATION_GROUPS_MEMBERS_ADD, OPERATION_GROUPS_MEMBERS_REMOVE:
+		return fmt.Sprintf("%s: GroupId[%s] Email[%s]", o.Type, o.GroupId, o.Email)
+	case OPERATION_MEMBERS_SET_EMAIL:
+		return fmt.Sprintf("%s: Email[%s] NewEmail[%s]", o.Type, o.Email, o.NewEmail)
+	case OPERATION_MEMBERS_SET_EXT_ID:
+		return fmt.Sprintf("%s: Email[%s] ExternalId[%s]", o.Type, o.Email, o.ExternalId)
+	case OPERATION_MEMBERS_ADD, OPERATION_MEMBERS_SET_PROFILE:
+		return fmt.Sprintf("%s: Email[%s] GivenName[%s] Surname[%s]", o.Type, o.Email, o.GivenName, o.Surname)
+	case OPERATION_MEMBERS_REMOVE:
+		return fmt.Sprintf("%s: Email[%s] WipeData[%t] TransferTo[%s]", o.Type, o.Email, o.WipeData, o.TransferDestEmail)
+	default:
+		return fmt.Sprintf("%s: Email[%s]", o.Type, o.Email)
+	}
+}
+
+// Target of the operation for reports.
+func (o Operation) Target() explorer.Target {
+	return explorer.Target{
+		Operation: o.Type,
+		Email:     o.Email,
+		GroupId:   o.GroupId,
+		GroupName: o.GroupName,
+	}
+}
+
+// Persisted sync plan. Operations are executed in order by Apply.
+type Plan struct {
+	Version        int         `json:"version"`
+	CreatedAt      time.Time   `json:"created_at"`
+	Modes          []string    `json:"modes"`
+	GroupWhiteList []string    `json:"group_white_list,omitempty"`
+	TeamSize       int         `json:"dropbox_team_size"`
+	Operations     []Operation `json:"operations"`
+
+	// Operations failed or skipped on the last Apply
+	failed []Operation
+}
+
+func NewPlan(modes []string, groupWhiteList []string) *Plan {
+	return &Plan{
+		Version:        PLAN_FORMAT_VERSION,
+		CreatedAt:      time.Now().UTC(),
+		Modes:          modes,
+		GroupWhiteList: groupWhiteList,
+		Operations:     []Operation{},
+	}
+}
+
+func (p *Plan) enqueue(op Operation) {
+	p.Operations = append(p.Operations, op)
+}
+
+func (p *Plan) IsEmpty() bool {
+	return len(p.Operations) == 0
+}
+
+func PlaceholderGroupId(groupExternalId string) string {
+	return placeholderGroupIdPrefix + groupExternalId
+}
+
+func IsPlaceholderGroupId(groupId string) bool {
+	return strings.HasPrefix(groupId, placeholderGroupIdPrefix)
+}
+
+// Returns the group external id of the placeholder group id.
+func PlaceholderGroupExternalId(groupId string) string {
+	return strings.TrimPrefix(groupId, placeholderGroupIdPrefix)
+}
+
+// Operations failed or skipped on the last Apply.
+func (p *Plan) Failed() []Operation {
+	return p.failed
+}
+
+func Load(path string) (*Plan, error) {
+	p := &Plan{}
+	if _, err := file.LoadJSON(path, p); err != nil {
+		return nil, err
+	}
+	if p.Version != PLAN_FORMAT_VERSION {
+		return nil, errors.New(fmt.Sprintf("Unsupported plan format version: %d", p.Version))
+	}
+	return p, nil
+}
+
+func (p *Plan) Save(path string) error {
+	return file.SaveJSON(path, p)
+}
+
+// Operation without sync mode and evidence, to compare operations.
+func diffKey(op Operation) Operation {
+	op.Mode = ""
+	op.Evidence = ""
+	return op
+}
+
+// Compare operations regardless of order, sync mode and evidence. Returns
+// operations only in `p` (missing) and operations only in `other` (unexpected).
+func (p *Plan) Diff(other *Plan) (missing []Operation, unexpected []Operation) {
+	remain := make(map[Operation]int)
+	for _, x := range other.Operations {
+		remain[diffKey(x)]++
+	}
+	for _, x := range p.Operations {
+		if remain[diffKey(x)] > 0 {
+			remain[diffKey(x)]--
+		} else {
+			missing = append(missing, x)
+		}
+	}
+	for _, x := range other.Operations {
+		if remain[diffKey(x)] > 0 {
+			remain[diffKey(x)]--
+			unexpected = append(unexpected, x)
+		}
+	}
+	return
+}
+
+// Replace evidence of operations with evidence of the same operations in `other`.
+// Evidence in the plan file is editable, thus evidence for the audit log must be
+// taken from the plan created against live directories. Evidence of operations
+// not in `other` is cleared.
+func (p *Plan) CopyEvidence(other *Plan) {
+	evidence := make(map[Operation][]string)
+	for _, x := range other.Operations {
+		evidence[diffKey(x)] = append(evidence[diffKey(x)], x.Evidence)
+	}
+	for i, x := range p.Operations {
+		e := evidence[diffKey(x)]
+		if len(e) == 0 {
+			p.Operations[i].Evidence = ""
+			continue
+		}
+		p.Operations[i].Evidence = e[0]
+		evidence[diffKey(x)] = e[1:]
+	}
+}
+
+// Number of consecutive operations from i, which can be executed in a batch.
+// Members to be added, and members to be added to or removed from the same group
+// are batched.
+func (p *Plan) batchLength(i int) int {
+	op := p.Operations[i]
+	switch op.Type {
+	case OPERATION_MEMBERS_ADD, OPERATION_GROUPS_MEMBERS_ADD, OPERATION_GROUPS_MEMBERS_REMOVE:
+	default:
+		return 1
+	}
+	n := 1
+	for ; i+n < len(p.Operations); n++ {
+		next := p.Operations[i+n]
+		if next.Type != op.Type || next.GroupId != op.GroupId {
+			break
+		}
+	}
+	return n
+}
+
+// Execute operations through the connector. Placeholder group ids are replaced
+// by ids of groups created during this apply. Consecutive operations are executed
+// in batches if the connector supports (see batchLength). Failed operations are
+// reported and skipped, but apply is aborted on auth error.
+func (p *Plan) Apply(dc connector.DropboxConnector) error {
+	return p.ApplyUntil(dc, nil)
+}
+
+// Apply the plan same as Apply, but stops before the next operation once `stop`
+// is closed. Returns ErrInterrupted if stopped. Operations not executed are
+// recorded as failed.
+func (p *Plan) ApplyUntil(dc connector.DropboxConnector, stop <-chan struct{}) error {
+	createdGroups := make(map[string]string)
+	p.failed = make([]Operation, 0)
+	defer explorer.SetReportMode("")
+
+	resolveGroupId := func(ops []Operation) (string, bool) {
+		op := ops[0]
+		if !IsPlaceholderGroupId(op.GroupId) {
+			return op.GroupId, true
+		}
+		groupId, exist := createdGroups[op.GroupId]
+		if !exist || groupId == "" {
+			for _, x := range ops {
+				seelog.Warnf("Skip operation due to group creation failure: %s", x)
+				explorer.ReportOperationFailure(x.Target(), REPORT_ERROR_CLASS_SKIPPED, "Operation skipped (reason: group not created): %s", x)
+			}
+			p.failed = append(p.failed, ops...)
+			return "", false
+		}
+		return groupId, true
+	}
+	evidence := func(ops []Operation) []string {
+		e := make([]string, 0, len(ops))
+		for _, x := range ops {
+			e = append(e, x.Evidence)
+		}
+		return e
+	}
+	emails := func(ops []Operation) []string {
+		e := make([]string, 0, len(ops))
+		for _, x := range ops {
+			e = append(e, x.Email)
+		}
+		return e
+	}
+
+	for i := 0; i < len(p.Operations); {
+		select {
+		case <-stop:
+			remaining := len(p.Operations) - i
+			seelog.Warnf("Apply interrupted: %d operation(s) skipped", remaining)
+			explorer.ReportOperationFailure(explorer.Target{}, REPORT_ERROR_CLASS_INTERRUPTED, "Apply interrupted: %d operation(s) skipped", remaining)
+			p.failed = append(p.failed, p.Operations[i:]...)
+			return ErrInterrupted
+		default:
+		}
+
+		ops := p.Operations[i : i+p.batchLength(i)]
+		op := ops[0]
+		explorer.SetReportMode(op.Mode)
+		for _, x := range ops {
+			seelog.Tracef("Apply: %s", x)
+		}
+
+		errs := make([]error, len(ops))
+		switch op.Type {
+		case OPERATION_GROUPS_CREATE:
+			var groupId string
+			groupId, errs[0] = dc.GroupsCreate(op.GroupName, op.GroupExternalId, op.Evidence)
+			if connector.IsConflict(errs[0]) {
+				seelog.Warnf("Dropbox Group with same name or external id already exists: GroupName[%s] ExternalId[%s]", op.GroupName, op.GroupExternalId)
+				explorer.ReportFailure("Sync skipped for Google Group: %s (reason: Dropbox Group which is not managed by DCFG has the same name)", op.GroupExternalId)
+			}
+			createdGroups[PlaceholderGroupId(op.GroupExternalId)] = groupId
+		case OPERATION_GROUPS_UPDATE:
+			if groupId, ok := resolveGroupId(ops); ok {
+				errs[0] = dc.GroupsUpdate(groupId, op.GroupName, op.Evidence)
+			}
+		case OPERATION_GROUPS_DELETE:
+			if groupId, ok := resolveGroupId(ops); ok {
+				errs[0] = dc.GroupsDelete(groupId, op.Evidence)
+			}
+		case OPERATION_GROUPS_MEMBERS_ADD:
+			if groupId, ok := resolveGroupId(ops); ok {
+				errs = dc.GroupsMembersAddBatch(groupId, emails(ops), evidence(ops))
+			}
+		case OPERATION_GROUPS_MEMBERS_REMOVE:
+			if groupId, ok := resolveGroupId(ops); ok {
+				errs = dc.GroupsMembersRemoveBatch(groupId, emails(ops), evidence(ops))
+			}
+		case OPERATION_MEMBERS_ADD:
+			members := make([]connector.NewMember, 0, len(ops))
+			for _, x := range ops {
+				members = append(members, connector.NewMember{
+					Email:      x.Email,
+					GivenName:  x.GivenName,
+					Surname:    x.Surname,
+					ExternalId: x.ExternalId,
+					Evidence:   x.Evidence,
+				})
+			}
+			errs = dc.MembersAddBatch(members)
+		case OPERATION_MEMBERS_REMOVE:
+			errs[0] = dc.MembersRemove(op.Email, op.WipeData, op.TransferDestEmail, op.TransferAdminEmail, op.Evidence)
+		case OPERATION_MEMBERS_SUSPEND:
+			errs[0] = dc.MembersSuspend(op.Email, op.Evidence)
+		case OPERATION_MEMBERS_UNSUSPEND:
+			errs[0] = dc.MembersUnsuspend(op.Email, op.Evidence)
+		case OPERATION_MEMBERS_SET_PROFILE:
+			errs[0] = dc.MembersSetProfile(op.Email, op.GivenName, op.Surname, op.Evidence)
+		case OPERATION_MEMBERS_SET_EMAIL:
+			errs[0] = dc.MembersSetEmail(op.Email, op.NewEmail, op.Evidence)
+		case OPERATION_MEMBERS_SET_EXT_ID:
+			errs[0] = dc.MembersSetExternalId(op.Email, op.ExternalId, op.Evidence)
+		default:
+			for _, x := range ops {
+				seelog.Warnf("Unknown operation: %s", x)
+				explorer.ReportOperationFailure(x.Target(), REPORT_ERROR_CLASS_SKIPPED, "Unknown operation skipped: %s", x)
+			}
+			p.failed = append(p.failed, ops...)
+		}
+		var abort error
+		for j, err := range errs {
+			if err == nil {
+				continue
+			}
+			seelog.Tracef("Apply failed: %s Kind[%s] Err[%v]", ops[j], connector.ErrorKind(err), err)
+			p.failed = append(p.failed, ops[j])
+			if abort == nil && connector.IsAbort(err) {
+				abort = err
+			}
+		}
+
+		// Remaining operations will fail with the same reason, or must not be
+		// executed without the audit log.
+		if abort != nil {
+			remaining := len(p.Operations) - i - len(ops)
+			if connector.IsAudit(abort) {
+				seelog.Errorf("Apply aborted due to audit log failure: Err[%v]", abort)
+				explorer.ReportOperationFailure(explorer.Target{}, connector.ERROR_KIND_AUDIT, "Apply aborted due to audit log failure: %d operation(s) skipped", remaining)
+			} else {
+				seelog.Errorf("Apply aborted due to Dropbox auth error: Err[%v]", abort)
+				explorer.ReportOperationFailure(explorer.Target{}, connector.ERROR_KIND_AUTH, "Apply aborted due to Dropbox auth error: %d operation(s) skipped", remaining)
+			}
+			p.failed = append(p.failed, p.Operations[i+len(ops):]...)
+			return abort
+		}
+		i += len(ops)
+	}
+	return nil
+}
@@ -0,0 +1,394 @@
+package plan
+
+import (
+	"fmt"
+	"github.com/watermint/dcfg/integration/connector"
+	"github.com/watermint/dcfg/integration/directory"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestPlan_Apply(t *testing.T) {
+	p := NewPlan([]string{"group-provision"}, []string{"g1@example.com"})
+	recorder := NewRecorder(p)
+
+	newGroup, _ := recorder.GroupsCreate("G1", "g1@example.com", "")
+	if !IsPlaceholderGroupId(newGroup) {
+		t.Errorf("Unexpected group id: %s", newGroup)
+	}
+	recorder.GroupsMembersAdd(newGroup, "a@example.com", "")
+	recorder.GroupsMembersRemove("g2", "b@example.com", "")
+	recorder.MembersAdd("c@example.com", "gn-c", "sn-c", "", "")
+	recorder.MembersRemove("d@example.com", false, "", "", "")
+
+	if len(p.Operations) != 5 {
+		t.Errorf("Unexpected operations: %v", p.Operations)
+	}
+
+	mock := connector.DropboxConnectorMock{}
+	p.Apply(&mock)
+	unexpected, missing, success := mock.AssertLogs([]string{
+		mock.CreateOperationLog("GroupsCreate", "G1", "g1@example.com"),
+		mock.CreateOperationLog("GroupsMembersAdd", "mock-g1@example.com", "a@example.com"),
+		mock.CreateOperationLog("GroupsMembersRemove", "g2", "b@example.com"),
+		mock.CreateOperationLog("MembersAdd", "c@example.com", "gn-c", "sn-c"),
+		mock.CreateOperationLog("MembersRemove", "d@example.com"),
+	})
+	if !success {
+		t.Error("Apply failed", unexpected, missing, success)
+	}
+}
+
+func TestPlan_Diff(t *testing.T) {
+	p1 := NewPlan([]string{}, []string{})
+	r1 := NewRecorder(p1)
+	r1.MembersAdd("a@example.com", "gn-a", "sn-a", "", "")
+	r1.MembersRemove("b@example.com", false, "", "", "")
+
+	p2 := NewPlan([]string{}, []string{})
+	r2 := NewRecorder(p2)
+	r2.Mode = "user-deprovision"
+	r2.MembersRemove("b@example.com", false, "", "", "")
+	r2.MembersAdd("a@example.com", "gn-a", "sn-a", "", "")
+
+	if m, u := p1.Diff(p2); len(m) > 0 || len(u) > 0 {
+		t.Errorf("Unexpected drift: missing[%v] unexpected[%v]", m, u)
+	}
+	if p2.Operations[0].Mode != "user-deprovision" {
+		t.Errorf("Mode should be recorded: %v", p2.Operations[0])
+	}
+
+	r2.MembersRemove("c@example.com", false, "", "", "")
+	m, u := p1.Diff(p2)
+	if len(m) != 0 || len(u) != 1 || u[0].Email != "c@example.com" {
+		t.Errorf("Unexpected drift: missing[%v] unexpected[%v]", m, u)
+	}
+	m, u = p2.Diff(p1)
+	if len(m) != 1 || len(u) != 0 || m[0].Email != "c@example.com" {
+		t.Errorf("Unexpected drift: missing[%v] unexpected[%v]", m, u)
+	}
+}
+
+func TestPlan_CopyEvidence(t *testing.T) {
+	// Plan file with forged evidence
+	p1 := NewPlan([]string{}, []string{})
+	r1 := NewRecorder(p1)
+	r1.MembersRemove("a@example.com", false, "", "", "forged-a")
+	r1.MembersRemove("b@example.com", false, "", "", "forged-b")
+	r1.MembersSuspend("c@example.com", "forged-c")
+
+	p2 := NewPlan([]string{}, []string{})
+	r2 := NewRecorder(p2)
+	r2.MembersRemove("b@example.com", false, "", "", "e-b")
+	r2.MembersRemove("a@example.com", false, "", "", "e-a")
+
+	p1.CopyEvidence(p2)
+	expected := []string{"e-a", "e-b", ""}
+	for i, x := range expected {
+		if p1.Operations[i].Evidence != x {
+			t.Errorf("Unexpected evidence: %v", p1.Operations[i])
+		}
+	}
+}
+
+func TestPlan_SaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-plan")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	p := NewPlan([]string{"user-provision"}, []string{})
+	NewRecorder(p).MembersAdd("a@example.com", "gn-a", "sn-a", "", "")
+
+	planFile := path.Join(dir, "plan.json")
+	if err := p.Save(planFile); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(planFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m, u := p.Diff(loaded); len(m) > 0 || len(u) > 0 {
+		t.Errorf("Unexpected drift: missing[%v] unexpected[%v]", m, u)
+	}
+	if len(loaded.Modes) != 1 || loaded.Modes[0] != "user-provision" {
+		t.Errorf("Unexpected modes: %v", loaded.Modes)
+	}
+}
+
+func TestDirectoryOverlay(t *testing.T) {
+	p := NewPlan([]string{}, []string{})
+	recorder := NewRecorder(p)
+	recorder.MembersAdd("c@example.com", "gn-c", "sn-c", "", "")
+	recorder.MembersRemove("b@example.com", false, "", "", "")
+
+	accounts := &directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com"},
+			{Email: "b@example.com"},
+		},
+	}
+	groups := &directory.GroupDirectoryMock{
+		MockData: []directory.Group{
+			{
+				GroupId: "g1",
+				Members: map[string]directory.Account{
+					"a@example.com": {Email: "a@example.com"},
+					"b@example.com": {Email: "b@example.com"},
+				},
+			},
+		},
+	}
+	overlay := NewDirectoryOverlay(p, accounts, groups)
+
+	a := overlay.AccountDirectory().Accounts()
+	if _, e := a["a@example.com"]; !e || len(a) != 2 {
+		t.Errorf("Unexpected accounts: %v", a)
+	}
+	if _, e := a["c@example.com"]; !e {
+		t.Errorf("Planned account not found: %v", a)
+	}
+	g := overlay.GroupDirectory().Groups()
+	if _, e := g["g1"].Members["b@example.com"]; e || len(g["g1"].Members) != 1 {
+		t.Errorf("Unexpected group members: %v", g)
+	}
+}
+
+func TestPlan_ApplyAbortOnAuthError(t *testing.T) {
+	p := NewPlan([]string{"user-provision"}, []string{})
+	recorder := NewRecorder(p)
+	recorder.MembersAdd("a@example.com", "gn-a", "sn-a", "", "")
+	recorder.MembersAdd("b@example.com", "gn-b", "sn-b", "", "")
+	recorder.MembersAdd("c@example.com", "gn-c", "sn-c", "", "")
+
+	mock := connector.DropboxConnectorMock{}
+	mock.MockErrors = map[string]error{
+		mock.CreateOperationLog("MembersAdd", "a@example.com", "gn-a", "sn-a"): connector.NewDropboxError(connector.ERROR_KIND_CONFLICT, "MembersAdd", "user_already_on_team"),
+		mock.CreateOperationLog("MembersAdd", "b@example.com", "gn-b", "sn-b"): connector.NewDropboxError(connector.ERROR_KIND_AUTH, "MembersAdd", "invalid_access_token"),
+	}
+	if err := p.Apply(&mock); !connector.IsAuth(err) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if failed := p.Failed(); len(failed) != 3 || failed[0].Email != "a@example.com" || failed[2].Email != "c@example.com" {
+		t.Errorf("Unexpected failed operations: %v", failed)
+	}
+	unexpected, missing, success := mock.AssertLogs([]string{
+		mock.CreateOperationLog("MembersAdd", "a@example.com", "gn-a", "sn-a"),
+		mock.CreateOperationLog("MembersAdd", "b@example.com", "gn-b", "sn-b"),
+	})
+	if !success {
+		t.Error("Apply should be aborted", unexpected, missing, success)
+	}
+}
+
+func TestPlan_ApplyAbortOnAuditError(t *testing.T) {
+	p := NewPlan([]string{"user-suspend"}, []string{})
+	recorder := NewRecorder(p)
+	recorder.MembersSuspend("a@example.com", "")
+	recorder.MembersSuspend("b@example.com", "")
+	recorder.MembersSuspend("c@example.com", "")
+
+	mock := connector.DropboxConnectorMock{}
+	mock.MockErrors = map[string]error{
+		mock.CreateOperationLog("MembersSuspend", "b@example.com"): connector.NewDropboxError(connector.ERROR_KIND_AUDIT, "MembersSuspend", "audit_log_write_failed"),
+	}
+	if err := p.Apply(&mock); !connector.IsAudit(err) {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if failed := p.Failed(); len(failed) != 2 || failed[0].Email != "b@example.com" || failed[1].Email != "c@example.com" {
+		t.Errorf("Unexpected failed operations: %v", failed)
+	}
+	unexpected, missing, success := mock.AssertLogs([]string{
+		mock.CreateOperationLog("MembersSuspend", "a@example.com"),
+		mock.CreateOperationLog("MembersSuspend", "b@example.com"),
+	})
+	if !success {
+		t.Error("Apply should be aborted", unexpected, missing, success)
+	}
+}
+
+// Closes `stop` on the first suspend, to emulate SIGTERM in the middle of apply.
+type interruptingConnector struct {
+	connector.DropboxConnectorMock
+	stop chan struct{}
+}
+
+func (c *interruptingConnector) MembersSuspend(email, evidence string) error {
+	close(c.stop)
+	return c.DropboxConnectorMock.MembersSuspend(email, evidence)
+}
+
+func TestPlan_ApplyUntil(t *testing.T) {
+	p := NewPlan([]string{"user-suspend"}, []string{})
+	recorder := NewRecorder(p)
+	recorder.MembersSuspend("a@example.com", "")
+	recorder.MembersSuspend("b@example.com", "")
+	recorder.MembersSuspend("c@example.com", "")
+
+	mock := &interruptingConnector{stop: make(chan struct{})}
+	if err := p.ApplyUntil(mock, mock.stop); err != ErrInterrupted {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if failed := p.Failed(); len(failed) != 2 || failed[0].Email != "b@example.com" {
+		t.Errorf("Unexpected failed operations: %v", failed)
+	}
+	unexpected, missing, success := mock.AssertLogs([]string{
+		mock.CreateOperationLog("MembersSuspend", "a@example.com"),
+	})
+	if !success {
+		t.Error("Apply should be interrupted", unexpected, missing, success)
+	}
+}
+
+// Records batch calls in addition to operation logs of the mock.
+type batchRecordingConnector struct {
+	connector.DropboxConnectorMock
+	batches []string
+}
+
+func (c *batchRecordingConnector) GroupsMembersAddBatch(groupId string, accountEmails, evidence []string) []error {
+	c.batches = append(c.batches, fmt.Sprintf("GroupsMembersAdd:%s:%d", groupId, len(accountEmails)))
+	return c.DropboxConnectorMock.GroupsMembersAddBatch(groupId, accountEmails, evidence)
+}
+
+func (c *batchRecordingConnector) GroupsMembersRemoveBatch(groupId string, accountEmails, evidence []string) []error {
+	c.batches = append(c.batches, fmt.Sprintf("GroupsMembersRemove:%s:%d", groupId, len(accountEmails)))
+	return c.DropboxConnectorMock.GroupsMembersRemoveBatch(groupId, accountEmails, evidence)
+}
+
+func (c *batchRecordingConnector) MembersAddBatch(members []connector.NewMember) []error {
+	c.batches = append(c.batches, fmt.Sprintf("MembersAdd:%d", len(members)))
+	return c.DropboxConnectorMock.MembersAddBatch(members)
+}
+
+func TestPlan_ApplyBatch(t *testing.T) {
+	p := NewPlan([]string{"user-provision", "group-provision"}, []string{})
+	recorder := NewRecorder(p)
+	recorder.MembersAdd("a@example.com", "gn-a", "sn-a", "", "")
+	recorder.MembersAdd("b@example.com", "gn-b", "sn-b", "", "")
+	recorder.MembersSetEmail("c@example.com", "c2@example.com", "")
+	recorder.MembersAdd("d@example.com", "gn-d", "sn-d", "", "")
+	recorder.GroupsMembersAdd("g1", "a@example.com", "")
+	recorder.GroupsMembersAdd("g1", "b@example.com", "")
+	recorder.GroupsMembersRemove("g1", "c2@example.com", "")
+	recorder.GroupsMembersAdd("g2", "a@example.com", "")
+
+	dc := &batchRecordingConnector{}
+	if err := p.Apply(dc); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected := []string{
+		"MembersAdd:2",
+		"MembersAdd:1",
+		"GroupsMembersAdd:g1:2",
+		"GroupsMembersRemove:g1:1",
+		"GroupsMembersAdd:g2:1",
+	}
+	if fmt.Sprint(dc.batches) != fmt.Sprint(expected) {
+		t.Errorf("Invalid batches: %v", dc.batches)
+	}
+	unexpected, missing, success := dc.AssertLogs([]string{
+		dc.CreateOperationLog("MembersAdd", "a@example.com", "gn-a", "sn-a"),
+		dc.CreateOperationLog("MembersAdd", "b@example.com", "gn-b", "sn-b"),
+		dc.CreateOperationLog("MembersSetEmail", "c@example.com", "c2@example.com"),
+		dc.CreateOperationLog("MembersAdd", "d@example.com", "gn-d", "sn-d"),
+		dc.CreateOperationLog("GroupsMembersAdd", "g1", "a@example.com"),
+		dc.CreateOperationLog("GroupsMembersAdd", "g1", "b@example.com"),
+		dc.CreateOperationLog("GroupsMembersRemove", "g1", "c2@example.com"),
+		dc.CreateOperationLog("GroupsMembersAdd", "g2", "a@example.com"),
+	})
+	if !success {
+		t.Error("Apply failed", unexpected, missing, success)
+	}
+}
+
+// Records evidence explained before each call.
+type evidenceConnector struct {
+	connector.DropboxConnectorMock
+	evidence [][]string
+}
+
+func (c *evidenceConnector) MembersAddBatch(members []connector.NewMember) []error {
+	e := make([]string, 0, len(members))
+	for _, x := range members {
+		e = append(e, x.Evidence)
+	}
+	c.evidence = append(c.evidence, e)
+	return c.DropboxConnectorMock.MembersAddBatch(members)
+}
+
+func (c *evidenceConnector) MembersSetEmail(email, newEmail, evidence string) error {
+	c.evidence = append(c.evidence, []string{evidence})
+	return c.DropboxConnectorMock.MembersSetEmail(email, newEmail, evidence)
+}
+
+func TestPlan_ApplyEvidence(t *testing.T) {
+	p := NewPlan([]string{"user-provision"}, []string{})
+	recorder := NewRecorder(p)
+	recorder.MembersAdd("a@example.com", "gn-a", "sn-a", "", "e-a")
+	recorder.MembersAdd("b@example.com", "gn-b", "sn-b", "", "e-b")
+	recorder.MembersSetEmail("c@example.com", "c2@example.com", "")
+
+	if p.Operations[0].Evidence != "e-a" || p.Operations[1].Evidence != "e-b" || p.Operations[2].Evidence != "" {
+		t.Errorf("Unexpected evidence: %v", p.Operations)
+	}
+
+	dc := &evidenceConnector{}
+	if err := p.Apply(dc); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	expected := [][]string{{"e-a", "e-b"}, {""}}
+	if fmt.Sprint(dc.evidence) != fmt.Sprint(expected) {
+		t.Errorf("Unexpected evidence: %v", dc.evidence)
+	}
+}
+
+func TestPlan_ApplyGroupConflict(t *testing.T) {
+	p := NewPlan([]string{"group-provision"}, []string{"g1@example.com"})
+	recorder := NewRecorder(p)
+	newGroup, _ := recorder.GroupsCreate("G1", "g1@example.com", "")
+	recorder.GroupsMembersAdd(newGroup, "a@example.com", "")
+	recorder.MembersAdd("b@example.com", "gn-b", "sn-b", "", "")
+
+	mock := connector.DropboxConnectorMock{}
+	mock.MockErrors = map[string]error{
+		mock.CreateOperationLog("GroupsCreate", "G1", "g1@example.com"): connector.NewDropboxError(connector.ERROR_KIND_CONFLICT, "GroupsCreate", "group_name_already_used"),
+	}
+	if err := p.Apply(&mock); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if failed := p.Failed(); len(failed) != 2 || failed[0].Type != OPERATION_GROUPS_CREATE || failed[1].Type != OPERATION_GROUPS_MEMBERS_ADD {
+		t.Errorf("Unexpected failed operations: %v", failed)
+	}
+	unexpected, missing, success := mock.AssertLogs([]string{
+		mock.CreateOperationLog("GroupsCreate", "G1", "g1@example.com"),
+		mock.CreateOperationLog("MembersAdd", "b@example.com", "gn-b", "sn-b"),
+	})
+	if !success {
+		t.Error("Members should not be added to the conflicted group", unexpected, missing, success)
+	}
+}
+
+func TestPlan_ApplyUnknownOperation(t *testing.T) {
+	p := NewPlan([]string{"user-provision"}, []string{})
+	p.Operations = append(p.Operations, Operation{Type: "Unknown", Email: "a@example.com"})
+	recorder := NewRecorder(p)
+	recorder.MembersAdd("b@example.com", "gn-b", "sn-b", "", "")
+
+	mock := connector.DropboxConnectorMock{}
+	if err := p.Apply(&mock); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+	if failed := p.Failed(); len(failed) != 1 || failed[0].Type != "Unknown" {
+		t.Errorf("Unknown operation should be failed: %v", failed)
+	}
+	unexpected, missing, success := mock.AssertLogs([]string{
+		mock.CreateOperationLog("MembersAdd", "b@example.com", "gn-b", "sn-b"),
+	})
+	if !success {
+		t.Error("Apply failed", unexpected, missing, success)
+	}
+}
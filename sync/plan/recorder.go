@@ -0,0 +1,171 @@
+package plan
+
+import (
+	"github.com/watermint/dcfg/integration/connector"
+)
+
+// DropboxConnector which records operations into the plan instead of executing them.
+// Recording never fails, errors are reported on Apply.
+type DropboxConnectorRecorder struct {
+	Plan *Plan
+
+	// Sync mode recorded into operations
+	Mode string
+}
+
+func NewRecorder(p *Plan) *DropboxConnectorRecorder {
+	return &DropboxConnectorRecorder{
+		Plan: p,
+	}
+}
+
+func (r *DropboxConnectorRecorder) enqueue(op Operation) {
+	op.Mode = r.Mode
+	r.Plan.enqueue(op)
+}
+
+func (r *DropboxConnectorRecorder) GroupsCreate(groupName, groupExternalId, evidence string) (string, error) {
+	r.enqueue(Operation{
+		Type:            OPERATION_GROUPS_CREATE,
+		GroupName:       groupName,
+		GroupExternalId: groupExternalId,
+		Evidence:        evidence,
+	})
+	return PlaceholderGroupId(groupExternalId), nil
+}
+
+func (r *DropboxConnectorRecorder) GroupsUpdate(groupId, newGroupName, evidence string) error {
+	r.enqueue(Operation{
+		Type:      OPERATION_GROUPS_UPDATE,
+		GroupId:   groupId,
+		GroupName: newGroupName,
+		Evidence:  evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) GroupsDelete(groupId, evidence string) error {
+	r.enqueue(Operation{
+		Type:     OPERATION_GROUPS_DELETE,
+		GroupId:  groupId,
+		Evidence: evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) GroupsMembersAdd(groupId, accountEmail, evidence string) error {
+	r.enqueue(Operation{
+		Type:     OPERATION_GROUPS_MEMBERS_ADD,
+		GroupId:  groupId,
+		Email:    accountEmail,
+		Evidence: evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) GroupsMembersRemove(groupId, accountEmail, evidence string) error {
+	r.enqueue(Operation{
+		Type:     OPERATION_GROUPS_MEMBERS_REMOVE,
+		GroupId:  groupId,
+		Email:    accountEmail,
+		Evidence: evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) MembersRemove(email string, wipeData bool, transferDestEmail, transferAdminEmail, evidence string) error {
+	r.enqueue(Operation{
+		Type:               OPERATION_MEMBERS_REMOVE,
+		Email:              email,
+		WipeData:           wipeData,
+		TransferDestEmail:  transferDestEmail,
+		TransferAdminEmail: transferAdminEmail,
+		Evidence:           evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) MembersSuspend(email, evidence string) error {
+	r.enqueue(Operation{
+		Type:     OPERATION_MEMBERS_SUSPEND,
+		Email:    email,
+		Evidence: evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) MembersUnsuspend(email, evidence string) error {
+	r.enqueue(Operation{
+		Type:     OPERATION_MEMBERS_UNSUSPEND,
+		Email:    email,
+		Evidence: evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) MembersAdd(email, givenName, surname, externalId, evidence string) error {
+	r.enqueue(Operation{
+		Type:       OPERATION_MEMBERS_ADD,
+		Email:      email,
+		GivenName:  givenName,
+		Surname:    surname,
+		ExternalId: externalId,
+		Evidence:   evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) MembersSetProfile(email, givenName, surname, evidence string) error {
+	r.enqueue(Operation{
+		Type:      OPERATION_MEMBERS_SET_PROFILE,
+		Email:     email,
+		GivenName: givenName,
+		Surname:   surname,
+		Evidence:  evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) MembersSetEmail(email, newEmail, evidence string) error {
+	r.enqueue(Operation{
+		Type:     OPERATION_MEMBERS_SET_EMAIL,
+		Email:    email,
+		NewEmail: newEmail,
+		Evidence: evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) MembersSetExternalId(email, externalId, evidence string) error {
+	r.enqueue(Operation{
+		Type:       OPERATION_MEMBERS_SET_EXT_ID,
+		Email:      email,
+		ExternalId: externalId,
+		Evidence:   evidence,
+	})
+	return nil
+}
+
+func (r *DropboxConnectorRecorder) GroupsMembersAddBatch(groupId string, accountEmails, evidence []string) []error {
+	errs := make([]error, len(accountEmails))
+	for i, x := range accountEmails {
+		errs[i] = r.GroupsMembersAdd(groupId, x, connector.EvidenceAt(evidence, i))
+	}
+	return errs
+}
+
+func (r *DropboxConnectorRecorder) GroupsMembersRemoveBatch(groupId string, accountEmails, evidence []string) []error {
+	errs := make([]error, len(accountEmails))
+	for i, x := range accountEmails {
+		errs[i] = r.GroupsMembersRemove(groupId, x, connector.EvidenceAt(evidence, i))
+	}
+	return errs
+}
+
+func (r *DropboxConnectorRecorder) MembersAddBatch(members []connector.NewMember) []error {
+	errs := make([]error, len(members))
+	for i, x := range members {
+		errs[i] = r.MembersAdd(x.Email, x.GivenName, x.Surname, x.ExternalId, x.Evidence)
+	}
+	return errs
+}
@@ -1,26 +1,39 @@
 package usersync
 
 import (
+	"fmt"
 	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli"
 	"github.com/watermint/dcfg/cli/explorer"
 	"github.com/watermint/dcfg/integration/directory"
+	"time"
 )
 
 // Deprovision Dropbox account based on Google side status.
 // If the account, which identified by email, is not exist on Google Apps,
-// this function deletes Dropbox account.
-func (d *UserSync) SyncDeprovision() {
+// this function deletes or suspends Dropbox account depends on the deprovision policy.
+// Returns error if emails of Google cannot be loaded.
+func (d *UserSync) SyncDeprovision() error {
 	seelog.Trace("Account Sync: Deprovision")
 
 	dropboxMembers := d.DropboxAccounts.Accounts()
 	dropboxMembersNotInGoogle := make([]directory.Account, 0)
 	confirmedDeprovision := make([]directory.Account, 0)
+	unconfirmed := make(map[string]bool)
+	renamed := make(map[string]bool)
+	for _, x := range d.renamedMembers() {
+		renamed[x.Email] = true
+	}
 
 	for _, x := range dropboxMembers {
+		if renamed[x.Email] {
+			seelog.Tracef("Skip Dropbox User renamed on Google: Email[%s] CorrelationId[%s]", x.Email, x.CorrelationId)
+			continue
+		}
 		exist, err := d.GoogleEmail.EmailExist(x.Email)
 		if err != nil {
-			seelog.Errorf("Cannot load emails of Google")
-			explorer.FatalShutdown("Please verify Google auth status or network condition")
+			seelog.Errorf("Cannot load emails of Google: Err[%v]", err)
+			return err
 		}
 		if !exist {
 			dropboxMembersNotInGoogle = append(dropboxMembersNotInGoogle, x)
@@ -29,12 +42,13 @@ func (d *UserSync) SyncDeprovision() {
 
 	seelog.Tracef("[%d] user(s) detected who no longer in the list of Google", len(dropboxMembersNotInGoogle))
 	for _, x := range dropboxMembersNotInGoogle {
-		exist, err := d.GoogleConfirm.EmailExist(x.Email)
 		seelog.Tracef("Reconfirming existence of the user: Email[%s]", x.Email)
-
+		exist, err := d.GoogleConfirm.EmailExist(x.Email)
 		if err != nil {
-			seelog.Errorf("Cannot load emails of Google")
-			explorer.FatalShutdown("Please verify Google auth status or network condition")
+			seelog.Warnf("Unable to reconfirm existence of the user: Email[%s] Err[%v]", x.Email, err)
+			explorer.ReportFailure("Deprovision skipped for Dropbox account: Email[%s] (reason: unable to confirm existence on Google: %v)", x.Email, err)
+			unconfirmed[x.Email] = true
+			continue
 		}
 		if !exist {
 			seelog.Tracef("Reconfirmed NO-EXISTENCE of the user: Email[%s]", x.Email)
@@ -44,8 +58,98 @@ func (d *UserSync) SyncDeprovision() {
 
 	seelog.Tracef("Dropbox [%d] user(s)", len(dropboxMembers))
 	seelog.Tracef("Dropbox [%d] user(s) are not in Google (reconfirmed)", len(confirmedDeprovision))
-	for _, x := range confirmedDeprovision {
-		seelog.Tracef("Removing Dropbox User: Email[%s]", x.Email)
-		d.DropboxConnector.MembersRemove(x.Email)
+	d.deprovision(confirmedDeprovision, unconfirmed)
+	return nil
+}
+
+func (d *UserSync) deprovision(confirmed []directory.Account, unconfirmed map[string]bool) {
+	if d.DeprovisionState == nil {
+		d.DeprovisionState = NewDeprovisionState()
+	}
+	state := d.DeprovisionState
+	policy := d.DeprovisionPolicy
+	now := time.Now()
+
+	// Forget users which no longer missing. Keep users which existence is unknown.
+	missing := make(map[string]bool)
+	for _, x := range confirmed {
+		missing[x.Email] = true
+	}
+	for email := range unconfirmed {
+		missing[email] = true
+	}
+	d.reinstateReappeared(missing)
+	state.Retain(missing)
+
+	for _, x := range confirmed {
+		firstSeen, tracked := state.FirstSeenMissing[x.Email]
+		switch policy.Policy {
+		case cli.DEPROVISION_POLICY_SUSPEND:
+			state.MarkMissing(x.Email, now)
+			d.suspendMember(x, state.FirstSeenMissing[x.Email])
+
+		case cli.DEPROVISION_POLICY_SUSPEND_THEN_REMOVE:
+			if !tracked {
+				state.MarkMissing(x.Email, now)
+				d.suspendMember(x, now)
+				continue
+			}
+			if now.Sub(firstSeen) < policy.GracePeriod {
+				seelog.Tracef("Dropbox User in grace period: Email[%s] FirstSeenMissing[%s]", x.Email, firstSeen)
+				// Retry if the previous suspend failed
+				d.suspendMember(x, firstSeen)
+				continue
+			}
+			seelog.Tracef("Removing Dropbox User after grace period: Email[%s] FirstSeenMissing[%s]", x.Email, firstSeen)
+			d.removeMember(x, firstSeen)
+
+		default:
+			d.removeMember(x, now)
+		}
 	}
 }
+
+// Unsuspend users suspended by DCFG, who exist on Google again. Users suspended
+// on Google are out of scope (see SyncSuspend).
+func (d *UserSync) reinstateReappeared(missing map[string]bool) {
+	state := d.DeprovisionState
+	dropboxMembers := d.DropboxAccounts.Accounts()
+	googleMembers := d.GoogleAccounts.Accounts()
+	for email, firstSeen := range state.FirstSeenMissing {
+		if missing[email] {
+			continue
+		}
+		x, exist := dropboxMembers[email]
+		if !exist || !x.IsSuspended() || !state.IsSuspendedByDcfg(email) {
+			continue
+		}
+		g, exist := googleMembers[email]
+		if !exist || g.IsSuspended() {
+			seelog.Warnf("Dropbox User reappeared but not active on Google: Email[%s] FirstSeenMissing[%s]", email, firstSeen)
+			explorer.ReportFailure("Dropbox account stays suspended: %s (reason: the user exists on Google again, but the account is not active)", email)
+			continue
+		}
+		seelog.Tracef("Unsuspending Dropbox User reappeared on Google: Email[%s] FirstSeenMissing[%s]", email, firstSeen)
+		d.DropboxConnector.MembersUnsuspend(email, fmt.Sprintf("Google user found again: Email[%s] GoogleUserId[%s] FirstSeenMissing[%s]", g.Email, g.CorrelationId, firstSeen.Format(time.RFC3339)))
+	}
+}
+
+// Evidence of deprovisioning for the audit log.
+func deprovisionEvidence(account directory.Account, firstSeenMissing time.Time) string {
+	return fmt.Sprintf("Google user not found: Email[%s] FirstSeenMissing[%s]", account.Email, firstSeenMissing.Format(time.RFC3339))
+}
+
+func (d *UserSync) suspendMember(account directory.Account, firstSeenMissing time.Time) {
+	if account.IsSuspended() {
+		seelog.Tracef("Dropbox User already suspended: Email[%s]", account.Email)
+		return
+	}
+	seelog.Tracef("Suspending Dropbox User: Email[%s]", account.Email)
+	d.DropboxConnector.MembersSuspend(account.Email, deprovisionEvidence(account, firstSeenMissing))
+}
+
+func (d *UserSync) removeMember(account directory.Account, firstSeenMissing time.Time) {
+	policy := d.DeprovisionPolicy
+	seelog.Tracef("Removing Dropbox User: Email[%s]", account.Email)
+	d.DropboxConnector.MembersRemove(account.Email, policy.WipeData, policy.TransferDestEmail, policy.TransferAdminEmail, deprovisionEvidence(account, firstSeenMissing))
+}
@@ -1,9 +1,15 @@
 package usersync
 
 import (
+	"errors"
+	"github.com/watermint/dcfg/cli"
 	"github.com/watermint/dcfg/integration/connector"
 	"github.com/watermint/dcfg/integration/directory"
+	"io/ioutil"
+	"os"
+	"path"
 	"testing"
+	"time"
 )
 
 func TestUserSyncRemoveUser(t *testing.T) {
@@ -212,3 +218,248 @@ func TestUserSync_SyncDeprovision(t *testing.T) {
 		t.Error("Sync failed", unexpected, missing, success)
 	}
 }
+
+func TestUserSyncRemoveUserUnconfirmed(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	googleEmail := directory.EmailResolverMock{
+		MockData: []string{
+			"a@example.com",
+		},
+	}
+	googleConfirm := directory.EmailResolverMock{
+		MockData: []string{
+			"a@example.com",
+		},
+		MockErrors: map[string]error{
+			"c@example.com": errors.New("backend error"),
+		},
+	}
+	dropboxAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			directory.Account{
+				Email: "a@example.com",
+			},
+			directory.Account{
+				Email: "b@example.com",
+			},
+			directory.Account{
+				Email: "c@example.com",
+			},
+		},
+	}
+	userSync := UserSync{
+		DropboxConnector: &provision,
+		DropboxAccounts:  &dropboxAccounts,
+		GoogleAccounts:   &directory.AccountDirectoryMock{},
+		GoogleGroups:     &directory.GroupDirectoryMock{},
+		GoogleEmail:      &googleEmail,
+		GoogleConfirm:    &googleConfirm,
+	}
+	userSync.SyncDeprovision()
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("MembersRemove", "b@example.com"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
+
+func newDeprovisionPolicyTestSync(provision *connector.DropboxConnectorMock, policy DeprovisionPolicy, state *DeprovisionState) *UserSync {
+	googleEmail := directory.EmailResolverMock{
+		MockData: []string{
+			"a@example.com",
+		},
+	}
+	dropboxAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com"},
+			{Email: "b@example.com"},
+			{Email: "c@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+		},
+	}
+	return &UserSync{
+		DropboxConnector:  provision,
+		DropboxAccounts:   &dropboxAccounts,
+		GoogleAccounts:    &directory.AccountDirectoryMock{},
+		GoogleGroups:      &directory.GroupDirectoryMock{},
+		GoogleEmail:       &googleEmail,
+		GoogleConfirm:     &googleEmail,
+		DeprovisionPolicy: policy,
+		DeprovisionState:  state,
+	}
+}
+
+func TestUserSyncSuspendUser(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	state := NewDeprovisionState()
+	state.MarkMissing("c@example.com", time.Now())
+	state.MarkMissing("a@example.com", time.Now())
+
+	userSync := newDeprovisionPolicyTestSync(&provision, DeprovisionPolicy{Policy: cli.DEPROVISION_POLICY_SUSPEND}, state)
+	userSync.SyncDeprovision()
+
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("MembersSuspend", "b@example.com"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+	if _, e := state.FirstSeenMissing["a@example.com"]; e {
+		t.Error("Returned user should be forgotten")
+	}
+	if _, e := state.FirstSeenMissing["b@example.com"]; !e {
+		t.Error("Suspended user should be tracked")
+	}
+}
+
+func TestUserSyncSuspendThenRemoveUser(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	state := NewDeprovisionState()
+	state.MarkMissing("b@example.com", time.Now().Add(-40*24*time.Hour))
+	state.MarkMissing("c@example.com", time.Now().Add(-10*24*time.Hour))
+
+	policy := DeprovisionPolicy{
+		Policy:      cli.DEPROVISION_POLICY_SUSPEND_THEN_REMOVE,
+		GracePeriod: 30 * 24 * time.Hour,
+	}
+	userSync := newDeprovisionPolicyTestSync(&provision, policy, state)
+	userSync.SyncDeprovision()
+
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("MembersRemove", "b@example.com"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
+
+func TestDeprovisionStateSaveLoad(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dcfg-state")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	statePath := path.Join(dir, "state.json")
+	if s, err := LoadDeprovisionState(statePath); err != nil || len(s.FirstSeenMissing) != 0 {
+		t.Errorf("Unexpected state: %v %v", s, err)
+	}
+
+	state := NewDeprovisionState()
+	state.MarkMissing("a@example.com", time.Now())
+	if err := state.Save(statePath); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := LoadDeprovisionState(statePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, e := loaded.FirstSeenMissing["a@example.com"]; !e {
+		t.Errorf("Unexpected state: %v", loaded)
+	}
+}
+
+func TestUserSyncRemoveUserRenamed(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	googleEmail := directory.EmailResolverMock{
+		MockData: []string{
+			"a-new@example.com",
+		},
+	}
+	googleAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a-new@example.com", CorrelationId: "id-a"},
+		},
+	}
+	dropboxAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", CorrelationId: "id-a"},
+			{Email: "b@example.com", CorrelationId: "id-b"},
+		},
+	}
+	userSync := UserSync{
+		DropboxConnector: &provision,
+		DropboxAccounts:  &dropboxAccounts,
+		GoogleAccounts:   &googleAccounts,
+		GoogleGroups:     &directory.GroupDirectoryMock{},
+		GoogleEmail:      &googleEmail,
+		GoogleConfirm:    &googleEmail,
+	}
+	userSync.SyncDeprovision()
+
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("MembersRemove", "b@example.com"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
+
+func TestUserSyncReappearedUser(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	googleEmail := directory.EmailResolverMock{
+		MockData: []string{
+			"a@example.com",
+			"b@example.com",
+			"c@example.com",
+		},
+	}
+	googleAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", Status: directory.ACCOUNT_STATUS_ACTIVE},
+			{Email: "b@example.com", Status: directory.ACCOUNT_STATUS_ACTIVE},
+			{Email: "c@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+		},
+	}
+	dropboxAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+			{Email: "b@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+			{Email: "c@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+		},
+	}
+	state := NewDeprovisionState()
+	firstSeen := time.Now().Add(-10 * 24 * time.Hour)
+	for _, x := range []string{"a@example.com", "b@example.com", "c@example.com"} {
+		state.MarkMissing(x, firstSeen)
+	}
+	// b@example.com is suspended by an admin, not by DCFG
+	state.MarkSuspended("a@example.com", firstSeen)
+	state.MarkSuspended("c@example.com", firstSeen)
+
+	userSync := UserSync{
+		DropboxConnector:  &provision,
+		DropboxAccounts:   &dropboxAccounts,
+		GoogleAccounts:    &googleAccounts,
+		GoogleGroups:      &directory.GroupDirectoryMock{},
+		GoogleEmail:       &googleEmail,
+		GoogleConfirm:     &googleEmail,
+		DeprovisionPolicy: DeprovisionPolicy{Policy: cli.DEPROVISION_POLICY_SUSPEND_THEN_REMOVE, GracePeriod: 30 * 24 * time.Hour},
+		DeprovisionState:  state,
+	}
+	userSync.SyncDeprovision()
+
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("MembersUnsuspend", "a@example.com"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+	if len(state.FirstSeenMissing) != 0 {
+		t.Errorf("Reappeared users should be forgotten: %v", state.FirstSeenMissing)
+	}
+}
+
+func TestDeprovisionStateClone(t *testing.T) {
+	state := NewDeprovisionState()
+	state.MarkMissing("a@example.com", time.Now())
+
+	next := state.Clone()
+	next.MarkMissing("b@example.com", time.Now())
+	next.MarkSuspended("b@example.com", time.Now())
+	next.Retain(map[string]bool{"b@example.com": true})
+
+	if _, e := state.FirstSeenMissing["a@example.com"]; !e || len(state.FirstSeenMissing) != 1 || len(state.SuspendedByDcfg) != 0 {
+		t.Errorf("Original state should not be changed: %v", state)
+	}
+}
@@ -1,17 +1,30 @@
 package usersync
 
-import "github.com/cihub/seelog"
+import (
+	"fmt"
+	"github.com/cihub/seelog"
+)
 
 func (d *UserSync) SyncProvision() {
 	seelog.Trace("Account Sync: Provision")
 
 	googleMembers := d.GoogleAccounts.Accounts()
 	googleMembersNotInDropbox := d.membersNotInDirectory(googleMembers, d.DropboxAccounts)
+	renamed := d.renamedMembers()
 
 	seelog.Tracef("%d users in Google Apps", len(googleMembers))
 	seelog.Tracef("Google [%d] user(s) are not in Dropbox", len(googleMembersNotInDropbox))
 	for _, x := range googleMembersNotInDropbox {
+		if x.IsSuspended() {
+			seelog.Tracef("Skip suspended Google User: Email[%s]", x.Email)
+			continue
+		}
+		if old, e := renamed[x.Email]; e {
+			seelog.Tracef("Changing email of Dropbox User: Email[%s] NewEmail[%s]", old.Email, x.Email)
+			d.DropboxConnector.MembersSetEmail(old.Email, x.Email, fmt.Sprintf("Google user renamed: Email[%s -> %s] GoogleUserId[%s]", old.Email, x.Email, x.CorrelationId))
+			continue
+		}
 		seelog.Tracef("Adding Dropbox User: Email[%s]", x)
-		d.DropboxConnector.MembersAdd(x.Email, x.GivenName, x.Surname)
+		d.DropboxConnector.MembersAdd(x.Email, x.GivenName, x.Surname, x.CorrelationId, fmt.Sprintf("Google user active: Email[%s] GoogleUserId[%s]", x.Email, x.CorrelationId))
 	}
 }
@@ -136,3 +136,34 @@ func TestUserSyncAddUser3(t *testing.T) {
 		t.Error("Sync failed", unexpected, missing, success)
 	}
 }
+
+func TestUserSyncRenameUser(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	googleAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", GivenName: "Given-A", Surname: "Sur-A", CorrelationId: "id-a"},
+			{Email: "b-new@example.com", GivenName: "Given-B", Surname: "Sur-B", CorrelationId: "id-b"},
+			{Email: "c@example.com", GivenName: "Given-C", Surname: "Sur-C", CorrelationId: "id-c"},
+		},
+	}
+	dropboxAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", CorrelationId: "id-a"},
+			{Email: "b@example.com", CorrelationId: "id-b"},
+		},
+	}
+	userSync := UserSync{
+		DropboxConnector: &provision,
+		DropboxAccounts:  &dropboxAccounts,
+		GoogleAccounts:   &googleAccounts,
+	}
+	userSync.SyncProvision()
+
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("MembersSetEmail", "b@example.com", "b-new@example.com"),
+		provision.CreateOperationLog("MembersAdd", "c@example.com", "Given-C", "Sur-C", "id-c"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
@@ -0,0 +1,90 @@
+package usersync
+
+import (
+	"github.com/watermint/dcfg/common/file"
+	"time"
+)
+
+// Deprovision state which persisted between runs.
+type DeprovisionState struct {
+	// Email -> the time DCFG found the user missing from Google at first.
+	FirstSeenMissing map[string]time.Time `json:"first_seen_missing"`
+
+	// Email -> the time DCFG suspended the user. Users suspended by admins
+	// outside of DCFG are not unsuspended.
+	SuspendedByDcfg map[string]time.Time `json:"suspended_by_dcfg"`
+}
+
+func NewDeprovisionState() *DeprovisionState {
+	return &DeprovisionState{
+		FirstSeenMissing: make(map[string]time.Time),
+		SuspendedByDcfg:  make(map[string]time.Time),
+	}
+}
+
+// Load state from the file. Returns empty state if the file not found.
+func LoadDeprovisionState(path string) (*DeprovisionState, error) {
+	state := NewDeprovisionState()
+	if !file.FileExist(path) {
+		return state, nil
+	}
+	if _, err := file.LoadJSON(path, state); err != nil {
+		return nil, err
+	}
+	if state.FirstSeenMissing == nil {
+		state.FirstSeenMissing = make(map[string]time.Time)
+	}
+	if state.SuspendedByDcfg == nil {
+		state.SuspendedByDcfg = make(map[string]time.Time)
+	}
+	return state, nil
+}
+
+// Copy of the state. Planning updates the copy, and the copy is saved only
+// if the plan is applied.
+func (s *DeprovisionState) Clone() *DeprovisionState {
+	c := NewDeprovisionState()
+	for k, v := range s.FirstSeenMissing {
+		c.FirstSeenMissing[k] = v
+	}
+	for k, v := range s.SuspendedByDcfg {
+		c.SuspendedByDcfg[k] = v
+	}
+	return c
+}
+
+func (s *DeprovisionState) Save(path string) error {
+	return file.SaveJSON(path, s)
+}
+
+func (s *DeprovisionState) MarkMissing(email string, t time.Time) {
+	if _, e := s.FirstSeenMissing[email]; !e {
+		s.FirstSeenMissing[email] = t
+	}
+}
+
+// Record the user suspended by DCFG. Call only after the suspension applied.
+func (s *DeprovisionState) MarkSuspended(email string, t time.Time) {
+	if _, e := s.SuspendedByDcfg[email]; !e {
+		s.SuspendedByDcfg[email] = t
+	}
+}
+
+// Forget the user unsuspended or removed.
+func (s *DeprovisionState) ForgetSuspended(email string) {
+	delete(s.SuspendedByDcfg, email)
+}
+
+func (s *DeprovisionState) IsSuspendedByDcfg(email string) bool {
+	_, e := s.SuspendedByDcfg[email]
+	return e
+}
+
+// Remove emails not in `emails`.
+func (s *DeprovisionState) Retain(emails map[string]bool) {
+	for email := range s.FirstSeenMissing {
+		if !emails[email] {
+			delete(s.FirstSeenMissing, email)
+		}
+	}
+}
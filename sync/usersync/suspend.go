@@ -0,0 +1,39 @@
+package usersync
+
+import (
+	"fmt"
+	"github.com/cihub/seelog"
+)
+
+// Mirror suspension status of Google users onto Dropbox members.
+// Dropbox members whose Google account is suspended will be suspended,
+// and suspended Dropbox members whose Google account is active will be unsuspended
+// only if DCFG suspended them (see DeprovisionState).
+// Members which not found on Google are out of scope (see SyncDeprovision).
+func (d *UserSync) SyncSuspend() {
+	seelog.Trace("Account Sync: Suspend")
+
+	googleMembers := d.GoogleAccounts.Accounts()
+	dropboxMembers := d.DropboxAccounts.Accounts()
+
+	seelog.Tracef("%d users in Google Apps", len(googleMembers))
+	seelog.Tracef("%d users in Dropbox", len(dropboxMembers))
+	for _, x := range dropboxMembers {
+		g, exist := googleMembers[x.Email]
+		if !exist {
+			continue
+		}
+		switch {
+		case g.IsSuspended() && x.IsActive():
+			seelog.Tracef("Suspending Dropbox User: Email[%s]", x.Email)
+			d.DropboxConnector.MembersSuspend(x.Email, fmt.Sprintf("Google user suspended: Email[%s] GoogleUserId[%s]", g.Email, g.CorrelationId))
+		case !g.IsSuspended() && x.IsSuspended():
+			if d.DeprovisionState == nil || !d.DeprovisionState.IsSuspendedByDcfg(x.Email) {
+				seelog.Tracef("Skip Dropbox User not suspended by DCFG: Email[%s]", x.Email)
+				continue
+			}
+			seelog.Tracef("Unsuspending Dropbox User: Email[%s]", x.Email)
+			d.DropboxConnector.MembersUnsuspend(x.Email, fmt.Sprintf("Google user active: Email[%s] GoogleUserId[%s]", g.Email, g.CorrelationId))
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package usersync
+
+import (
+	"github.com/watermint/dcfg/integration/connector"
+	"github.com/watermint/dcfg/integration/directory"
+	"testing"
+	"time"
+)
+
+func TestUserSyncSuspend(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	googleAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", Status: directory.ACCOUNT_STATUS_ACTIVE},
+			{Email: "b@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+			{Email: "c@example.com", Status: directory.ACCOUNT_STATUS_ACTIVE},
+			{Email: "d@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+			{Email: "e@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+			{Email: "g@example.com", Status: directory.ACCOUNT_STATUS_ACTIVE},
+		},
+	}
+	dropboxAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", Status: directory.ACCOUNT_STATUS_ACTIVE},
+			{Email: "b@example.com", Status: directory.ACCOUNT_STATUS_ACTIVE},
+			{Email: "c@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+			{Email: "d@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+			{Email: "e@example.com", Status: directory.ACCOUNT_STATUS_INVITED},
+			{Email: "f@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+			{Email: "g@example.com", Status: directory.ACCOUNT_STATUS_SUSPENDED},
+		},
+	}
+
+	// g@example.com is suspended by an admin on Dropbox, and must stay suspended
+	state := NewDeprovisionState()
+	state.MarkSuspended("c@example.com", time.Now())
+
+	userSync := UserSync{
+		DropboxConnector: &provision,
+		DropboxAccounts:  &dropboxAccounts,
+		GoogleAccounts:   &googleAccounts,
+		GoogleGroups:     &directory.GroupDirectoryMock{},
+		GoogleEmail:      &directory.EmailResolverMock{},
+		GoogleConfirm:    &directory.EmailResolverMock{},
+		DeprovisionState: state,
+	}
+	userSync.SyncSuspend()
+
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("MembersSuspend", "b@example.com"),
+		provision.CreateOperationLog("MembersUnsuspend", "c@example.com"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
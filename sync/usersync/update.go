@@ -0,0 +1,46 @@
+package usersync
+
+import (
+	"fmt"
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/integration/directory"
+)
+
+// Update profile of Dropbox members if the name changed on Google.
+// Also stores Google user ID as external ID of Dropbox members which not yet have it.
+func (d *UserSync) SyncUpdate() {
+	seelog.Trace("Account Sync: Update")
+
+	googleMembers := d.GoogleAccounts.Accounts()
+	dropboxMembers := d.DropboxAccounts.Accounts()
+
+	seelog.Tracef("%d users in Google Apps", len(googleMembers))
+	for _, x := range dropboxMembers {
+		g, exist := googleMembers[x.Email]
+		if !exist {
+			continue
+		}
+		d.updateCorrelationId(x, g)
+		if g.GivenName == "" && g.Surname == "" {
+			seelog.Tracef("Skip Google User without name: Email[%s]", g.Email)
+			continue
+		}
+		if g.GivenName == x.GivenName && g.Surname == x.Surname {
+			continue
+		}
+		seelog.Tracef("Updating Dropbox User: Email[%s] GivenName[%s -> %s] Surname[%s -> %s]", x.Email, x.GivenName, g.GivenName, x.Surname, g.Surname)
+		d.DropboxConnector.MembersSetProfile(x.Email, g.GivenName, g.Surname, fmt.Sprintf("Google user name: Email[%s] GivenName[%s] Surname[%s]", g.Email, g.GivenName, g.Surname))
+	}
+}
+
+func (d *UserSync) updateCorrelationId(dropbox, google directory.Account) {
+	switch {
+	case google.CorrelationId == "" || dropbox.CorrelationId == google.CorrelationId:
+		return
+	case dropbox.CorrelationId == "":
+		seelog.Tracef("Updating external ID of Dropbox User: Email[%s] ExternalId[%s]", dropbox.Email, google.CorrelationId)
+		d.DropboxConnector.MembersSetExternalId(dropbox.Email, google.CorrelationId, fmt.Sprintf("Google user ID: Email[%s] GoogleUserId[%s]", google.Email, google.CorrelationId))
+	default:
+		seelog.Warnf("External ID of Dropbox User does not match to Google user ID: Email[%s] ExternalId[%s] GoogleUserId[%s]", dropbox.Email, dropbox.CorrelationId, google.CorrelationId)
+	}
+}
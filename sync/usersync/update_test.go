@@ -0,0 +1,45 @@
+package usersync
+
+import (
+	"github.com/watermint/dcfg/integration/connector"
+	"github.com/watermint/dcfg/integration/directory"
+	"testing"
+)
+
+func TestUserSyncUpdate(t *testing.T) {
+	provision := connector.DropboxConnectorMock{}
+	googleAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", GivenName: "Given-A", Surname: "Sur-A"},
+			{Email: "b@example.com", GivenName: "Given-B", Surname: "NewSur-B"},
+			{Email: "c@example.com", GivenName: "NewGiven-C", Surname: "Sur-C"},
+			{Email: "d@example.com"},
+			{Email: "f@example.com", GivenName: "Given-F", Surname: "Sur-F", CorrelationId: "id-f"},
+		},
+	}
+	dropboxAccounts := directory.AccountDirectoryMock{
+		MockData: []directory.Account{
+			{Email: "a@example.com", GivenName: "Given-A", Surname: "Sur-A"},
+			{Email: "b@example.com", GivenName: "Given-B", Surname: "Sur-B"},
+			{Email: "c@example.com", GivenName: "Given-C", Surname: "Sur-C"},
+			{Email: "d@example.com", GivenName: "Given-D", Surname: "Sur-D"},
+			{Email: "e@example.com", GivenName: "Given-E", Surname: "Sur-E"},
+			{Email: "f@example.com", GivenName: "Given-F", Surname: "Sur-F"},
+		},
+	}
+	userSync := UserSync{
+		DropboxConnector: &provision,
+		DropboxAccounts:  &dropboxAccounts,
+		GoogleAccounts:   &googleAccounts,
+	}
+	userSync.SyncUpdate()
+
+	unexpected, missing, success := provision.AssertLogs([]string{
+		provision.CreateOperationLog("MembersSetProfile", "b@example.com", "Given-B", "NewSur-B"),
+		provision.CreateOperationLog("MembersSetProfile", "c@example.com", "NewGiven-C", "Sur-C"),
+		provision.CreateOperationLog("MembersSetExternalId", "f@example.com", "id-f"),
+	})
+	if !success {
+		t.Error("Sync failed", unexpected, missing, success)
+	}
+}
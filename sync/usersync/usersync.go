@@ -1,9 +1,12 @@
 package usersync
 
 import (
+	"github.com/cihub/seelog"
+	"github.com/watermint/dcfg/cli"
 	"github.com/watermint/dcfg/integration/connector"
 	"github.com/watermint/dcfg/integration/context"
 	"github.com/watermint/dcfg/integration/directory"
+	"time"
 )
 
 type UserSync struct {
@@ -13,11 +16,38 @@ type UserSync struct {
 	GoogleGroups     directory.GroupResolver
 	GoogleEmail      directory.EmailResolver // Resolver for lookup
 	GoogleConfirm    directory.EmailResolver // Resolver for confirmation
+
+	DeprovisionPolicy DeprovisionPolicy
+	DeprovisionState  *DeprovisionState
+}
+
+type DeprovisionPolicy struct {
+	Policy             string
+	GracePeriod        time.Duration // for suspend-then-remove
+	WipeData           bool
+	TransferDestEmail  string
+	TransferAdminEmail string
+}
+
+func NewDeprovisionPolicy(options cli.Options) DeprovisionPolicy {
+	return DeprovisionPolicy{
+		Policy:             options.DeprovisionPolicy,
+		GracePeriod:        time.Duration(options.DeprovisionGraceDays) * 24 * time.Hour,
+		WipeData:           options.DeprovisionWipeData,
+		TransferDestEmail:  options.DeprovisionTransferDest,
+		TransferAdminEmail: options.DeprovisionTransferAdmin,
+	}
 }
 
-func NewUserSync(context context.ExecutionContext) UserSync {
-	gd := directory.NewGoogleDirectory(context)
-	dd := directory.NewDropboxDirectory(context)
+func NewUserSync(context context.ExecutionContext) (UserSync, error) {
+	gd, err := directory.NewGoogleDirectory(context)
+	if err != nil {
+		return UserSync{}, err
+	}
+	dd, err := directory.NewDropboxDirectory(context)
+	if err != nil {
+		return UserSync{}, err
+	}
 	dp := connector.CreateConnector(context)
 	gc := directory.NewGoogleEmailResolver(context)
 
@@ -28,7 +58,9 @@ func NewUserSync(context context.ExecutionContext) UserSync {
 		GoogleGroups:     gd,
 		GoogleEmail:      gd,
 		GoogleConfirm:    gc,
-	}
+
+		DeprovisionPolicy: NewDeprovisionPolicy(context.Options),
+	}, nil
 }
 
 func (d *UserSync) membersNotInDirectory(members map[string]directory.Account, ad directory.AccountDirectory) (notInDir []directory.Account) {
@@ -49,12 +81,44 @@ func (d *UserSync) memberInGroups(needle directory.Account, haystack []directory
 	return false
 }
 
-func (d *UserSync) membersNotInGroup(member []directory.Account, gd directory.GroupResolver) (notInDir []directory.Account) {
+func (d *UserSync) membersNotInGroup(member []directory.Account, gd directory.GroupResolver) (notInDir []directory.Account, err error) {
 	for _, x := range member {
-		_, exist := gd.Group(x.Email)
+		_, exist, err := gd.Group(x.Email)
+		if err != nil {
+			return nil, err
+		}
 		if !exist {
 			notInDir = append(notInDir, x)
 		}
 	}
 	return
 }
+
+// Detect Google users renamed their primary email. Returns new email -> Dropbox account (old email).
+// Accounts are correlated by Google user ID which stored as external ID of the Dropbox member.
+func (d *UserSync) renamedMembers() map[string]directory.Account {
+	googleMembers := d.GoogleAccounts.Accounts()
+	googleById := make(map[string]directory.Account)
+	for _, x := range googleMembers {
+		if x.CorrelationId != "" {
+			googleById[x.CorrelationId] = x
+		}
+	}
+
+	renamed := make(map[string]directory.Account)
+	for _, x := range d.DropboxAccounts.Accounts() {
+		if x.CorrelationId == "" {
+			continue
+		}
+		g, exist := googleById[x.CorrelationId]
+		if !exist || g.Email == x.Email {
+			continue
+		}
+		if _, e := googleMembers[x.Email]; e {
+			seelog.Warnf("Email rename skipped, old email is used by another Google user: Email[%s] NewEmail[%s]", x.Email, g.Email)
+			continue
+		}
+		renamed[g.Email] = x
+	}
+	return renamed
+}